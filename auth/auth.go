@@ -1,42 +1,71 @@
 package auth
 
 import (
-	"crypto/rand"
-	"database/sql"
 	"encoding/json"
 	"errors"
-	"math/big"
 	"net/http"
+	"time"
 
+	"github.com/warrenharper/restapi/utils/response"
 	"golang.org/x/crypto/bcrypt"
 )
 
 const (
-	CookieName       = "RESTAPI"
-	secret           = "Not a secret"
-	randMax    int64 = 54050505434503053
+	CookieName = "RESTAPI"
+)
+
+const (
+	DefaultSessionLifetime = 24 * time.Hour
+	DefaultIdleTimeout     = 30 * time.Minute
 )
 
 var (
 	InvalidSessionErr = errors.New("Invalid Session")
+	ExpiredSessionErr = errors.New("Expired Session")
+	DisabledUserErr   = errors.New("Disabled User")
 )
 
+// now is used in place of time.Now so that tests can control the clock.
+var now = time.Now
+
 type User struct {
 	// id refers to the ID that is stored in the database
-	id       int    `json:-`
+	id       int    `json:"-"`
 	Username string `json:"username"`
-	Password string `json:"password"`
+	Password string `json:"password,omitempty"`
+	Role     Role   `json:"role,omitempty"`
+	Disabled bool   `json:"disabled"`
 }
+
+type Users struct {
+	Users []User `json:"users"`
+}
+
+// Auth authenticates users against its UserStore and keeps track of their
+// sessions in its SessionStore and their API tokens in its TokenStore.
 type Auth struct {
-	*sql.DB
+	UserStore
+	SessionStore
+	TokenStore
+
+	// SessionLifetime is how long a session lasts after it is created no
+	// matter how often it is used. If it is zero DefaultSessionLifetime is used.
+	SessionLifetime time.Duration
+
+	// IdleTimeout is how long a session lasts without being used. If it is
+	// zero DefaultIdleTimeout is used.
+	IdleTimeout time.Duration
+
+	// Cookie holds the attributes of the session cookie. If it is nil
+	// DefaultCookieOptions is used.
+	Cookie *CookieOptions
 }
 
 // HandleLogin checks decodes the request and creates a session for valid
 // credentials. If the users credentials are correct and session could be
 // created than a 200 code with a message of "Authorized" will be returned.
-// If the credentials are bad 401 code with a message of "Unauthorized" will
-// be returned. A 501 error  with a message of "Server Error" will be returned
-// if a session cannot be created or the body of the response cannot be written.
+// If the credentials are bad a problem with a 401 code will be returned. A
+// problem with a 500 code will be returned if a session cannot be created.
 func (a Auth) HandleLogin(w http.ResponseWriter, r *http.Request) {
 	var (
 		user User
@@ -45,59 +74,59 @@ func (a Auth) HandleLogin(w http.ResponseWriter, r *http.Request) {
 
 	err = json.NewDecoder(r.Body).Decode(&user)
 	if err != nil {
-		http.Error(w, "Format Error", http.StatusBadRequest)
+		response.MalformedBody(w, r)
 		return
 	}
 	user, err = a.login(user.Username, user.Password)
 	if err != nil {
-		Unauthorized(w)
+		Unauthorized(w, r)
 		return
 	}
-	sessionID, err := a.createSession(user)
+	token, session, err := a.createSession(user)
 
 	if err != nil {
-		http.Error(w, "Server Error", http.StatusInternalServerError)
+		response.ServerError(w, r)
 		return
 	}
 
-	cookie := generateCookie(sessionID)
+	cookie := a.generateCookie(token, a.expires(session))
 	http.SetCookie(w, cookie)
 
 	if _, err := w.Write([]byte("Authorized")); err != nil {
-		http.Error(w, "Server Error", http.StatusInternalServerError)
+		response.ServerError(w, r)
 	}
 
 }
 
-// Handlelogout will write a 200 code with a message of success to the response.
-// If the response cannot be written to, a 500 code with the message "Server Error" will be sent
+// Handlelogout will revoke the session, clear the session cookie and write a
+// 200 code with a message of success to the response.
+// If the response cannot be written to, a problem with a 500 code will be sent
 func (a Auth) HandleLogout(w http.ResponseWriter, r *http.Request) {
 	cookie, err := r.Cookie(CookieName)
 	if err == nil {
 		a.revokeSession(cookie.Value)
+		http.SetCookie(w, a.generateCookie("", time.Unix(0, 0)))
 	}
 
 	if _, err := w.Write([]byte("Success")); err != nil {
-		http.Error(w, "Server Error", http.StatusInternalServerError)
+		response.ServerError(w, r)
 	}
 
 }
 
-// CheckSession checks the request to verify that the value of cookie with the
-// name "RESTAPI" matches a session id  stored in the database
+// CheckSession checks the request to verify that the hash of the value of the
+// cookie with the name "RESTAPI" matches a session id stored in the SessionStore. A session
+// that has outlived its lifetime or idle timeout is revoked and
+// ExpiredSessionErr is returned, otherwise the session is marked as seen.
 func (a Auth) CheckSession(r *http.Request) (user User, err error) {
-	cookie, err := r.Cookie(CookieName)
-	if err != nil {
-		return user, err
-	}
-	err = a.DB.QueryRow("SELECT id, username FROM users INNER JOIN sessions ON users.id = sessions.user_id WHERE sessions.session_id = $1", cookie.Value).Scan(&user.id, &user.Username)
-
-	return user, err
+	_, session, err := a.checkSession(r)
+	return session.User, err
 }
 
-// VerifySessions will return a handler that will verify that a session
-// exists before allowing the handler in the arugment to be called.
-// If a session does not exist sends a 403 code.
+// VerifySessions will return a handler that will verify that a session or
+// an API token in an "Authorization: Bearer" header exists before allowing
+// the handler in the arugment to be called.
+// If neither exists sends a 403 code.
 func (a Auth) VerifySessions(h http.Handler) http.Handler {
 	return sessionsHandler{
 		Handler: h,
@@ -105,70 +134,85 @@ func (a Auth) VerifySessions(h http.Handler) http.Handler {
 	}
 }
 
-// RegisterUser register a user and stores them in the database.
+// RegisterUser register a user and stores them in the UserStore. Users
+// without a role are viewers.
 func (a Auth) RegisterUser(user User) error {
+	if user.Role == "" {
+		user.Role = RoleViewer
+	}
+	if !user.Role.Valid() {
+		return InvalidRoleErr
+	}
+
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
 		return err
 	}
 
-	_, err = a.DB.Exec("INSERT INTO users(username, password) VALUES($1, $2)", user.Username, hashedPassword)
-	return err
+	user.Password = string(hashedPassword)
+	return a.AddUser(user)
 }
 
 // Unauthorized is just a convience function that allows us to write a
-// status code of 401 and a message of "Unauthorized" to the response
-func Unauthorized(w http.ResponseWriter) {
-	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+// problem with a status code of 401 for bad credentials to the response
+func Unauthorized(w http.ResponseWriter, r *http.Request) {
+	response.Error(w, r, http.StatusUnauthorized, response.CodeInvalidCredentials, "The username or password is incorrect")
 }
 
 // Forbidden is just a convience function that allows us to write a
-// status code of 403 and a message of "Forbidden" to the response
-func Forbidden(w http.ResponseWriter) {
-	http.Error(w, "Forbidden", http.StatusForbidden)
+// problem with a status code of 403 for a request without a live session or
+// API token to the response
+func Forbidden(w http.ResponseWriter, r *http.Request) {
+	response.Error(w, r, http.StatusForbidden, response.CodeUnauthenticated, UnauthenticatedErr.Error())
 }
 
-// generateCookie returns a cookie whose name is "RESTAPI" and whose value is
-// the value of the argument.
-func generateCookie(sessionID string) *http.Cookie {
-	return &http.Cookie{
-		Name:  CookieName,
-		Value: sessionID,
+// Denied writes a problem with a status code of 403 for an error returned by
+// Authorize. A PermissionErr names the missing permission.
+func Denied(w http.ResponseWriter, r *http.Request, err error) {
+	pe, ok := err.(PermissionErr)
+	if !ok {
+		Forbidden(w, r)
+		return
 	}
-
+	response.WriteProblem(w, r, response.NewProblem(http.StatusForbidden, response.CodeForbidden, pe.Error()).With("permission", pe.Permission))
 }
 
 // login verifies that the credentials are valid and returns a populated user
 // if they are valid with a nil error. If the error is non-nil credential
 // validation failed
 func (a Auth) login(username, password string) (user User, err error) {
-	user.Username = username
-	if err = a.DB.QueryRow("SELECT id, password FROM users where username = $1", username).Scan(&user.id, &user.Password); err != nil {
+	if user, err = a.GetUser(username); err != nil {
 		return user, err
 	}
+	if user.Disabled {
+		return user, DisabledUserErr
+	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
 	return user, err
 
 }
 
-// createSession creates a session id and adds to the database, and returns
-// the created session id.
-func (a Auth) createSession(user User) (sessionID string, err error) {
+// createSession creates a session token and adds a session whose id is the
+// hash of the token to the SessionStore. It returns the token along with the
+// created session.
+func (a Auth) createSession(user User) (token string, session Session, err error) {
+	token, err = newToken()
+	if err != nil {
+		return token, session, err
+	}
 
-	sessNum, err := rand.Int(rand.Reader, big.NewInt(randMax))
-	if err == nil {
-		sessionID = sessNum.String()
-		_, err = a.DB.Exec("INSERT INTO sessions(session_id, user_id) VALUES($1, $2)", sessionID, user.id)
+	created := now()
+	session = Session{
+		ID:        hashToken(token),
+		User:      user,
+		CreatedAt: created,
+		LastSeen:  created,
 	}
-	return sessionID, err
+	return token, session, a.AddSession(session)
 }
 
-// revokeSession removes the argument from the database.
-func (a Auth) revokeSession(sessionID string) error {
-	_, err := a.DB.Exec("DELETE FROM sessions where session_id = $1", sessionID)
-	if err == sql.ErrNoRows {
-		err = nil
-	}
-	return err
+// revokeSession removes the session belonging to the token from the SessionStore.
+func (a Auth) revokeSession(token string) error {
+	return a.DeleteSession(hashToken(token))
 }
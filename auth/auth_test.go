@@ -3,7 +3,9 @@ package auth
 import (
 	"bytes"
 	"database/sql"
+	"encoding/base64"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"log"
@@ -11,10 +13,14 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	_ "github.com/lib/pq"
+	"github.com/warrenharper/restapi/utils/response"
 )
 
+var postgres = flag.Bool("postgres", false, "run the auth tests against the apitest database")
+
 func SetupDB() *sql.DB {
 	db, err := sql.Open("postgres", "user=tenable password=insecure dbname=apitest")
 	if err != nil {
@@ -25,13 +31,12 @@ func SetupDB() *sql.DB {
 }
 
 func ResetDB(db *sql.DB) {
+	db.Exec("DELETE FROM api_tokens")
+	db.Exec("DELETE FROM sessions")
 	db.Exec("DELETE FROM users")
 	db.Exec("DELETE FROM configuration")
-	db.Exec("DELETE FROM sessions")
 }
 
-var auth = Auth{SetupDB()}
-
 type Failure struct {
 	Prefix   string
 	Expected interface{}
@@ -54,15 +59,16 @@ func (f Failure) Error() string {
 }
 
 var handlerTests = map[string]struct {
-	Setup func() error
-	http.HandlerFunc
-	*http.Request
-	pass func(r *httptest.ResponseRecorder) error
+	Setup      func() error
+	handler    func(auth Auth, w http.ResponseWriter, r *http.Request)
+	newRequest func() *http.Request
+	pass       func(r *httptest.ResponseRecorder) error
+	verify     func(auth Auth, r *http.Request) error
 }{
 
 	"TestValidLogin": {
-		HandlerFunc: auth.HandleLogin,
-		Request:     generateLoginRequest(User{0, "john", "1234abc"}),
+		handler:    Auth.HandleLogin,
+		newRequest: func() *http.Request { return generateLoginRequest(User{Username: "john", Password: "1234abc"}) },
 		pass: func(r *httptest.ResponseRecorder) error {
 			if r.Code != http.StatusOK {
 				return Failure{"", http.StatusOK, r.Code}
@@ -80,8 +86,8 @@ var handlerTests = map[string]struct {
 	},
 
 	"TestInvalidLogin": {
-		HandlerFunc: auth.HandleLogin,
-		Request:     generateLoginRequest(User{0, "john", "1234a"}),
+		handler:    Auth.HandleLogin,
+		newRequest: func() *http.Request { return generateLoginRequest(User{Username: "john", Password: "1234a"}) },
 		pass: func(r *httptest.ResponseRecorder) error {
 			if r.Code != http.StatusUnauthorized {
 				return Failure{"", http.StatusUnauthorized, r.Code}
@@ -89,9 +95,12 @@ var handlerTests = map[string]struct {
 			if r.Header().Get("Set-Cookie") != "" {
 				return Failure{"Cookie Set", nil, nil}
 			}
-			body := strings.TrimSpace(r.Body.String())
-			if body != "Unauthorized" {
-				return Failure{"Body did not match", "Unauthorized", body}
+			var problem response.Problem
+			if err := json.NewDecoder(r.Body).Decode(&problem); err != nil || problem.Code != response.CodeInvalidCredentials {
+				return Failure{"Body did not match", response.CodeInvalidCredentials, problem.Code}
+			}
+			if contentType := r.Header().Get("Content-Type"); contentType != response.ProblemContentType {
+				return Failure{"Wrong content type", response.ProblemContentType, contentType}
 			}
 
 			return nil
@@ -99,20 +108,20 @@ var handlerTests = map[string]struct {
 	},
 
 	"TestValidSession": {
-		HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
-			loginReq := generateLoginRequest(User{0, "john", "1234abc"})
+		handler: func(auth Auth, w http.ResponseWriter, r *http.Request) {
+			loginReq := generateLoginRequest(User{Username: "john", Password: "1234abc"})
 			loginRecorder := httptest.NewRecorder()
 			auth.HandleLogin(loginRecorder, loginReq)
 			cookie := loginRecorder.Header().Get("Set-Cookie")
 			r.Header.Set("Cookie", cookie)
 			if user, err := auth.CheckSession(r); err != nil || user.Username != "john" {
-				Unauthorized(w)
+				Unauthorized(w, r)
 			}
 			if _, err := w.Write([]byte("Success")); err != nil {
 				http.Error(w, "Server Error", http.StatusInternalServerError)
 			}
 		},
-		Request: NewRequest("GET", "/secret", nil),
+		newRequest: func() *http.Request { return NewRequest("GET", "/secret", nil) },
 		pass: func(r *httptest.ResponseRecorder) error {
 			if r.Code != http.StatusOK {
 				return Failure{"", http.StatusOK, r.Code}
@@ -127,8 +136,8 @@ var handlerTests = map[string]struct {
 	},
 
 	"TestInvalidSession": {
-		HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
-			loginReq := generateLoginRequest(User{0, "john", "1234abc"})
+		handler: func(auth Auth, w http.ResponseWriter, r *http.Request) {
+			loginReq := generateLoginRequest(User{Username: "john", Password: "1234abc"})
 			loginRecorder := httptest.NewRecorder()
 			auth.HandleLogin(loginRecorder, loginReq)
 			cookie := &http.Cookie{
@@ -137,29 +146,32 @@ var handlerTests = map[string]struct {
 			}
 			r.Header.Set("Cookie", cookie.String())
 			if user, err := auth.CheckSession(r); err != nil || user.Username != "john" {
-				Unauthorized(w)
+				Unauthorized(w, r)
 				return
 			}
 			if _, err := w.Write([]byte("Success")); err != nil {
 				http.Error(w, "Server Error", http.StatusInternalServerError)
 			}
 		},
-		Request: NewRequest("GET", "/secret", nil),
+		newRequest: func() *http.Request { return NewRequest("GET", "/secret", nil) },
 		pass: func(r *httptest.ResponseRecorder) error {
 			if r.Code != http.StatusUnauthorized {
 				return Failure{"", http.StatusOK, r.Code}
 			}
-			body := strings.TrimSpace(r.Body.String())
-			if body != "Unauthorized" {
-				return Failure{"Body did not match", "Unauthorized", body}
+			var problem response.Problem
+			if err := json.NewDecoder(r.Body).Decode(&problem); err != nil || problem.Code != response.CodeInvalidCredentials {
+				return Failure{"Body did not match", response.CodeInvalidCredentials, problem.Code}
+			}
+			if contentType := r.Header().Get("Content-Type"); contentType != response.ProblemContentType {
+				return Failure{"Wrong content type", response.ProblemContentType, contentType}
 			}
 
 			return nil
 		},
 	},
 	"TestLogout": {
-		HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
-			loginReq := generateLoginRequest(User{0, "john", "1234abc"})
+		handler: func(auth Auth, w http.ResponseWriter, r *http.Request) {
+			loginReq := generateLoginRequest(User{Username: "john", Password: "1234abc"})
 			loginRecorder := httptest.NewRecorder()
 			auth.HandleLogin(loginRecorder, loginReq)
 			cookie := loginRecorder.Header().Get("Set-Cookie")
@@ -176,31 +188,53 @@ var handlerTests = map[string]struct {
 				return Failure{"Body did not match", "Success", body}
 			}
 
-			count := -1
-			err := auth.DB.QueryRow("SELECT COUNT(session_id) from sessions").Scan(&count)
-			if err != nil {
-				return Failure{"Unable to access count of sessions", nil, nil}
-			}
-			if count != 0 {
-				return Failure{"Session not removed from the database", nil, nil}
+			return nil
+		},
+		verify: func(auth Auth, r *http.Request) error {
+			if _, err := auth.CheckSession(r); err != InvalidSessionErr {
+				return Failure{"Session not removed from the store", InvalidSessionErr, err}
 			}
-
 			return nil
 		},
-		Request: NewRequest("POST", "/logout", nil),
+		newRequest: func() *http.Request { return NewRequest("POST", "/logout", nil) },
 	},
 }
 
 func TestHandler(t *testing.T) {
+	runHandlerTests(t, func() Auth {
+		store := NewMemoryStore()
+		return Auth{UserStore: store, SessionStore: store, TokenStore: store}
+	})
+}
+
+func TestPostgresHandler(t *testing.T) {
+	if !*postgres {
+		t.Skip("run with -postgres to test against the apitest database")
+	}
+	db := SetupDB()
+	runHandlerTests(t, func() Auth {
+		ResetDB(db)
+		return Auth{UserStore: PostgresStore{db}, SessionStore: PostgresStore{db}, TokenStore: PostgresStore{db}}
+	})
+}
+
+func runHandlerTests(t *testing.T, newAuth func() Auth) {
 	log.SetFlags(log.Lshortfile)
 	for testName, test := range handlerTests {
-		auth.RegisterUser(User{0, "john", "1234abc"})
+		auth := newAuth()
+		auth.RegisterUser(User{Username: "john", Password: "1234abc"})
 		r := httptest.NewRecorder()
-		test.HandlerFunc(r, test.Request)
+		req := test.newRequest()
+		test.handler(auth, r, req)
 		if err := test.pass(r); err != nil {
 			t.Error("Failed:", testName, err.Error())
 		}
-		ResetDB(auth.DB)
+		if test.verify == nil {
+			continue
+		}
+		if err := test.verify(auth, req); err != nil {
+			t.Error("Failed:", testName, err.Error())
+		}
 	}
 }
 
@@ -217,3 +251,275 @@ func NewRequest(method, url string, reader io.Reader) (req *http.Request) {
 	req, _ = http.NewRequest(method, url, reader)
 	return req
 }
+
+func TestSessionExpiry(t *testing.T) {
+	defer func() { now = time.Now }()
+	start := time.Now()
+
+	tests := map[string]struct {
+		// seen are the offsets from login at which the session is used.
+		seen     []time.Duration
+		expected error
+	}{
+		"TestFreshSession":   {seen: []time.Duration{time.Minute}, expected: nil},
+		"TestIdleSession":    {seen: []time.Duration{31 * time.Minute}, expected: ExpiredSessionErr},
+		"TestSlidingSession": {seen: []time.Duration{20 * time.Minute, 40 * time.Minute, 59 * time.Minute}, expected: nil},
+		"TestSessionLifetime": {
+			seen:     []time.Duration{20 * time.Minute, 40 * time.Minute, 60 * time.Minute},
+			expected: ExpiredSessionErr,
+		},
+	}
+
+	for testName, test := range tests {
+		store := NewMemoryStore()
+		auth := Auth{UserStore: store, SessionStore: store, TokenStore: store, SessionLifetime: time.Hour, IdleTimeout: 30 * time.Minute}
+		now = func() time.Time { return start }
+		auth.RegisterUser(User{Username: "john", Password: "1234abc"})
+		loginRecorder := httptest.NewRecorder()
+		auth.HandleLogin(loginRecorder, generateLoginRequest(User{Username: "john", Password: "1234abc"}))
+
+		var err error
+		for _, offset := range test.seen {
+			now = func() time.Time { return start.Add(offset) }
+			r := NewRequest("GET", "/secret", nil)
+			r.Header.Set("Cookie", loginRecorder.Header().Get("Set-Cookie"))
+			_, err = auth.CheckSession(r)
+		}
+		if err != test.expected {
+			t.Error("Failed:", testName, Failure{"Errors do not match", test.expected, err})
+		}
+	}
+}
+
+func TestReapSessions(t *testing.T) {
+	defer func() { now = time.Now }()
+	start := time.Now()
+	now = func() time.Time { return start }
+
+	store := NewMemoryStore()
+	auth := Auth{UserStore: store, SessionStore: store, TokenStore: store}
+	auth.RegisterUser(User{Username: "john", Password: "1234abc"})
+	user, _ := auth.login("john", "1234abc")
+	_, stale, _ := auth.createSession(user)
+
+	now = func() time.Time { return start.Add(DefaultIdleTimeout - time.Minute) }
+	_, fresh, _ := auth.createSession(user)
+
+	now = func() time.Time { return start.Add(DefaultIdleTimeout + time.Minute) }
+	if count, err := auth.reapSessions(); err != nil || count != 1 {
+		t.Error("Failed:", Failure{"Wrong number of sessions reaped", 1, count})
+	}
+	if _, err := auth.GetSession(stale.ID); err != InvalidSessionErr {
+		t.Error("Failed:", Failure{"Stale session not reaped", InvalidSessionErr, err})
+	}
+	if _, err := auth.GetSession(fresh.ID); err != nil {
+		t.Error("Failed:", Failure{"Fresh session reaped", nil, err})
+	}
+}
+
+func TestSessionCookie(t *testing.T) {
+	store := NewMemoryStore()
+	auth := Auth{UserStore: store, SessionStore: store, TokenStore: store}
+	auth.RegisterUser(User{Username: "john", Password: "1234abc"})
+	r := httptest.NewRecorder()
+	auth.HandleLogin(r, generateLoginRequest(User{Username: "john", Password: "1234abc"}))
+
+	cookies := r.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatal("Failed:", Failure{"Wrong number of cookies", 1, len(cookies)})
+	}
+	cookie := cookies[0]
+	if !cookie.HttpOnly || !cookie.Secure || cookie.SameSite != http.SameSiteLaxMode || cookie.Path != "/" {
+		t.Error("Failed:", Failure{"Cookie attributes do not match", DefaultCookieOptions(), cookie})
+	}
+	if raw, err := base64.RawURLEncoding.DecodeString(cookie.Value); err != nil || len(raw) != tokenBytes {
+		t.Error("Failed:", Failure{"Token is not 256 bits", tokenBytes, len(raw)})
+	}
+	if _, err := store.GetSession(cookie.Value); err != InvalidSessionErr {
+		t.Error("Failed:", Failure{"Token stored in plaintext", InvalidSessionErr, err})
+	}
+	if _, err := store.GetSession(hashToken(cookie.Value)); err != nil {
+		t.Error("Failed:", Failure{"Hash of token not stored", nil, err})
+	}
+}
+
+func TestAPITokens(t *testing.T) {
+	defer func() { now = time.Now }()
+	start := time.Now()
+	now = func() time.Time { return start }
+
+	store := NewMemoryStore()
+	auth := Auth{UserStore: store, SessionStore: store, TokenStore: store}
+	auth.RegisterUser(User{Username: "john", Password: "1234abc", Role: RoleEditor})
+	loginRecorder := httptest.NewRecorder()
+	auth.HandleLogin(loginRecorder, generateLoginRequest(User{Username: "john", Password: "1234abc"}))
+	cookie := loginRecorder.Header().Get("Set-Cookie")
+
+	tokens := auth.VerifySessions(auth.TokenHandler())
+	secret := auth.VerifySessions(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		permission := ReadConfigurations
+		if r.Method != "GET" {
+			permission = WriteConfigurations
+		}
+		if err := Authorize(r, permission); err != nil {
+			Denied(w, r, err)
+			return
+		}
+		w.Write([]byte("Success"))
+	}))
+
+	createReq := NewRequest("POST", "/", strings.NewReader(`{"name": "ci", "scopes": ["configurations:read"], "expires_in": 3600}`))
+	createReq.Header.Set("Cookie", cookie)
+	r := httptest.NewRecorder()
+	tokens.ServeHTTP(r, createReq)
+	if r.Code != http.StatusCreated {
+		t.Fatal("Failed:", Failure{"Token not created", http.StatusCreated, r.Code})
+	}
+	var created APIToken
+	if err := json.NewDecoder(r.Body).Decode(&created); err != nil || created.Token == "" {
+		t.Fatal("Failed:", Failure{"Token not returned", nil, err})
+	}
+
+	bearer := func(method string) int {
+		req := NewRequest(method, "/secret", nil)
+		req.Header.Set("Authorization", "Bearer "+created.Token)
+		r := httptest.NewRecorder()
+		secret.ServeHTTP(r, req)
+		return r.Code
+	}
+
+	requests := []struct {
+		name     string
+		method   string
+		offset   time.Duration
+		expected int
+	}{
+		{"TestTokenRead", "GET", 0, http.StatusOK},
+		{"TestTokenScope", "DELETE", 0, http.StatusForbidden},
+		{"TestTokenExpired", "GET", time.Hour, http.StatusForbidden},
+	}
+	for _, test := range requests {
+		now = func() time.Time { return start.Add(test.offset) }
+		if code := bearer(test.method); code != test.expected {
+			t.Error("Failed:", test.name, Failure{"", test.expected, code})
+		}
+	}
+	now = func() time.Time { return start }
+
+	tokenReq := NewRequest("POST", "/", strings.NewReader(`{"name": "other", "scopes": ["configurations:read"]}`))
+	tokenReq.Header.Set("Authorization", "Bearer "+created.Token)
+	r = httptest.NewRecorder()
+	tokens.ServeHTTP(r, tokenReq)
+	if r.Code != http.StatusForbidden {
+		t.Error("Failed: TestTokenCannotCreateToken", Failure{"", http.StatusForbidden, r.Code})
+	}
+
+	// The lifetime would overflow a time.Duration if it were converted first.
+	longReq := NewRequest("POST", "/", strings.NewReader(`{"name": "long", "scopes": ["configurations:read"], "expires_in": 9223372037}`))
+	longReq.Header.Set("Cookie", cookie)
+	r = httptest.NewRecorder()
+	tokens.ServeHTTP(r, longReq)
+	if r.Code != http.StatusBadRequest {
+		t.Error("Failed: TestTokenOverflowingExpiry", Failure{"", http.StatusBadRequest, r.Code})
+	}
+
+	deleteReq := NewRequest("DELETE", fmt.Sprintf("/%d", created.ID), nil)
+	deleteReq.Header.Set("Cookie", cookie)
+	r = httptest.NewRecorder()
+	tokens.ServeHTTP(r, deleteReq)
+	if r.Code != http.StatusNoContent {
+		t.Error("Failed: TestTokenRevoke", Failure{"", http.StatusNoContent, r.Code})
+	}
+	if code := bearer("GET"); code != http.StatusForbidden {
+		t.Error("Failed: TestRevokedToken", Failure{"", http.StatusForbidden, code})
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	readOnly := &APIToken{Scopes: []string{string(ReadConfigurations)}}
+	tests := map[string]struct {
+		principal  *principal
+		permission Permission
+		expected   error
+	}{
+		"TestUnauthenticated": {nil, ReadConfigurations, UnauthenticatedErr},
+		"TestViewerRead":      {&principal{User: User{Role: RoleViewer}}, ReadConfigurations, nil},
+		"TestViewerWrite":     {&principal{User: User{Role: RoleViewer}}, WriteConfigurations, PermissionErr{WriteConfigurations}},
+		"TestEditorWrite":     {&principal{User: User{Role: RoleEditor}}, WriteConfigurations, nil},
+		"TestAdminWrite":      {&principal{User: User{Role: RoleAdmin}}, WriteConfigurations, nil},
+		"TestTokenScope":      {&principal{User: User{Role: RoleAdmin}, Token: readOnly}, WriteConfigurations, PermissionErr{WriteConfigurations}},
+		"TestTokenRole":       {&principal{User: User{Role: RoleViewer}, Token: &APIToken{Scopes: []string{string(WriteConfigurations)}}}, WriteConfigurations, PermissionErr{WriteConfigurations}},
+	}
+
+	for testName, test := range tests {
+		r := NewRequest("GET", "/secret", nil)
+		if test.principal != nil {
+			r = r.WithContext(newContext(r.Context(), *test.principal))
+		}
+		if err := Authorize(r, test.permission); err != test.expected {
+			t.Error("Failed:", testName, Failure{"Errors do not match", test.expected, err})
+		}
+	}
+}
+
+func TestUserManagement(t *testing.T) {
+	store := NewMemoryStore()
+	auth := Auth{UserStore: store, SessionStore: store, TokenStore: store}
+	auth.RegisterUser(User{Username: "admin", Password: "adminpass", Role: RoleAdmin})
+	users := auth.VerifySessions(auth.UserHandler())
+
+	login := func(username, password string) (cookie string, code int) {
+		r := httptest.NewRecorder()
+		auth.HandleLogin(r, generateLoginRequest(User{Username: username, Password: password}))
+		return r.Header().Get("Set-Cookie"), r.Code
+	}
+	adminCookie, _ := login("admin", "adminpass")
+	var janeCookie string
+
+	steps := []struct {
+		name     string
+		cookie   func() string
+		method   string
+		url      string
+		body     string
+		expected int
+	}{
+		{"TestCreateUser", func() string { return adminCookie }, "POST", "/", `{"username": "jane", "password": "janepass"}`, http.StatusCreated},
+		{"TestCreateDuplicateUser", func() string { return adminCookie }, "POST", "/", `{"username": "jane", "password": "janepass"}`, http.StatusConflict},
+		{"TestCreateShortPassword", func() string { return adminCookie }, "POST", "/", `{"username": "bob", "password": "short"}`, http.StatusBadRequest},
+		{"TestListUsers", func() string { return adminCookie }, "GET", "/", "", http.StatusOK},
+		{"TestViewerListUsers", func() string { return janeCookie }, "GET", "/", "", http.StatusForbidden},
+		{"TestGetSelf", func() string { return janeCookie }, "GET", "/jane", "", http.StatusOK},
+		{"TestGetOther", func() string { return janeCookie }, "GET", "/admin", "", http.StatusForbidden},
+		{"TestChangePasswordWrongOld", func() string { return janeCookie }, "PUT", "/jane/password", `{"old_password": "wrong", "new_password": "newjanepass"}`, http.StatusUnauthorized},
+		{"TestChangePassword", func() string { return janeCookie }, "PUT", "/jane/password", `{"old_password": "janepass", "new_password": "newjanepass"}`, http.StatusNoContent},
+		{"TestResetPassword", func() string { return adminCookie }, "PUT", "/jane/password", `{"new_password": "resetpass"}`, http.StatusNoContent},
+		{"TestResetLogsOut", func() string { return janeCookie }, "GET", "/jane", "", http.StatusForbidden},
+		{"TestDisableUser", func() string { return adminCookie }, "PATCH", "/jane", `{"disabled": true}`, http.StatusOK},
+		{"TestDisableSelf", func() string { return adminCookie }, "PATCH", "/admin", `{"disabled": true}`, http.StatusBadRequest},
+		{"TestDeleteUser", func() string { return adminCookie }, "DELETE", "/jane", "", http.StatusNoContent},
+		{"TestGetDeletedUser", func() string { return adminCookie }, "GET", "/jane", "", http.StatusNotFound},
+	}
+
+	for _, step := range steps {
+		if step.name == "TestViewerListUsers" {
+			janeCookie, _ = login("jane", "janepass")
+		}
+		if step.name == "TestDeleteUser" {
+			if _, code := login("jane", "resetpass"); code != http.StatusUnauthorized {
+				t.Error("Failed: TestDisabledLogin", Failure{"", http.StatusUnauthorized, code})
+			}
+		}
+
+		req := NewRequest(step.method, step.url, strings.NewReader(step.body))
+		req.Header.Set("Cookie", step.cookie())
+		r := httptest.NewRecorder()
+		users.ServeHTTP(r, req)
+		if r.Code != step.expected {
+			t.Error("Failed:", step.name, Failure{r.Body.String(), step.expected, r.Code})
+		}
+		if strings.Contains(r.Body.String(), `"password"`) {
+			t.Error("Failed:", step.name, Failure{"Password sent", nil, r.Body.String()})
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package auth
+
+import "context"
+
+type contextKey int
+
+const principalKey contextKey = 0
+
+// principal is who made a request. Token is set when the request was
+// authenticated with an API token rather than a session.
+type principal struct {
+	User  User
+	Token *APIToken
+}
+
+func newContext(ctx context.Context, p principal) context.Context {
+	return context.WithValue(ctx, principalKey, p)
+}
+
+func fromContext(ctx context.Context) (principal, bool) {
+	p, ok := ctx.Value(principalKey).(principal)
+	return p, ok
+}
+
+// FromContext returns the user that was authenticated by VerifySessions.
+func FromContext(ctx context.Context) (User, bool) {
+	p, ok := fromContext(ctx)
+	return p.User, ok
+}
@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"net/http"
+	"time"
+)
+
+// CookieOptions are the attributes of the session cookie.
+type CookieOptions struct {
+	HttpOnly bool
+	Secure   bool
+	SameSite http.SameSite
+	Domain   string
+	Path     string
+}
+
+// DefaultCookieOptions returns cookie options that keep the cookie away from
+// scripts, insecure connections and other sites.
+func DefaultCookieOptions() *CookieOptions {
+	return &CookieOptions{
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+		Path:     "/",
+	}
+}
+
+func (a Auth) cookieOptions() *CookieOptions {
+	if a.Cookie == nil {
+		return DefaultCookieOptions()
+	}
+	return a.Cookie
+}
+
+// generateCookie returns a cookie whose name is "RESTAPI", whose value is
+// the session token and that expires at the time in the second argument.
+func (a Auth) generateCookie(token string, expires time.Time) *http.Cookie {
+	options := a.cookieOptions()
+	maxAge := int(expires.Sub(now()).Seconds())
+	if maxAge <= 0 {
+		maxAge = -1
+	}
+	return &http.Cookie{
+		Name:     CookieName,
+		Value:    token,
+		Expires:  expires,
+		MaxAge:   maxAge,
+		HttpOnly: options.HttpOnly,
+		Secure:   options.Secure,
+		SameSite: options.SameSite,
+		Domain:   options.Domain,
+		Path:     options.Path,
+	}
+}
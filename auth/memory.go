@@ -0,0 +1,257 @@
+package auth
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a UserStore, SessionStore and TokenStore that keeps the
+// users, sessions and API tokens in memory. It is safe for concurrent use.
+type MemoryStore struct {
+	mu          sync.RWMutex
+	lastID      int
+	lastTokenID int
+	users       map[string]User
+	sessions    map[string]Session
+	tokens      map[string]APIToken
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:    make(map[string]User),
+		sessions: make(map[string]Session),
+		tokens:   make(map[string]APIToken),
+	}
+}
+
+// AddUser stores the user. It returns an error if the username is taken.
+func (ms *MemoryStore) AddUser(user User) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, ok := ms.users[user.Username]; ok {
+		return DuplicateUserErr
+	}
+	ms.lastID++
+	user.id = ms.lastID
+	ms.users[user.Username] = user
+	return nil
+}
+
+// GetUser returns the user with the matching username.
+func (ms *MemoryStore) GetUser(username string) (User, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	user, ok := ms.users[username]
+	if !ok {
+		return user, UnknownUserErr
+	}
+	return user, nil
+}
+
+// ListUsers returns all of the users ordered by id.
+func (ms *MemoryStore) ListUsers() ([]User, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	users := make([]User, 0, len(ms.users))
+	for _, user := range ms.users {
+		user.Password = ""
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].id < users[j].id })
+	return users, nil
+}
+
+// UpdateUser sets the password, role and disabled flag of the user.
+func (ms *MemoryStore) UpdateUser(user User) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	actual, ok := ms.users[user.Username]
+	if !ok {
+		return UnknownUserErr
+	}
+	actual.Password = user.Password
+	actual.Role = user.Role
+	actual.Disabled = user.Disabled
+	ms.users[user.Username] = actual
+	return nil
+}
+
+// DeleteUser removes the user along with their sessions and API tokens.
+func (ms *MemoryStore) DeleteUser(username string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	user, ok := ms.users[username]
+	if !ok {
+		return UnknownUserErr
+	}
+	delete(ms.users, username)
+	ms.deleteUserSessions(user.id)
+	for hash, token := range ms.tokens {
+		if token.user.id == user.id {
+			delete(ms.tokens, hash)
+		}
+	}
+	return nil
+}
+
+// AddSession stores the session.
+func (ms *MemoryStore) AddSession(session Session) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	session.User.Password = ""
+	ms.sessions[session.ID] = session
+	return nil
+}
+
+// GetSession returns the session with the matching id.
+func (ms *MemoryStore) GetSession(sessionID string) (Session, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	session, ok := ms.sessions[sessionID]
+	if !ok {
+		return session, InvalidSessionErr
+	}
+	if session.User, ok = ms.userByID(session.User.id); !ok {
+		return Session{}, InvalidSessionErr
+	}
+	return session, nil
+}
+
+// TouchSession sets the time the session was last seen.
+func (ms *MemoryStore) TouchSession(sessionID string, lastSeen time.Time) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if session, ok := ms.sessions[sessionID]; ok {
+		session.LastSeen = lastSeen
+		ms.sessions[sessionID] = session
+	}
+	return nil
+}
+
+// DeleteSession removes the session.
+func (ms *MemoryStore) DeleteSession(sessionID string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	delete(ms.sessions, sessionID)
+	return nil
+}
+
+// DeleteUserSessions removes every session of the user.
+func (ms *MemoryStore) DeleteUserSessions(user User) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if actual, ok := ms.users[user.Username]; ok {
+		ms.deleteUserSessions(actual.id)
+	}
+	return nil
+}
+
+// deleteUserSessions removes every session of the user with the id. The
+// caller must hold the lock.
+func (ms *MemoryStore) deleteUserSessions(id int) {
+	for sessionID, session := range ms.sessions {
+		if session.User.id == id {
+			delete(ms.sessions, sessionID)
+		}
+	}
+}
+
+// DeleteExpiredSessions removes the expired sessions.
+func (ms *MemoryStore) DeleteExpiredSessions(createdBefore, seenBefore time.Time) (count int, err error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	for id, session := range ms.sessions {
+		if session.CreatedAt.Before(createdBefore) || session.LastSeen.Before(seenBefore) {
+			delete(ms.sessions, id)
+			count++
+		}
+	}
+	return count, nil
+}
+
+// AddToken stores the token and returns it with its id set.
+func (ms *MemoryStore) AddToken(token APIToken) (APIToken, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	for _, t := range ms.tokens {
+		if t.user.id == token.user.id && t.Name == token.Name {
+			return token, DuplicateTokenErr
+		}
+	}
+	ms.lastTokenID++
+	token.ID = ms.lastTokenID
+	token.Token = ""
+	token.user.Password = ""
+	ms.tokens[token.hash] = token
+	return token, nil
+}
+
+// GetToken returns the token with the matching hash.
+func (ms *MemoryStore) GetToken(hash string) (APIToken, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	token, ok := ms.tokens[hash]
+	if !ok {
+		return token, InvalidTokenErr
+	}
+	if token.user, ok = ms.userByID(token.user.id); !ok {
+		return APIToken{}, InvalidTokenErr
+	}
+	return token, nil
+}
+
+// ListTokens returns all of the user's tokens ordered by id.
+func (ms *MemoryStore) ListTokens(user User) ([]APIToken, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	tokens := make([]APIToken, 0)
+	for _, token := range ms.tokens {
+		if token.user.id == user.id {
+			tokens = append(tokens, token)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].ID < tokens[j].ID })
+	return tokens, nil
+}
+
+// DeleteToken removes the user's token with the matching id.
+func (ms *MemoryStore) DeleteToken(user User, id int) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	for hash, token := range ms.tokens {
+		if token.ID == id && token.user.id == user.id {
+			delete(ms.tokens, hash)
+			return nil
+		}
+	}
+	return InvalidTokenErr
+}
+
+// userByID returns the current state of the user with the id without their
+// password. Disabled users are not returned. The caller must hold the lock.
+func (ms *MemoryStore) userByID(id int) (User, bool) {
+	for _, user := range ms.users {
+		if user.id == id && !user.Disabled {
+			user.Password = ""
+			return user, true
+		}
+	}
+	return User{}, false
+}
@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	uniqueViolation = "23505"
+)
+
+// PostgresStore is a UserStore, SessionStore and TokenStore that stores the
+// users, sessions and API tokens in Postgres.
+type PostgresStore struct {
+	*sql.DB
+}
+
+// AddUser stores the user in the users table.
+func (ps PostgresStore) AddUser(user User) error {
+	_, err := ps.DB.Exec("INSERT INTO users(username, password, role, disabled) VALUES($1, $2, $3, $4)", user.Username, user.Password, user.Role, user.Disabled)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == uniqueViolation {
+		err = DuplicateUserErr
+	}
+	return err
+}
+
+// GetUser returns the user with the matching username.
+func (ps PostgresStore) GetUser(username string) (user User, err error) {
+	err = ps.DB.QueryRow("SELECT id, username, password, role, disabled FROM users WHERE username = $1", username).Scan(&user.id, &user.Username, &user.Password, &user.Role, &user.Disabled)
+	if err == sql.ErrNoRows {
+		err = UnknownUserErr
+	}
+	return user, err
+}
+
+// ListUsers returns all of the users ordered by id.
+func (ps PostgresStore) ListUsers() (users []User, err error) {
+	users = make([]User, 0)
+	rows, err := ps.DB.Query("SELECT id, username, role, disabled FROM users ORDER BY id ASC")
+	if err != nil {
+		return users, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user := User{}
+		if err := rows.Scan(&user.id, &user.Username, &user.Role, &user.Disabled); err != nil {
+			return users, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// UpdateUser updates the user's row in the users table.
+func (ps PostgresStore) UpdateUser(user User) error {
+	result, err := ps.DB.Exec("UPDATE users SET password = $1, role = $2, disabled = $3 WHERE username = $4", user.Password, user.Role, user.Disabled, user.Username)
+	return userAffected(result, err)
+}
+
+// DeleteUser removes the user from the users table. Their sessions and API
+// tokens are removed along with them.
+func (ps PostgresStore) DeleteUser(username string) error {
+	result, err := ps.DB.Exec("DELETE FROM users WHERE username = $1", username)
+	return userAffected(result, err)
+}
+
+// userAffected returns UnknownUserErr if the statement did not change a user.
+func userAffected(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	if count, err := result.RowsAffected(); err != nil {
+		return err
+	} else if count == 0 {
+		return UnknownUserErr
+	}
+	return nil
+}
+
+// AddSession stores the session in the sessions table.
+func (ps PostgresStore) AddSession(session Session) error {
+	_, err := ps.DB.Exec("INSERT INTO sessions(session_id, user_id, created_at, last_seen) VALUES($1, $2, $3, $4)", session.ID, session.User.id, session.CreatedAt, session.LastSeen)
+	return err
+}
+
+// GetSession returns the session with the matching id.
+func (ps PostgresStore) GetSession(sessionID string) (session Session, err error) {
+	err = ps.DB.QueryRow(
+		`SELECT session_id, id, username, role, created_at, last_seen
+         FROM users INNER JOIN sessions ON users.id = sessions.user_id
+         WHERE sessions.session_id = $1 AND NOT users.disabled`, sessionID).Scan(&session.ID, &session.User.id, &session.User.Username, &session.User.Role, &session.CreatedAt, &session.LastSeen)
+	if err == sql.ErrNoRows {
+		err = InvalidSessionErr
+	}
+	return session, err
+}
+
+// TouchSession sets the time the session was last seen.
+func (ps PostgresStore) TouchSession(sessionID string, lastSeen time.Time) error {
+	_, err := ps.DB.Exec("UPDATE sessions SET last_seen = $1 WHERE session_id = $2", lastSeen, sessionID)
+	return err
+}
+
+// DeleteSession removes the session from the sessions table.
+func (ps PostgresStore) DeleteSession(sessionID string) error {
+	_, err := ps.DB.Exec("DELETE FROM sessions where session_id = $1", sessionID)
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	return err
+}
+
+// DeleteUserSessions removes the user's sessions from the sessions table.
+func (ps PostgresStore) DeleteUserSessions(user User) error {
+	_, err := ps.DB.Exec("DELETE FROM sessions WHERE user_id = (SELECT id FROM users WHERE username = $1)", user.Username)
+	return err
+}
+
+// DeleteExpiredSessions removes the expired sessions from the sessions table.
+func (ps PostgresStore) DeleteExpiredSessions(createdBefore, seenBefore time.Time) (int, error) {
+	result, err := ps.DB.Exec("DELETE FROM sessions WHERE created_at < $1 OR last_seen < $2", createdBefore, seenBefore)
+	if err != nil {
+		return 0, err
+	}
+	count, err := result.RowsAffected()
+	return int(count), err
+}
+
+// AddToken stores the token in the api_tokens table.
+func (ps PostgresStore) AddToken(token APIToken) (APIToken, error) {
+	err := ps.DB.QueryRow(
+		`INSERT INTO api_tokens(user_id, name, token_hash, scopes, created_at, expires_at)
+         VALUES($1, $2, $3, $4, $5, $6) RETURNING id`,
+		token.user.id, token.Name, token.hash, pq.Array(token.Scopes), token.CreatedAt, token.ExpiresAt).Scan(&token.ID)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == uniqueViolation {
+		err = DuplicateTokenErr
+	}
+	return token, err
+}
+
+// GetToken returns the token with the matching hash along with its user.
+func (ps PostgresStore) GetToken(hash string) (token APIToken, err error) {
+	err = ps.DB.QueryRow(
+		`SELECT api_tokens.id, name, scopes, created_at, expires_at, token_hash, users.id, username, role
+         FROM api_tokens INNER JOIN users ON users.id = api_tokens.user_id
+         WHERE token_hash = $1 AND NOT users.disabled`, hash).Scan(&token.ID, &token.Name, pq.Array(&token.Scopes), &token.CreatedAt, &token.ExpiresAt, &token.hash, &token.user.id, &token.user.Username, &token.user.Role)
+	if err == sql.ErrNoRows {
+		err = InvalidTokenErr
+	}
+	return token, err
+}
+
+// ListTokens returns all of the user's tokens ordered by id.
+func (ps PostgresStore) ListTokens(user User) (tokens []APIToken, err error) {
+	tokens = make([]APIToken, 0)
+	rows, err := ps.DB.Query("SELECT id, name, scopes, created_at, expires_at FROM api_tokens WHERE user_id = $1 ORDER BY id ASC", user.id)
+	if err != nil {
+		return tokens, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		token := APIToken{user: user}
+		if err := rows.Scan(&token.ID, &token.Name, pq.Array(&token.Scopes), &token.CreatedAt, &token.ExpiresAt); err != nil {
+			return tokens, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// DeleteToken removes the user's token from the api_tokens table.
+func (ps PostgresStore) DeleteToken(user User, id int) error {
+	result, err := ps.DB.Exec("DELETE FROM api_tokens WHERE id = $1 AND user_id = $2", id, user.id)
+	if err != nil {
+		return err
+	}
+	if count, err := result.RowsAffected(); err != nil {
+		return err
+	} else if count == 0 {
+		return InvalidTokenErr
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Role decides what a user is allowed to do.
+type Role string
+
+const (
+	RoleViewer Role = "viewer"
+	RoleEditor Role = "editor"
+	RoleAdmin  Role = "admin"
+)
+
+// Permission is an action that a Role may allow. Permissions are also the
+// scopes that can be granted to an APIToken.
+type Permission string
+
+const (
+	ReadConfigurations  Permission = "configurations:read"
+	WriteConfigurations Permission = "configurations:write"
+	ManageUsers         Permission = "users:manage"
+	ManageSchema        Permission = "schema:manage"
+)
+
+var (
+	InvalidRoleErr     = errors.New("Invalid Role")
+	UnauthenticatedErr = errors.New("Forbidden: not authenticated")
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleViewer: {ReadConfigurations},
+	RoleEditor: {ReadConfigurations, WriteConfigurations},
+	RoleAdmin:  {ReadConfigurations, WriteConfigurations, ManageUsers, ManageSchema},
+}
+
+// PermissionErr is returned when a user is missing the Permission needed for
+// a request.
+type PermissionErr struct {
+	Permission Permission
+}
+
+func (pe PermissionErr) Error() string {
+	return "Forbidden: missing permission " + string(pe.Permission)
+}
+
+// Valid reports whether the role is one of the known roles.
+func (r Role) Valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// Can reports whether the role allows the permission.
+func (r Role) Can(p Permission) bool {
+	for _, permission := range rolePermissions[r] {
+		if permission == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorize returns nil if the user that made the request has the
+// permission. Requests made with an API token also need the permission to be
+// one of the token's scopes. If the request was not authenticated by
+// VerifySessions UnauthenticatedErr is returned, otherwise a PermissionErr
+// is returned when the permission is missing.
+func Authorize(r *http.Request, p Permission) error {
+	principal, ok := fromContext(r.Context())
+	if !ok {
+		return UnauthenticatedErr
+	}
+	if !principal.User.Role.Can(p) || (principal.Token != nil && !principal.Token.Allows(p)) {
+		return PermissionErr{p}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"time"
+)
+
+// tokenBytes is the number of random bytes in a session token.
+const tokenBytes = 32
+
+// newToken returns a random 256 bit token encoded so that it is safe to use
+// in a cookie.
+func newToken() (string, error) {
+	raw := make([]byte, tokenBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// hashToken returns the hex encoded SHA-256 hash of the token. Only the hash
+// is stored so that the stored ids cannot be used as tokens.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// checkSession returns the token in the "RESTAPI" cookie and its live session
+// and marks the session as seen.
+func (a Auth) checkSession(r *http.Request) (token string, session Session, err error) {
+	cookie, err := r.Cookie(CookieName)
+	if err != nil {
+		return token, session, err
+	}
+
+	token = cookie.Value
+	if session, err = a.GetSession(hashToken(token)); err != nil {
+		return token, session, err
+	}
+
+	seen := now()
+	if !seen.Before(a.expires(session)) {
+		a.DeleteSession(session.ID)
+		return token, Session{}, ExpiredSessionErr
+	}
+
+	session.LastSeen = seen
+	return token, session, a.TouchSession(session.ID, seen)
+}
+
+// expires returns the time the session expires if it is not used again.
+func (a Auth) expires(session Session) time.Time {
+	expires := session.CreatedAt.Add(a.sessionLifetime())
+	if idle := session.LastSeen.Add(a.idleTimeout()); idle.Before(expires) {
+		expires = idle
+	}
+	return expires
+}
+
+func (a Auth) sessionLifetime() time.Duration {
+	if a.SessionLifetime == 0 {
+		return DefaultSessionLifetime
+	}
+	return a.SessionLifetime
+}
+
+func (a Auth) idleTimeout() time.Duration {
+	if a.IdleTimeout == 0 {
+		return DefaultIdleTimeout
+	}
+	return a.IdleTimeout
+}
+
+// ReapSessions deletes the expired sessions from the SessionStore every
+// interval until the returned function is called.
+func (a Auth) ReapSessions(interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := a.reapSessions(); err != nil {
+					log.Println("Unable to reap sessions:", err)
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// reapSessions deletes the expired sessions from the SessionStore and returns
+// how many were deleted.
+func (a Auth) reapSessions() (int, error) {
+	current := now()
+	return a.DeleteExpiredSessions(current.Add(-a.sessionLifetime()), current.Add(-a.idleTimeout()))
+}
@@ -7,12 +7,27 @@ type sessionsHandler struct {
 	Auth
 }
 
+// ServeHTTP sends a 403 code unless the request has a live session or API
+// token. The session's cookie is renewed so that it expires along with the
+// session. The authenticated user is added to the request's context so that
+// the handler can Authorize the request.
 func (s sessionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	_, err := s.CheckSession(r)
+	if _, ok := bearerToken(r); ok {
+		token, err := s.checkToken(r)
+		if err != nil {
+			Forbidden(w, r)
+			return
+		}
+		s.Handler.ServeHTTP(w, r.WithContext(newContext(r.Context(), principal{User: token.user, Token: &token})))
+		return
+	}
+
+	token, session, err := s.checkSession(r)
 	if err != nil {
-		Forbidden(w)
+		Forbidden(w, r)
 		return
 	}
 
-	s.Handler.ServeHTTP(w, r)
+	http.SetCookie(w, s.generateCookie(token, s.expires(session)))
+	s.Handler.ServeHTTP(w, r.WithContext(newContext(r.Context(), principal{User: session.User})))
 }
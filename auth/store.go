@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	UnknownUserErr   = errors.New("Unknown User")
+	DuplicateUserErr = errors.New("User exists with the same username")
+)
+
+// UserStore is the storage used to persist users.
+type UserStore interface {
+	// AddUser stores the user. The password of the user must already be
+	// hashed. If the username is taken DuplicateUserErr is returned.
+	AddUser(user User) error
+
+	// GetUser returns the user with the matching username including their
+	// hashed password. If no such user exists UnknownUserErr is returned.
+	GetUser(username string) (User, error)
+
+	// ListUsers returns all of the users without their passwords.
+	ListUsers() ([]User, error)
+
+	// UpdateUser sets the password, role and disabled flag of the user with
+	// the same username. If no such user exists UnknownUserErr is returned.
+	UpdateUser(user User) error
+
+	// DeleteUser removes the user along with their sessions and API tokens.
+	// If no such user exists UnknownUserErr is returned.
+	DeleteUser(username string) error
+}
+
+// Session is a logged in user's session.
+type Session struct {
+	ID        string
+	User      User
+	CreatedAt time.Time
+	LastSeen  time.Time
+}
+
+// SessionStore is the storage used to persist sessions.
+type SessionStore interface {
+	// AddSession stores the session.
+	AddSession(session Session) error
+
+	// GetSession returns the session with the matching id. If no such
+	// session exists or its user is disabled InvalidSessionErr is returned.
+	GetSession(sessionID string) (Session, error)
+
+	// TouchSession sets the time the session was last seen.
+	TouchSession(sessionID string, lastSeen time.Time) error
+
+	// DeleteSession removes the session. It will not return an error if the
+	// session does not exist.
+	DeleteSession(sessionID string) error
+
+	// DeleteUserSessions removes every session of the user.
+	DeleteUserSessions(user User) error
+
+	// DeleteExpiredSessions removes every session created before
+	// createdBefore or last seen before seenBefore and returns how many
+	// sessions were removed.
+	DeleteExpiredSessions(createdBefore, seenBefore time.Time) (int, error)
+}
+
+// TokenStore is the storage used to persist API tokens. Only the hash of a
+// token is ever stored.
+type TokenStore interface {
+	// AddToken stores the token and returns it with its id set. If the user
+	// already has a token with the same name DuplicateTokenErr is returned.
+	AddToken(token APIToken) (APIToken, error)
+
+	// GetToken returns the token with the matching hash. If no such token
+	// exists or its user is disabled InvalidTokenErr is returned.
+	GetToken(hash string) (APIToken, error)
+
+	// ListTokens returns all of the user's tokens.
+	ListTokens(user User) ([]APIToken, error)
+
+	// DeleteToken removes the user's token with the matching id. If the user
+	// has no such token InvalidTokenErr is returned.
+	DeleteToken(user User, id int) error
+}
@@ -0,0 +1,234 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/warrenharper/restapi/utils/response"
+	"github.com/warrenharper/restapi/utils/router"
+)
+
+const (
+	DefaultTokenLifetime = 30 * 24 * time.Hour
+	MaxTokenLifetime     = 365 * 24 * time.Hour
+)
+
+var (
+	InvalidTokenErr   = errors.New("Invalid Token")
+	ExpiredTokenErr   = errors.New("Expired Token")
+	DuplicateTokenErr = errors.New("Token exists with the same name")
+)
+
+// Scopes lists every permission that can be granted to an APIToken.
+var Scopes = []Permission{ReadConfigurations, WriteConfigurations, ManageUsers, ManageSchema}
+
+// APIToken is a named token that lets non-browser clients authenticate as a
+// user with the Authorization header. It can only be used for the actions
+// allowed by its scopes.
+type APIToken struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+
+	// Token is only set when the token is created. Afterwards only its hash
+	// is kept.
+	Token string `json:"token,omitempty"`
+
+	user User
+	hash string
+}
+
+type APITokens struct {
+	Tokens []APIToken `json:"tokens"`
+}
+
+// Allows reports whether the token was granted the permission.
+func (t APIToken) Allows(p Permission) bool {
+	for _, scope := range t.Scopes {
+		if scope == string(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenRequest is the body of a request to create an APIToken. ExpiresIn is
+// the lifetime of the token in seconds.
+type tokenRequest struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	ExpiresIn int      `json:"expires_in"`
+}
+
+// TokenHandler returns a handler that lets a logged in user create, list
+// and revoke their API tokens. It must be wrapped by VerifySessions. API
+// tokens cannot be used to manage API tokens.
+func (a Auth) TokenHandler() http.Handler {
+	rt := router.New()
+	rt.HandleFunc("GET", "/", func(w http.ResponseWriter, r *http.Request) { a.handleListTokens(w, r, requestUser(r)) })
+	rt.HandleFunc("POST", "/", func(w http.ResponseWriter, r *http.Request) { a.handleCreateToken(w, r, requestUser(r)) })
+	rt.Handle("DELETE", "/:id", router.WithParam("id", func(w http.ResponseWriter, r *http.Request, id string) {
+		a.handleDeleteToken(w, r, requestUser(r), id)
+	}))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := fromContext(r.Context())
+		if !ok || p.Token != nil {
+			Forbidden(w, r)
+			return
+		}
+		rt.ServeHTTP(w, r)
+	})
+}
+
+// requestUser returns the user that made the request.
+func requestUser(r *http.Request) User {
+	user, _ := FromContext(r.Context())
+	return user
+}
+
+// handleCreateToken creates a token with the name, scopes and lifetime in
+// the request body and sends it with a 201 code. This is the only time the
+// token itself is sent. If the user already has a token with the same name
+// a 409 code is sent.
+func (a Auth) handleCreateToken(w http.ResponseWriter, r *http.Request, user User) {
+	var tr tokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&tr); err != nil {
+		response.MalformedBody(w, r)
+		return
+	}
+
+	if err := tr.validate(); err != nil {
+		response.Error(w, r, http.StatusBadRequest, response.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	lifetime := DefaultTokenLifetime
+	if tr.ExpiresIn > 0 {
+		lifetime = time.Duration(tr.ExpiresIn) * time.Second
+	}
+
+	token, err := a.createToken(user, tr.Name, tr.Scopes, lifetime)
+	if err == DuplicateTokenErr {
+		response.Error(w, r, http.StatusConflict, response.CodeConflict, err.Error())
+		return
+	}
+	if err != nil {
+		response.ServerError(w, r)
+		return
+	}
+
+	response.Respond(w, r, http.StatusCreated, token)
+}
+
+// handleListTokens sends the user's tokens with a 200 code.
+func (a Auth) handleListTokens(w http.ResponseWriter, r *http.Request, user User) {
+	tokens, err := a.ListTokens(user)
+	if err != nil {
+		response.ServerError(w, r)
+		return
+	}
+	response.Respond(w, r, http.StatusOK, APITokens{tokens})
+}
+
+// handleDeleteToken revokes the user's token with the id in the url and
+// sends a 204 code. If the user has no such token a 404 code is sent.
+func (a Auth) handleDeleteToken(w http.ResponseWriter, r *http.Request, user User, tokenID string) {
+	id, err := strconv.Atoi(tokenID)
+	if err != nil {
+		response.NotFound(w, r, "Token does not exist")
+		return
+	}
+
+	err = a.DeleteToken(user, id)
+	if err == InvalidTokenErr {
+		response.NotFound(w, r, "Token does not exist")
+		return
+	}
+	if err != nil {
+		response.ServerError(w, r)
+		return
+	}
+	response.Write(w, http.StatusNoContent, nil)
+}
+
+func (tr tokenRequest) validate() error {
+	if strings.TrimSpace(tr.Name) == "" {
+		return errors.New("name is required")
+	}
+	if len(tr.Scopes) == 0 {
+		return errors.New("at least one scope is required")
+	}
+	for _, scope := range tr.Scopes {
+		if !validScope(scope) {
+			return errors.New("unknown scope " + scope)
+		}
+	}
+	if tr.ExpiresIn < 0 || tr.ExpiresIn > int(MaxTokenLifetime/time.Second) {
+		return errors.New("expires_in must be between 0 and " + strconv.Itoa(int(MaxTokenLifetime.Seconds())) + " seconds (0 for the default)")
+	}
+	return nil
+}
+
+func validScope(scope string) bool {
+	for _, s := range Scopes {
+		if string(s) == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// createToken creates a token for the user and adds its hash to the
+// TokenStore. The returned token is the only copy of the token.
+func (a Auth) createToken(user User, name string, scopes []string, lifetime time.Duration) (token APIToken, err error) {
+	secret, err := newToken()
+	if err != nil {
+		return token, err
+	}
+
+	created := now()
+	token, err = a.AddToken(APIToken{
+		Name:      name,
+		Scopes:    scopes,
+		CreatedAt: created,
+		ExpiresAt: created.Add(lifetime),
+		user:      user,
+		hash:      hashToken(secret),
+	})
+	token.Token = secret
+	return token, err
+}
+
+// checkToken returns the live token named by the bearer token in the
+// Authorization header.
+func (a Auth) checkToken(r *http.Request) (token APIToken, err error) {
+	secret, ok := bearerToken(r)
+	if !ok {
+		return token, InvalidTokenErr
+	}
+
+	if token, err = a.GetToken(hashToken(secret)); err != nil {
+		return token, err
+	}
+	if !now().Before(token.ExpiresAt) {
+		return APIToken{}, ExpiredTokenErr
+	}
+	return token, nil
+}
+
+// bearerToken returns the token in an "Authorization: Bearer <token>" header.
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	const prefix = "bearer "
+	if len(header) <= len(prefix) || strings.ToLower(header[:len(prefix)]) != prefix {
+		return "", false
+	}
+	return strings.TrimSpace(header[len(prefix):]), true
+}
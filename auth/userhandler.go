@@ -0,0 +1,271 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/warrenharper/restapi/utils/response"
+	"github.com/warrenharper/restapi/utils/router"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const minPasswordLength = 8
+
+var (
+	SelfModificationErr = errors.New("You cannot disable or delete yourself")
+)
+
+// userPatch is the body of a request to modify a user. Fields that are
+// omitted are left unchanged.
+type userPatch struct {
+	Role     *Role `json:"role"`
+	Disabled *bool `json:"disabled"`
+}
+
+// passwordChange is the body of a request to change a password. OldPassword
+// is required when users change their own password.
+type passwordChange struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+// UserHandler returns a handler that lets admins create, list, modify and
+// delete users and lets users change their own passwords. It must be wrapped
+// by VerifySessions.
+func (a Auth) UserHandler() http.Handler {
+	rt := router.New()
+	rt.HandleFunc("GET", "/", a.handleListUsers)
+	rt.HandleFunc("POST", "/", a.handleCreateUser)
+	rt.Handle("GET", "/:username", router.WithParam("username", a.handleGetUser))
+	rt.Handle("PATCH", "/:username", router.WithParam("username", a.handleModifyUser))
+	rt.Handle("DELETE", "/:username", router.WithParam("username", a.handleDeleteUser))
+	rt.Handle("PUT", "/:username/password", router.WithParam("username", a.handleChangePassword))
+	return rt
+}
+
+// handleListUsers sends a list of all the users with a 200 code.
+func (a Auth) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	if !authorized(w, r, ManageUsers) {
+		return
+	}
+
+	users, err := a.ListUsers()
+	if err != nil {
+		response.ServerError(w, r)
+		return
+	}
+	response.Respond(w, r, http.StatusOK, Users{users})
+}
+
+// handleCreateUser registers the user in the request body and sends it with
+// a 201 code. If the username is taken a 409 code is sent.
+func (a Auth) handleCreateUser(w http.ResponseWriter, r *http.Request) {
+	if !authorized(w, r, ManageUsers) {
+		return
+	}
+
+	var user User
+	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+		response.MalformedBody(w, r)
+		return
+	}
+	user.Username = strings.TrimSpace(user.Username)
+	if user.Username == "" {
+		response.Error(w, r, http.StatusBadRequest, response.CodeInvalidRequest, "username is required")
+		return
+	}
+	if err := validatePassword(user.Password); err != nil {
+		response.Error(w, r, http.StatusBadRequest, response.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	err := a.RegisterUser(user)
+	switch err {
+	case nil:
+	case DuplicateUserErr:
+		response.Error(w, r, http.StatusConflict, response.CodeConflict, err.Error())
+		return
+	case InvalidRoleErr:
+		response.Error(w, r, http.StatusBadRequest, response.CodeInvalidRequest, err.Error())
+		return
+	default:
+		response.ServerError(w, r)
+		return
+	}
+
+	a.writeUser(w, r, http.StatusCreated, user.Username)
+}
+
+// handleGetUser sends the user with a 200 code. Users can get themselves and
+// admins can get anyone. If no such user exists a 404 code is sent.
+func (a Auth) handleGetUser(w http.ResponseWriter, r *http.Request, username string) {
+	if !isSelf(r, username) && !authorized(w, r, ManageUsers) {
+		return
+	}
+	a.writeUser(w, r, http.StatusOK, username)
+}
+
+// handleModifyUser changes the role of the user or disables them and sends
+// the user with a 200 code. Disabled users cannot log in and their sessions
+// and API tokens stop working.
+func (a Auth) handleModifyUser(w http.ResponseWriter, r *http.Request, username string) {
+	if !authorized(w, r, ManageUsers) {
+		return
+	}
+
+	var patch userPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		response.MalformedBody(w, r)
+		return
+	}
+	if patch.Disabled != nil && *patch.Disabled && isSelf(r, username) {
+		response.Error(w, r, http.StatusBadRequest, response.CodeInvalidRequest, SelfModificationErr.Error())
+		return
+	}
+
+	user, err := a.GetUser(username)
+	if err == UnknownUserErr {
+		response.NotFound(w, r, UnknownUserErr.Error())
+		return
+	} else if err != nil {
+		response.ServerError(w, r)
+		return
+	}
+
+	if patch.Role != nil {
+		if !patch.Role.Valid() {
+			response.Error(w, r, http.StatusBadRequest, response.CodeInvalidRequest, InvalidRoleErr.Error())
+			return
+		}
+		user.Role = *patch.Role
+	}
+	if patch.Disabled != nil {
+		user.Disabled = *patch.Disabled
+	}
+
+	if err := a.UpdateUser(user); err != nil {
+		response.ServerError(w, r)
+		return
+	}
+	a.writeUser(w, r, http.StatusOK, username)
+}
+
+// handleDeleteUser deletes the user along with their sessions and API tokens
+// and sends a 204 code. If no such user exists a 404 code is sent.
+func (a Auth) handleDeleteUser(w http.ResponseWriter, r *http.Request, username string) {
+	if !authorized(w, r, ManageUsers) {
+		return
+	}
+	if isSelf(r, username) {
+		response.Error(w, r, http.StatusBadRequest, response.CodeInvalidRequest, SelfModificationErr.Error())
+		return
+	}
+
+	err := a.DeleteUser(username)
+	if err == UnknownUserErr {
+		response.NotFound(w, r, UnknownUserErr.Error())
+		return
+	} else if err != nil {
+		response.ServerError(w, r)
+		return
+	}
+	response.Write(w, http.StatusNoContent, nil)
+}
+
+// handleChangePassword changes the user's password and sends a 204 code.
+// Users changing their own password must send their old password. Admins can
+// reset anyone else's password without it, which also logs that user out.
+func (a Auth) handleChangePassword(w http.ResponseWriter, r *http.Request, username string) {
+	self := isSelf(r, username)
+	if !self && !authorized(w, r, ManageUsers) {
+		return
+	}
+
+	var change passwordChange
+	if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+		response.MalformedBody(w, r)
+		return
+	}
+	if err := validatePassword(change.NewPassword); err != nil {
+		response.Error(w, r, http.StatusBadRequest, response.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	user, err := a.GetUser(username)
+	if err == UnknownUserErr {
+		response.NotFound(w, r, UnknownUserErr.Error())
+		return
+	} else if err != nil {
+		response.ServerError(w, r)
+		return
+	}
+
+	if self {
+		if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(change.OldPassword)) != nil {
+			Unauthorized(w, r)
+			return
+		}
+	}
+
+	if err := a.setPassword(user, change.NewPassword); err != nil {
+		response.ServerError(w, r)
+		return
+	}
+	if !self {
+		if err := a.DeleteUserSessions(user); err != nil {
+			response.ServerError(w, r)
+			return
+		}
+	}
+	response.Write(w, http.StatusNoContent, nil)
+}
+
+// setPassword hashes the password and stores it as the user's password.
+func (a Auth) setPassword(user User, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	user.Password = string(hashedPassword)
+	return a.UpdateUser(user)
+}
+
+// writeUser sends the user with the username without their password. If no
+// such user exists a 404 code is sent.
+func (a Auth) writeUser(w http.ResponseWriter, r *http.Request, code int, username string) {
+	user, err := a.GetUser(username)
+	if err == UnknownUserErr {
+		response.NotFound(w, r, UnknownUserErr.Error())
+		return
+	} else if err != nil {
+		response.ServerError(w, r)
+		return
+	}
+	user.Password = ""
+	response.Respond(w, r, code, user)
+}
+
+// authorized sends a 403 code explaining the missing permission unless the
+// request is authorized.
+func authorized(w http.ResponseWriter, r *http.Request, p Permission) bool {
+	if err := Authorize(r, p); err != nil {
+		Denied(w, r, err)
+		return false
+	}
+	return true
+}
+
+// isSelf reports whether the request was made by the user with the username.
+func isSelf(r *http.Request, username string) bool {
+	user, ok := FromContext(r.Context())
+	return ok && user.Username == username
+}
+
+func validatePassword(password string) error {
+	if len(password) < minPasswordLength {
+		return errors.New("password must be at least 8 characters")
+	}
+	return nil
+}
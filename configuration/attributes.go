@@ -0,0 +1,193 @@
+package configuration
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// Attributes are the custom fields of a configuration, such as a protocol or
+// a timeout. Which attributes are allowed is decided by the AttributeSchema
+// of the store.
+type Attributes map[string]interface{}
+
+// DefaultSchema allows any attributes. It is used until a schema is set.
+var DefaultSchema = AttributeSchema{Schema: json.RawMessage(`{"type": "object"}`)}
+
+// AttributeSchema is a JSON Schema that the attributes of every added or
+// modified configuration must satisfy.
+type AttributeSchema struct {
+	Schema    json.RawMessage `json:"schema"`
+	UpdatedBy string          `json:"updated_by,omitempty"`
+	UpdatedAt *time.Time      `json:"updated_at,omitempty"`
+}
+
+// compile returns the compiled schema or a ValidationError for the "schema"
+// field if it is not a valid JSON Schema. A schema whose "$ref"s are not
+// local, such as a URL, is invalid so that compiling it never reads files or
+// the network.
+func (as AttributeSchema) compile() (*gojsonschema.Schema, error) {
+	var document interface{}
+	if err := json.Unmarshal(as.Schema, &document); err == nil {
+		if ref, ok := remoteRef(document); ok {
+			message := fmt.Sprintf("$ref %q must refer to the schema itself and start with \"#\"", ref)
+			return nil, ValidationError{Errors: []FieldError{{Field: "schema", Message: message}}}
+		}
+	}
+
+	schema, err := gojsonschema.NewSchema(gojsonschema.NewBytesLoader(as.Schema))
+	if err != nil {
+		return nil, ValidationError{Errors: []FieldError{{Field: "schema", Message: err.Error()}}}
+	}
+	return schema, nil
+}
+
+// remoteRef returns a "$ref" in the decoded JSON that does not start
+// with "#".
+func remoteRef(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if ref, ok := v["$ref"].(string); ok && !strings.HasPrefix(ref, "#") {
+			return ref, true
+		}
+		for _, child := range v {
+			if ref, ok := remoteRef(child); ok {
+				return ref, true
+			}
+		}
+	case []interface{}:
+		for _, child := range v {
+			if ref, ok := remoteRef(child); ok {
+				return ref, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Validate returns a ValidationError for the "schema" field if the schema is
+// not a valid JSON Schema.
+func (as AttributeSchema) Validate() error {
+	_, err := as.compile()
+	return err
+}
+
+// validateAttributes returns a ValidationError listing every attribute of the
+// configuration that does not satisfy the schema.
+func validateAttributes(schema *gojsonschema.Schema, config Configuration) error {
+	attributes := config.Attributes
+	if attributes == nil {
+		attributes = Attributes{}
+	}
+
+	result, err := schema.Validate(gojsonschema.NewGoLoader(attributes))
+	if err != nil {
+		return err
+	}
+	if result.Valid() {
+		return nil
+	}
+
+	ve := ValidationError{}
+	for _, re := range result.Errors() {
+		field := "attributes"
+		if re.Field() != gojsonschema.STRING_ROOT_SCHEMA_PROPERTY {
+			field += "." + re.Field()
+		}
+		if property, ok := re.Details()["property"]; ok {
+			field += fmt.Sprintf(".%v", property)
+		}
+		ve.Errors = append(ve.Errors, FieldError{Field: field, Message: re.Description()})
+	}
+	return ve
+}
+
+// copyAttributes returns a deep copy of the attributes with their numbers
+// as float64s, as they are when read from JSON, or nil if there are none.
+func copyAttributes(a Attributes) Attributes {
+	if len(a) == 0 {
+		return nil
+	}
+	raw, err := json.Marshal(a)
+	if err != nil {
+		return a
+	}
+	var attributes Attributes
+	if err := json.Unmarshal(raw, &attributes); err != nil {
+		return a
+	}
+	return attributes
+}
+
+// marshalAttributes returns the attributes as JSON or nil if there are none.
+func marshalAttributes(a Attributes) ([]byte, error) {
+	if len(a) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(a)
+}
+
+// unmarshalAttributes returns the attributes of the JSON or nil if there are
+// none.
+func unmarshalAttributes(raw []byte) (attributes Attributes, err error) {
+	if raw == nil {
+		return nil, nil
+	}
+	if err = json.Unmarshal(raw, &attributes); err != nil || len(attributes) == 0 {
+		return nil, err
+	}
+	return attributes, nil
+}
+
+// Schema returns the schema that the attributes must satisfy. It is
+// DefaultSchema until a schema is set.
+func (cc *ConfigurationController) Schema() (schema AttributeSchema, err error) {
+	return loadSchema(cc.DB)
+}
+
+// SetSchema replaces the schema that the attributes must satisfy and
+// returns it. The configurations that are already stored are not checked
+// against it until they are modified. If the schema is not a valid JSON
+// Schema a ValidationError is returned.
+func (cc *ConfigurationController) SetSchema(schema AttributeSchema) (AttributeSchema, error) {
+	if err := schema.Validate(); err != nil {
+		return schema, err
+	}
+
+	at := now()
+	schema.UpdatedBy, schema.UpdatedAt = cc.Actor, &at
+	_, err := cc.DB.Exec(
+		`INSERT INTO attribute_schema(id, schema, updated_by, updated_at) VALUES(1, $1, $2, $3)
+         ON CONFLICT (id) DO UPDATE SET schema = EXCLUDED.schema, updated_by = EXCLUDED.updated_by, updated_at = EXCLUDED.updated_at`,
+		[]byte(schema.Schema), schema.UpdatedBy, at)
+	return schema, err
+}
+
+func loadSchema(db queryRower) (schema AttributeSchema, err error) {
+	var (
+		raw []byte
+		at  time.Time
+	)
+	err = db.QueryRow("SELECT schema, updated_by, updated_at FROM attribute_schema WHERE id = 1").Scan(&raw, &schema.UpdatedBy, &at)
+	if err == sql.ErrNoRows {
+		return DefaultSchema, nil
+	}
+	if err != nil {
+		return schema, err
+	}
+	schema.Schema, schema.UpdatedAt = json.RawMessage(raw), &at
+	return schema, nil
+}
+
+// compileSchema returns the compiled schema of the store.
+func compileSchema(db queryRower) (*gojsonschema.Schema, error) {
+	schema, err := loadSchema(db)
+	if err != nil {
+		return nil, err
+	}
+	return schema.compile()
+}
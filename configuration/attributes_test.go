@@ -0,0 +1,155 @@
+package configuration
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+var attributeSchema = AttributeSchema{Schema: json.RawMessage(`{
+  "type": "object",
+  "required": ["protocol"],
+  "additionalProperties": false,
+  "properties": {
+    "protocol": {"enum": ["ssh", "sftp"]},
+    "timeout": {"type": "integer", "minimum": 1},
+    "key_path": {"type": "string"}
+  }
+}`)}
+
+var attributeTests = map[string]storeTest{
+	"TestAttributesStored": func(cs ConfigurationStore) error {
+		expected := Attributes{"protocol": "ssh", "timeout": float64(30)}
+		if _, err := cs.Add(Configuration{Name: "web", Attributes: Attributes{"protocol": "ssh", "timeout": 30}}); err != nil {
+			return err
+		}
+		configs, err := cs.Get("web")
+		if err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(configs[0].Attributes, expected) {
+			return failure{"Wrong attributes", expected, configs[0].Attributes}
+		}
+		return nil
+	},
+
+	"TestAttributesInvalid": func(cs ConfigurationStore) error {
+		_, err := cs.Add(Configuration{Name: "web", Attributes: Attributes{"timeout": 0, "port": 22}})
+		expected := ValidationError{[]FieldError{
+			{"attributes.protocol", "protocol is required"},
+			{"attributes.port", "Additional property port is not allowed"},
+			{"attributes.timeout", "Must be greater than or equal to 1"},
+		}}
+		if !reflect.DeepEqual(err, expected) {
+			return failure{"Wrong error", expected, err}
+		}
+		if configs, _ := cs.GetAll(); len(configs) != 0 {
+			return failure{"Invalid configuration was added", 0, len(configs)}
+		}
+		return nil
+	},
+
+	"TestAttributesRequired": func(cs ConfigurationStore) error {
+		_, err := cs.Add(Configuration{Name: "web"})
+		if ve, ok := err.(ValidationError); !ok || ve.Errors[0].Field != "attributes.protocol" {
+			return failure{"Missing attributes were not rejected", "attributes.protocol", err}
+		}
+		return nil
+	},
+
+	"TestModifyKeepsAttributes": func(cs ConfigurationStore) error {
+		if _, err := cs.Add(Configuration{Name: "web", Attributes: Attributes{"protocol": "ssh"}}); err != nil {
+			return err
+		}
+		config, err := cs.Modify("web", Configuration{Port: 22})
+		if err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(config.Attributes, Attributes{"protocol": "ssh"}) {
+			return failure{"Attributes were not kept", Attributes{"protocol": "ssh"}, config.Attributes}
+		}
+		return nil
+	},
+
+	"TestModifyInvalidAttributes": func(cs ConfigurationStore) error {
+		if _, err := cs.Add(Configuration{Name: "web", Attributes: Attributes{"protocol": "ssh"}}); err != nil {
+			return err
+		}
+		_, err := cs.Modify("web", Configuration{Attributes: Attributes{"protocol": "telnet"}})
+		if ve, ok := err.(ValidationError); !ok || ve.Errors[0].Field != "attributes.protocol" {
+			return failure{"Invalid attributes were not rejected", "attributes.protocol", err}
+		}
+		configs, err := cs.Get("web")
+		if err != nil || configs[0].Version != 1 {
+			return failure{"Configuration was modified", 1, configs}
+		}
+		return nil
+	},
+
+	"TestSchemaAuthor": func(cs ConfigurationStore) error {
+		schema, err := cs.Schema()
+		if err != nil {
+			return err
+		}
+		if schema.UpdatedBy != "admin" || schema.UpdatedAt == nil {
+			return failure{"Schema author was not recorded", "admin", schema.UpdatedBy}
+		}
+		return nil
+	},
+
+	"TestInvalidSchema": func(cs ConfigurationStore) error {
+		_, err := cs.SetSchema(AttributeSchema{Schema: json.RawMessage(`{"type": "nope"}`)})
+		if ve, ok := err.(ValidationError); !ok || ve.Errors[0].Field != "schema" {
+			return failure{"Invalid schema was accepted", "schema", err}
+		}
+		if schema, _ := cs.Schema(); schema.UpdatedBy != "admin" {
+			return failure{"Invalid schema replaced the schema", "admin", schema.UpdatedBy}
+		}
+		return nil
+	},
+}
+
+func TestAttributes(t *testing.T) {
+	tests := make(map[string]storeTest, len(attributeTests))
+	for name, test := range attributeTests {
+		tests[name] = withSchema(test)
+	}
+	runStoreTests(t, tests, nil)
+}
+
+// withSchema returns the test made as admin against a store whose schema is
+// attributeSchema.
+func withSchema(test storeTest) storeTest {
+	return func(cs ConfigurationStore) error {
+		cs = cs.As("admin")
+		if _, err := cs.SetSchema(attributeSchema); err != nil {
+			return err
+		}
+		return test(cs)
+	}
+}
+
+func TestDefaultSchema(t *testing.T) {
+	cs := NewMemoryStore()
+	if _, err := cs.Add(Configuration{Name: "web", Attributes: Attributes{"anything": []interface{}{1, "two"}}}); err != nil {
+		t.Error("Failed:", failure{"Default schema rejected attributes", nil, err})
+	}
+}
+
+func TestSchemaRefs(t *testing.T) {
+	tests := map[string]struct {
+		schema string
+		valid  bool
+	}{
+		"TestLocalRef":  {`{"definitions": {"port": {"type": "integer"}}, "properties": {"port": {"$ref": "#/definitions/port"}}}`, true},
+		"TestRemoteRef": {`{"properties": {"port": {"$ref": "http://127.0.0.1:9/port.json"}}}`, false},
+		"TestFileRef":   {`{"$ref": "file:///etc/passwd"}`, false},
+		"TestNestedRef": {`{"anyOf": [{"type": "object"}, {"$ref": "other.json#/definitions/port"}]}`, false},
+	}
+	for name, test := range tests {
+		err := AttributeSchema{Schema: json.RawMessage(test.schema)}.Validate()
+		if _, invalid := err.(ValidationError); invalid == test.valid || (err == nil) != test.valid {
+			t.Errorf("%s Failed: %s", name, failure{"Wrong error", test.valid, err})
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package configuration
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+const (
+	OpCreate = "create"
+	OpUpdate = "update"
+	OpDelete = "delete"
+)
+
+var UnknownOperationErr = errors.New("Unknown operation")
+
+// Operation is a change made by Batch. A create adds the Configuration, an
+// update applies the Patch to the configuration with the Name and a delete
+// deletes the configuration with the Name. If the Version of an update or
+// delete is set it must match the version of the configuration. As with
+// Delete, a delete without a Version of a name that cannot be found
+// succeeds.
+type Operation struct {
+	Op            string
+	Name          string
+	Version       int
+	Configuration Configuration
+	Patch         Patch
+}
+
+// OperationResult is the outcome of an Operation. Configuration is the
+// configuration that was created or updated and Err is set if the operation
+// failed.
+type OperationResult struct {
+	Configuration Configuration
+	Err           error
+}
+
+// BatchError is returned by an atomic Batch when one of its operations
+// fails. Index is the position of the operation and Err its error.
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+func (be BatchError) Error() string {
+	return fmt.Sprintf("Batch Error: operation %d: %s", be.Index, be.Err.Error())
+}
+
+// Batch carries out the operations in order. If atomic is set every
+// operation is made in one transaction, so either all of them are made or,
+// if one fails, none are and a BatchError is returned. Otherwise each
+// operation is made in its own transaction and a result is returned for
+// every operation.
+func (cc *ConfigurationController) Batch(ops []Operation, atomic bool) (results []OperationResult, err error) {
+	if !atomic {
+		for _, op := range ops {
+			results = append(results, cc.batchOne(op))
+		}
+		return results, nil
+	}
+
+	tx, err := cc.DB.Begin()
+	if err != nil {
+		return results, err
+	}
+	for index, op := range ops {
+		result := cc.apply(tx, op)
+		if result.Err != nil {
+			tx.Rollback()
+			return nil, BatchError{index, result.Err}
+		}
+		results = append(results, result)
+	}
+	return results, tx.Commit()
+}
+
+// batchOne makes the operation in its own transaction.
+func (cc *ConfigurationController) batchOne(op Operation) OperationResult {
+	tx, err := cc.DB.Begin()
+	if err != nil {
+		return OperationResult{Err: err}
+	}
+	result := cc.apply(tx, op)
+	if result.Err != nil {
+		tx.Rollback()
+		return result
+	}
+	result.Err = tx.Commit()
+	return result
+}
+
+// apply makes the operation in the transaction.
+func (cc *ConfigurationController) apply(tx *sql.Tx, op Operation) (result OperationResult) {
+	switch op.Op {
+	case OpCreate:
+		schema, err := compileSchema(tx)
+		if err != nil {
+			return OperationResult{Err: err}
+		}
+		result.Configuration, result.Err = cc.add(tx, schema, op.Configuration)
+	case OpUpdate:
+		result.Configuration, result.Err = cc.modify(tx, op.Name, IfVersion(op.Version, op.Patch))
+	case OpDelete:
+		if err := cc.remove(tx, op.Name, op.Version); err != DoesNotExistErr || op.Version != 0 {
+			result.Err = err
+		}
+	default:
+		result.Err = UnknownOperationErr
+	}
+	return result
+}
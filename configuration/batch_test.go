@@ -0,0 +1,125 @@
+package configuration
+
+import (
+	"testing"
+)
+
+var batchConfigs = []Configuration{
+	{Name: "web", HostName: "web.example.com", Port: 22, Username: "deploy"},
+	{Name: "db", HostName: "db.example.com", Port: 5432, Username: "postgres"},
+}
+
+var batchOps = []Operation{
+	{Op: OpCreate, Configuration: Configuration{Name: "cache", HostName: "cache.example.com", Port: 6379, Username: "redis"}},
+	{Op: OpUpdate, Name: "web", Patch: MergePatch(`{"port": 2222}`)},
+	{Op: OpCreate, Configuration: Configuration{Name: "db", HostName: "db.example.com", Port: 5432, Username: "postgres"}},
+	{Op: OpDelete, Name: "db", Version: 1},
+}
+
+var batchTests = map[string]storeTest{
+	"TestAtomicBatch": func(cs ConfigurationStore) error {
+		results, err := cs.Batch([]Operation{batchOps[0], batchOps[1], batchOps[3]}, true)
+		if err != nil {
+			return err
+		}
+		if len(results) != 3 || results[0].Configuration.Name != "cache" || results[1].Configuration.Port != 2222 {
+			return failure{"Wrong results", 3, results}
+		}
+		configs, err := cs.GetAll()
+		if err != nil {
+			return err
+		}
+		if len(configs) != 2 {
+			return failure{"Operations were not made", 2, configs}
+		}
+		return nil
+	},
+
+	"TestAtomicBatchDeleteMissing": func(cs ConfigurationStore) error {
+		if _, err := cs.Batch([]Operation{{Op: OpDelete, Name: "missing"}, batchOps[0]}, true); err != nil {
+			return failure{"Delete of a missing name failed", nil, err}
+		}
+		if _, err := cs.Get("cache"); err != nil {
+			return failure{"Batch was not made", nil, err}
+		}
+
+		_, err := cs.Batch([]Operation{{Op: OpDelete, Name: "missing", Version: 1}}, true)
+		if be, ok := err.(BatchError); !ok || be.Err != DoesNotExistErr {
+			return failure{"Wrong error", BatchError{0, DoesNotExistErr}, err}
+		}
+		return nil
+	},
+
+	"TestAtomicBatchFails": func(cs ConfigurationStore) error {
+		before, err := cs.History("web")
+		if err != nil {
+			return err
+		}
+
+		_, err = cs.Batch(batchOps, true)
+		be, ok := err.(BatchError)
+		if !ok || be.Index != 2 {
+			return failure{"Wrong error", BatchError{Index: 2}, err}
+		}
+		if configErr, ok := be.Err.(Error); !ok || configErr.Err != DuplicateConfigErr {
+			return failure{"Wrong error", DuplicateConfigErr, be.Err}
+		}
+
+		if _, err := cs.Get("cache"); err != DoesNotExistErr {
+			return failure{"Create was not undone", DoesNotExistErr, err}
+		}
+		configs, err := cs.Get("web")
+		if err != nil {
+			return err
+		}
+		if configs[0].Port != 22 || configs[0].Version != 1 {
+			return failure{"Update was not undone", 22, configs[0].Port}
+		}
+		after, err := cs.History("web")
+		if err != nil {
+			return err
+		}
+		if len(after) != len(before) {
+			return failure{"Revisions were not undone", len(before), len(after)}
+		}
+
+		if _, err := cs.Batch([]Operation{batchOps[0]}, true); err != nil {
+			return failure{"Create was not undone", nil, err}
+		}
+		return nil
+	},
+
+	"TestBestEffortBatch": func(cs ConfigurationStore) error {
+		ops := append([]Operation{}, batchOps...)
+		ops = append(ops, Operation{Op: OpDelete, Name: "missing"}, Operation{Op: OpDelete, Name: "missing", Version: 1}, Operation{Op: OpUpdate, Name: "web", Version: 1, Patch: MergePatch(`{}`)})
+		results, err := cs.Batch(ops, false)
+		if err != nil {
+			return err
+		}
+		if len(results) != len(ops) {
+			return failure{"Wrong number of results", len(ops), len(results)}
+		}
+		for index, expected := range []error{nil, nil, DuplicateConfigErr, nil, nil, DoesNotExistErr, VersionMismatchErr} {
+			actual := results[index].Err
+			if configErr, ok := actual.(Error); ok {
+				actual = configErr.Err
+			}
+			if actual != expected {
+				return failure{"Wrong error", expected, results[index].Err}
+			}
+		}
+
+		configs, err := cs.GetAll()
+		if err != nil {
+			return err
+		}
+		if len(configs) != 2 || configs[0].Name != "web" || configs[1].Name != "cache" {
+			return failure{"Wrong configurations", []string{"web", "cache"}, configs}
+		}
+		return nil
+	},
+}
+
+func TestBatch(t *testing.T) {
+	runStoreTests(t, batchTests, batchConfigs)
+}
@@ -0,0 +1,169 @@
+package confighandler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/warrenharper/restapi/configuration"
+	"github.com/warrenharper/restapi/utils/response"
+)
+
+// MaxBatchSize is the most operations a batch request can have.
+const MaxBatchSize = 100
+
+// batchRequest is the body of a batch request. If Atomic is set either every
+// operation is made or none are.
+type batchRequest struct {
+	Atomic     bool             `json:"atomic"`
+	Operations []batchOperation `json:"operations"`
+}
+
+// batchOperation is an operation of a batch request. The patch of an update
+// is a merge patch if it is an object and a JSON patch if it is an array.
+type batchOperation struct {
+	Op            string                       `json:"op"`
+	Name          string                       `json:"name,omitempty"`
+	Version       int                          `json:"version,omitempty"`
+	Configuration *configuration.Configuration `json:"configuration,omitempty"`
+	Patch         json.RawMessage              `json:"patch,omitempty"`
+}
+
+// batchResult reports the outcome of an operation of a batch request with
+// the status code that the operation would have received on its own.
+type batchResult struct {
+	Op            string                       `json:"op"`
+	Name          string                       `json:"name,omitempty"`
+	Status        int                          `json:"status"`
+	Configuration *configuration.Configuration `json:"configuration,omitempty"`
+	Error         *response.Problem            `json:"error,omitempty"`
+}
+
+type batchResponse struct {
+	Results []batchResult `json:"results"`
+}
+
+// handleBatch creates, updates and deletes the configurations as described
+// by the operations in the body, in order. If the request is atomic and an
+// operation fails nothing is changed and the problem of the operation is
+// sent with an "index" member that is the position of the operation.
+// Otherwise every operation is tried and a 200 code is sent with a result
+// for each operation in the order of the operations. A result has the status
+// code the operation would have received on its own and, if it failed, its
+// problem. If the body is malformed a 400 code is sent and if it has no
+// operations or too many a 422 code.
+func (ch Handler) handleBatch(w http.ResponseWriter, r *http.Request) {
+	var br batchRequest
+	if err := json.NewDecoder(r.Body).Decode(&br); err != nil {
+		response.MalformedBody(w, r)
+		return
+	}
+	if len(br.Operations) == 0 || len(br.Operations) > MaxBatchSize {
+		message := fmt.Sprintf("operations must have between 1 and %d operations", MaxBatchSize)
+		UnprocessableEntity(w, r, configuration.ValidationError{Errors: []configuration.FieldError{{Field: "operations", Message: message}}})
+		return
+	}
+
+	results := make([]batchResult, len(br.Operations))
+	ops := make([]configuration.Operation, 0, len(br.Operations))
+	indexes := make([]int, 0, len(br.Operations))
+	for index, bo := range br.Operations {
+		op, err := bo.operation()
+		results[index] = batchResult{Op: bo.Op, Name: op.Name}
+		if err != nil && br.Atomic {
+			response.WriteProblem(w, r, problemFor(err).With("index", index))
+			return
+		}
+		if err != nil {
+			results[index].fail(err)
+			continue
+		}
+		ops = append(ops, op)
+		indexes = append(indexes, index)
+	}
+
+	opResults, err := ch.store(r).Batch(ops, br.Atomic)
+	if be, ok := err.(configuration.BatchError); ok {
+		response.WriteProblem(w, r, problemFor(opError(ops[be.Index], be.Err)).With("index", indexes[be.Index]))
+		return
+	}
+	if err != nil {
+		response.ServerError(w, r)
+		return
+	}
+
+	for i, opResult := range opResults {
+		result := &results[indexes[i]]
+		switch {
+		case opResult.Err != nil:
+			result.fail(opError(ops[i], opResult.Err))
+		case result.Op == configuration.OpCreate:
+			result.Status, result.Configuration = http.StatusCreated, &opResults[i].Configuration
+		case result.Op == configuration.OpUpdate:
+			result.Status, result.Configuration = http.StatusOK, &opResults[i].Configuration
+		default:
+			result.Status = http.StatusNoContent
+		}
+	}
+	response.Respond(w, r, http.StatusOK, batchResponse{results})
+}
+
+// opError returns the error of the operation as the operation would have
+// received it on its own. A delete with a version stands for a DELETE with an
+// If-Match header, so if its name cannot be found its precondition fails.
+func opError(op configuration.Operation, err error) error {
+	if op.Op == configuration.OpDelete && err == configuration.DoesNotExistErr {
+		return configuration.VersionMismatchErr
+	}
+	return err
+}
+
+// fail records the problem of the error in the result.
+func (br *batchResult) fail(err error) {
+	p := problemFor(err)
+	br.Status, br.Error = p.Status, &p
+}
+
+// operation returns the store operation of the batch operation or a
+// ValidationError if the operation is malformed. The configuration of a
+// create must be valid.
+func (bo batchOperation) operation() (op configuration.Operation, err error) {
+	op = configuration.Operation{Op: bo.Op, Name: bo.Name, Version: bo.Version}
+	invalid := func(field, message string) error {
+		return configuration.ValidationError{Errors: []configuration.FieldError{{Field: field, Message: message}}}
+	}
+
+	switch bo.Op {
+	case configuration.OpCreate:
+		if bo.Configuration == nil {
+			return op, invalid("configuration", "configuration is required")
+		}
+		op.Configuration, op.Name = *bo.Configuration, bo.Configuration.Name
+		return op, op.Configuration.Validate()
+	case configuration.OpUpdate:
+		if op.Name == "" {
+			return op, invalid("name", "name is required")
+		}
+		raw := bytes.TrimSpace(bo.Patch)
+		switch {
+		case len(raw) > 0 && raw[0] == '{':
+			op.Patch = configuration.MergePatch(raw)
+		case len(raw) > 0 && raw[0] == '[':
+			var patch configuration.JSONPatch
+			if err = json.Unmarshal(raw, &patch); err != nil {
+				return op, invalid("patch", "patch must be an array of operations")
+			}
+			op.Patch = patch
+		default:
+			return op, invalid("patch", "patch must be a merge patch object or a JSON patch array")
+		}
+		return op, nil
+	case configuration.OpDelete:
+		if op.Name == "" {
+			return op, invalid("name", "name is required")
+		}
+		return op, nil
+	}
+	return op, invalid("op", "op must be create, update or delete")
+}
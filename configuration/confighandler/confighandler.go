@@ -1,182 +1,301 @@
 package confighandler
 
 import (
-	"encoding/json"
-	"fmt"
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 
+	"github.com/warrenharper/restapi/auth"
 	"github.com/warrenharper/restapi/configuration"
-	"github.com/warrenharper/restapi/configuration/configsort"
-	"github.com/warrenharper/restapi/utils/request"
 	"github.com/warrenharper/restapi/utils/response"
+	"github.com/warrenharper/restapi/utils/router"
 )
 
+// Handler serves the configurations that are kept in its ConfigurationStore.
+// It must be made with New and wrapped by auth.VerifySessions so that it can
+// authorize requests. Its paths are relative to where it is mounted, such as
+// /configurations.
 type Handler struct {
-	configuration.ConfigurationController
+	configuration.ConfigurationStore
+	router *router.Router
+}
+
+// New returns a Handler of the configurations in the store.
+func New(store configuration.ConfigurationStore) Handler {
+	ch := Handler{ConfigurationStore: store}
+	ch.router = ch.routes()
+	return ch
 }
 
 func (ch Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	path := r.URL.Path
-	variables := request.GetURLVariables(path)
-	switch {
-	case request.Is(r, "GET") && path == "/":
-		ch.handleGetAll(w, r)
-	case request.Is(r, "GET") && len(variables) == 1:
-		ch.handleGet(w, r, variables[0])
-	case request.Is(r, "POST") && path == "/":
-		ch.handleAdd(w, r)
-	case request.Is(r, "DELETE") && len(variables) == 1:
-		ch.handleDelete(w, r, variables[0])
-	case request.Is(r, "PATCH") && len(variables) == 1:
-		ch.handleModify(w, r, variables[0])
-	default:
-		http.Error(w, "", http.StatusNotImplemented)
+	ch.router.ServeHTTP(w, r)
+}
 
-	}
+// routes returns the router of the handler. Reading configurations needs
+// auth.ReadConfigurations, changing the schema of their attributes needs
+// auth.ManageSchema and every other route needs auth.WriteConfigurations.
+func (ch Handler) routes() *router.Router {
+	rt := router.New()
+	rt.Handle("GET", "/", authorized(auth.ReadConfigurations, http.HandlerFunc(ch.handleGetAll)))
+	rt.Handle("POST", "/", authorized(auth.WriteConfigurations, http.HandlerFunc(ch.handleAdd)))
+	rt.Handle("GET", "/search", authorized(auth.ReadConfigurations, http.HandlerFunc(ch.handleSearch)))
+	rt.Handle("POST", "/lookup", authorized(auth.ReadConfigurations, http.HandlerFunc(ch.handleLookup)))
+	rt.Handle("GET", "/ssh_config", authorized(auth.ReadConfigurations, http.HandlerFunc(ch.handleSSHConfig)))
+	rt.Handle("GET", "/export", authorized(auth.ReadConfigurations, http.HandlerFunc(ch.handleExport)))
+	rt.Handle("POST", "/import", authorized(auth.WriteConfigurations, http.HandlerFunc(ch.handleImport)))
+	rt.Handle("POST", "/batch", authorized(auth.WriteConfigurations, http.HandlerFunc(ch.handleBatch)))
+	rt.Handle("GET", "/schema", authorized(auth.ReadConfigurations, http.HandlerFunc(ch.handleGetSchema)))
+	rt.Handle("PUT", "/schema", authorized(auth.ManageSchema, http.HandlerFunc(ch.handleSetSchema)))
+	rt.Handle("GET", "/:name", authorized(auth.ReadConfigurations, router.WithParam("name", ch.handleGet)))
+	rt.Handle("PUT", "/:name", authorized(auth.WriteConfigurations, router.WithParam("name", ch.handleReplace)))
+	rt.Handle("PATCH", "/:name", authorized(auth.WriteConfigurations, router.WithParam("name", ch.handleModify)))
+	rt.Handle("DELETE", "/:name", authorized(auth.WriteConfigurations, router.WithParam("name", ch.handleDelete)))
+	rt.Handle("GET", "/:name/history", authorized(auth.ReadConfigurations, router.WithParam("name", ch.handleHistory)))
+	rt.Handle("POST", "/:name/rollback", authorized(auth.WriteConfigurations, router.WithParam("name", ch.handleRollback)))
+	return rt
+}
+
+// authorized returns a handler that only calls h if the user that made the
+// request has the permission.
+func authorized(p auth.Permission, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := auth.Authorize(r, p); err != nil {
+			auth.Denied(w, r, err)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
 
+// store returns the ConfigurationStore that records the user that made the
+// request as the author of its revisions.
+func (ch Handler) store(r *http.Request) configuration.ConfigurationStore {
+	user, _ := auth.FromContext(r.Context())
+	return ch.As(user.Username)
 }
 
-// handleGetAll sends a list of all the configurations with a 200 code
+// handleGetAll sends a list of the configurations that match the parameters
+// of the request with a 200 code. The number of matching configurations is
+// sent in the X-Total-Count header and pages selected by cursor link to the
+// pages around them in the Link header. If the "name=" filter lists names
+// the names that no configuration has are sent in the "missing" member. If
+// the parameters are malformed sends a 400 code.
 func (ch Handler) handleGetAll(w http.ResponseWriter, r *http.Request) {
-	configs, err := ch.GetAll()
+	opts, limit, err := queryOptions(r)
 	if err != nil {
-		response.ServerError(w)
+		BadParameter(w, r, err)
 		return
 	}
 
-	configs, err = handleParameters(w, r, configs)
+	total, err := ch.Count(opts)
 	if err != nil {
-		http.Error(w, "Bad Query String", http.StatusBadRequest)
+		response.ServerError(w, r)
+		return
+	}
+
+	configs, err := ch.List(opts)
+	if err != nil {
+		response.ServerError(w, r)
+		return
+	}
+	if limit > 0 {
+		configs = paginate(w, r, opts, configs, limit)
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	if names := requestedNames(opts); len(names) > 0 {
+		_, missing, err := ch.lookup(names)
+		if err != nil {
+			response.ServerError(w, r)
+			return
+		}
+		response.Respond(w, r, http.StatusOK, lookupResult{configs, missing})
+		return
 	}
+	response.Respond(w, r, http.StatusOK, configuration.Configurations{configs})
+}
 
-	response.WriteJson(w, http.StatusOK, configuration.Configurations{configs})
+// handleSearch sends the configurations that match the "q" parameter, best
+// matches first unless the request sorts them, with a 200 code. It accepts
+// the same parameters as handleGetAll. If the "q" parameter is missing sends
+// a 400 code.
+func (ch Handler) handleSearch(w http.ResponseWriter, r *http.Request) {
+	if strings.TrimSpace(r.URL.Query().Get("q")) == "" {
+		BadParameter(w, r, ParameterError{"q", errors.New("a search is required")})
+		return
+	}
+	ch.handleGetAll(w, r)
 }
 
 // handleGet sends a list of configurations containing only one configuration
-// whose name matches the name specified in the url with a 200 code. If no such
-// configuration can be found sends a 404 code.
+// whose name matches the name specified in the url with a 200 code and the
+// configuration's ETag. If no such configuration can be found sends a 404
+// code. If the ETag matches the If-None-Match header sends a 304 code.
 func (ch Handler) handleGet(w http.ResponseWriter, r *http.Request, configName string) {
+	if r.FormValue("revision") != "" || r.FormValue("at") != "" {
+		ch.handleGetRevision(w, r, configName)
+		return
+	}
+
 	configs, err := ch.Get(configName)
 	if err == configuration.DoesNotExistErr {
-		http.Error(w, "", http.StatusNotFound)
+		response.NotFound(w, r, configuration.DoesNotExistErr.Error())
 		return
 	}
 	if err != nil {
-		response.ServerError(w)
+		response.ServerError(w, r)
 		return
 	}
 
-	response.WriteJson(w, http.StatusOK, configuration.Configurations{configs})
+	tag := etag(r, configuration.Configurations{configs}.GetFirst())
+	w.Header().Set("ETag", tag)
+	if header := r.Header.Get("If-None-Match"); header != "" && matchesETag(header, true, func(candidate string) bool { return candidate == tag }) {
+		w.Header().Add("Vary", "Accept")
+		response.Write(w, http.StatusNotModified, nil)
+		return
+	}
+	response.Respond(w, r, http.StatusOK, configuration.Configurations{configs})
 }
 
 // handleAdd parses the json in the request body and creates a configuration with the fields
-// indicated in the json. If successful it sends a 200 code. If two configurations
-//have the same name then it sends a 409 code with the configuration in the body of
-// the response.
+// indicated in the json. The body may also be YAML or MessagePack, see
+// decodeBody. If successful it sends a 200 code. If two configurations
+// have the same name then it sends a 409 code with the configuration in the body of
+// the response. If a field is missing or malformed or the attributes do not
+// satisfy the schema it sends a 422 code listing the invalid fields.
 func (ch Handler) handleAdd(w http.ResponseWriter, r *http.Request) {
 	config := configuration.Configuration{}
-	err := json.NewDecoder(r.Body).Decode(&config)
-	if err != nil {
-		http.Error(w, "Bad Format", http.StatusBadRequest)
+	if !decodeBody(w, r, &config) {
+		return
+	}
+	if err := config.Validate(); err != nil {
+		UnprocessableEntity(w, r, err.(configuration.ValidationError))
 		return
 	}
 
-	configs, err := ch.Add(config)
+	configs, err := ch.store(r).Add(config)
 	if configErr, ok := err.(configuration.Error); ok && configErr.Err == configuration.DuplicateConfigErr {
-		response.WriteJson(w, http.StatusConflict, configuration.Configurations{[]configuration.Configuration{configErr.Configuration}})
+		Conflict(w, r, configErr.Configuration)
+		return
+	}
+	if ve, ok := err.(configuration.ValidationError); ok {
+		UnprocessableEntity(w, r, ve)
 		return
 	}
 
 	if err != nil {
-		response.ServerError(w)
+		response.ServerError(w, r)
+		return
 	}
 
-	response.WriteJson(w, http.StatusOK, configuration.Configurations{configs})
+	response.Respond(w, r, http.StatusOK, configuration.Configurations{configs})
 
 }
 
 // handleDelete deletes the configuration whose name matches the name specified
 // in the url. If no such configuration exists do nothing.
-// Always sends a 204 code.
+// Sends a 204 code unless the configuration does not match the If-Match header
+// in which case it sends a 412 code.
 func (ch Handler) handleDelete(w http.ResponseWriter, r *http.Request, configName string) {
-	if err := ch.Delete(configName); err != nil {
-		response.ServerError(w)
+	version, ok := ch.ifMatch(w, r, configName)
+	if !ok {
+		return
+	}
+
+	var err error
+	if version != 0 {
+		err = ch.store(r).DeleteVersion(configName, version)
+	} else {
+		err = ch.store(r).Delete(configName)
+	}
+
+	if err == configuration.VersionMismatchErr || err == configuration.DoesNotExistErr {
+		PreconditionFailed(w, r)
+		return
+	} else if err != nil {
+		response.ServerError(w, r)
 		return
 	}
 	response.Write(w, http.StatusNoContent, nil)
 }
 
-// handleModify modifies the configuration whose name matches the name specified
-// in the url. If no such configuration exists sends a 404 code. If the modification
-// would cause two configurations to have the same name then sends a 409 code with
-// the configuration in the body of the response. If successful sends a 200 code/
+// handleModify applies the patch in the body to the configuration whose name
+// matches the name specified in the url. The Content-Type of the request
+// decides how the body is read, see decodePatch. If no such configuration
+// exists sends a 404 code. If the modification would cause two
+// configurations to have the same name then sends a 409 code with the
+// configuration in the body of the response. If the configuration does not
+// match the If-Match header or the version in the body sends a 412 code.
+// If a field that the patch changes is malformed, including a port of 0, or
+// the attributes do not satisfy the schema sends a 422 code listing the
+// invalid fields. If successful sends a 200 code with the configuration's new
+// ETag.
 func (ch Handler) handleModify(w http.ResponseWriter, r *http.Request, configName string) {
-	config := configuration.Configuration{}
-	err := json.NewDecoder(r.Body).Decode(&config)
-	if err != nil {
-		http.Error(w, "Bad Format", http.StatusBadRequest)
+	patch, ok := decodePatch(w, r)
+	if !ok {
 		return
 	}
 
-	config, err = ch.Modify(configName, config)
-
-	if err == configuration.DoesNotExistErr {
-		http.Error(w, "", http.StatusNotFound)
-		return
-	} else if confErr, ok := err.(configuration.Error); ok && confErr.Err == configuration.DuplicateConfigErr {
-		response.WriteJson(w, http.StatusConflict, configuration.Configurations{[]configuration.Configuration{confErr.Configuration}})
-		return
-	} else if err != nil {
-		response.ServerError(w)
+	version, ok := ch.ifMatch(w, r, configName)
+	if !ok {
 		return
 	}
 
-	response.WriteJson(w, http.StatusOK, configuration.Configurations{[]configuration.Configuration{config}})
+	config, err := ch.store(r).Modify(configName, configuration.IfVersion(version, patch))
+	ch.writeModified(w, r, config, err)
 }
 
-// handleParameters loops through the parameters of request and performs actions
-// based on their values.
-func handleParameters(w http.ResponseWriter, r *http.Request, configs []configuration.Configuration) ([]configuration.Configuration, error) {
-	configs = handleSortParameters(r, configs)
-	return handlePaginateParameters(r, configs)
+// handleReplace replaces the configuration whose name matches the name
+// specified in the url with the configuration in the body, which is read by
+// decodeBody. Fields that the
+// body leaves out are cleared and the name defaults to the name in the url.
+// If successful sends a 200 code with the configuration's new ETag. If no
+// such configuration exists it is created and sent with a 201 code, unless
+// the request has an If-Match header in which case a 412 code is sent. The
+// other codes are those of handleModify.
+func (ch Handler) handleReplace(w http.ResponseWriter, r *http.Request, configName string) {
+	config := configuration.Configuration{}
+	if !decodeBody(w, r, &config) {
+		return
+	}
+	if config.Name == "" {
+		config.Name = configName
+	}
+	if err := config.Validate(); err != nil {
+		UnprocessableEntity(w, r, err.(configuration.ValidationError))
+		return
+	}
 
-}
+	version, ok := ch.ifMatch(w, r, configName)
+	if !ok {
+		return
+	}
 
-func handleSortParameters(r *http.Request, configs []configuration.Configuration) (sortedConfigs []configuration.Configuration) {
-	sortBy := r.FormValue("sort")
-	sorter := &configsort.Sorter{}
-	var orderer configsort.Orderer
-	switch sortBy {
-	case "name":
-		orderer = sorter.ByName
-	case "hostname":
-		orderer = sorter.ByHostName
-	case "port":
-		orderer = sorter.ByPort
-	case "username":
-		orderer = sorter.ByUsername
+	replaced, err := ch.store(r).Modify(configName, configuration.IfVersion(version, configuration.Replacement(config)))
+	if err != configuration.DoesNotExistErr {
+		ch.writeModified(w, r, replaced, err)
+		return
 	}
 
-	if orderer != nil {
-		configs = sorter.Sort(orderer, configs)
+	config.Version = 0
+	configs, err := ch.store(r).Add(config)
+	if err != nil {
+		response.WriteProblem(w, r, problemFor(err))
+		return
 	}
 
-	return configs
+	w.Header().Set("ETag", etag(r, configs[0]))
+	response.Respond(w, r, http.StatusCreated, configuration.Configurations{configs})
 }
 
-func handlePaginateParameters(r *http.Request, configs []configuration.Configuration) (page []configuration.Configuration, err error) {
-	pageNum, pnErr := strconv.Atoi(r.FormValue("page"))
-	perPage, ppErr := strconv.Atoi(r.FormValue("per_page"))
-
-	switch {
-	case (pnErr != nil && ppErr == nil) || (pnErr == nil && ppErr != nil):
-		return configs, fmt.Errorf("Bad page parameters")
-	case (pnErr == nil && ppErr == nil) && perPage < 100:
-		return configuration.GetPage(configs, pageNum, perPage), nil
-	case perPage > 100:
-		return configs, fmt.Errorf("Pagination format error")
-	default:
-		return configs, nil
+// writeModified sends the configuration that Modify returned with a 200 code
+// and its ETag, or the problem that matches the error of Modify.
+func (ch Handler) writeModified(w http.ResponseWriter, r *http.Request, config configuration.Configuration, err error) {
+	if err != nil {
+		response.WriteProblem(w, r, problemFor(err))
+		return
 	}
+	w.Header().Set("ETag", etag(r, config))
+	response.Respond(w, r, http.StatusOK, configuration.Configurations{[]configuration.Configuration{config}})
 }
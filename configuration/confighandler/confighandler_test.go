@@ -0,0 +1,1113 @@
+package confighandler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/warrenharper/restapi/auth"
+	"github.com/warrenharper/restapi/configuration"
+	"github.com/warrenharper/restapi/utils/request"
+	"github.com/warrenharper/restapi/utils/response"
+)
+
+type failure struct {
+	Prefix   string
+	Expected interface{}
+	Actual   interface{}
+}
+
+func (f failure) Error() string {
+	str := f.Prefix
+	if f.Expected != nil {
+		str += fmt.Sprintf("\n Expected: %v", f.Expected)
+	}
+
+	if f.Actual != nil {
+		str += fmt.Sprintf("\n Actual: %v", f.Actual)
+	}
+
+	return str
+}
+
+var baseConfigs = []configuration.Configuration{
+	{Name: "Config1", HostName: "Config.1", Port: 1, Username: "user1"},
+	{Name: "Config2", HostName: "Config.2", Port: 2, Username: "user2"},
+}
+
+// server is a Handler wrapped by auth.VerifySessions whose stores are kept in
+// memory. Users named after the roles are registered.
+type server struct {
+	http.Handler
+	auth    auth.Auth
+	store   configuration.ConfigurationStore
+	cookies map[string]string
+}
+
+func newServer(configs ...configuration.Configuration) server {
+	authStore := auth.NewMemoryStore()
+	s := server{
+		auth:    auth.Auth{UserStore: authStore, SessionStore: authStore, TokenStore: authStore},
+		store:   configuration.NewMemoryStore(),
+		cookies: make(map[string]string),
+	}
+	s.store.Add(configs...)
+	s.Handler = s.auth.VerifySessions(New(s.store))
+
+	for _, role := range []auth.Role{auth.RoleViewer, auth.RoleEditor, auth.RoleAdmin} {
+		user := auth.User{Username: string(role), Password: "password", Role: role}
+		s.auth.RegisterUser(user)
+		body, _ := json.Marshal(user)
+		r := httptest.NewRecorder()
+		s.auth.HandleLogin(r, httptest.NewRequest("POST", "/login", bytes.NewReader(body)))
+		s.cookies[string(role)] = r.Header().Get("Set-Cookie")
+	}
+	return s
+}
+
+// do sends a request as the user and returns the response.
+func (s server) do(user, method, url string, body io.Reader) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, body)
+	req.Header.Set("Cookie", s.cookies[user])
+	r := httptest.NewRecorder()
+	s.ServeHTTP(r, req)
+	return r
+}
+
+var permissionTests = map[string]struct {
+	user     string
+	method   string
+	url      string
+	body     string
+	expected int
+}{
+	"TestViewerGetAll":  {"viewer", "GET", "/", "", http.StatusOK},
+	"TestViewerGet":     {"viewer", "GET", "/Config1", "", http.StatusOK},
+	"TestViewerAdd":     {"viewer", "POST", "/", `{"name": "New", "hostname": "new.host", "port": 22, "username": "new"}`, http.StatusForbidden},
+	"TestViewerDelete":  {"viewer", "DELETE", "/Config1", "", http.StatusForbidden},
+	"TestViewerModify":  {"viewer", "PATCH", "/Config1", `{"port": 22}`, http.StatusForbidden},
+	"TestEditorAdd":     {"editor", "POST", "/", `{"name": "New", "hostname": "new.host", "port": 22, "username": "new"}`, http.StatusOK},
+	"TestEditorDelete":  {"editor", "DELETE", "/Config1", "", http.StatusNoContent},
+	"TestAdminModify":   {"admin", "PATCH", "/Config1", `{"port": 22}`, http.StatusOK},
+	"TestAnonymousRead": {"nobody", "GET", "/", "", http.StatusForbidden},
+}
+
+func TestPermissions(t *testing.T) {
+	for testName, test := range permissionTests {
+		s := newServer(baseConfigs...)
+		r := s.do(test.user, test.method, test.url, strings.NewReader(test.body))
+		if r.Code != test.expected {
+			t.Error("Failed:", testName, failure{"", test.expected, r.Code})
+		}
+		if r.Code == http.StatusForbidden && test.user != "nobody" && !strings.Contains(r.Body.String(), string(auth.WriteConfigurations)) {
+			t.Error("Failed:", testName, failure{"Missing permission not explained", auth.WriteConfigurations, r.Body.String()})
+		}
+	}
+}
+
+var routeTests = map[string]struct {
+	user     string
+	method   string
+	url      string
+	expected int
+	allow    string
+}{
+	"TestRouteTrailingSlash": {"viewer", "GET", "/Config1/", http.StatusOK, ""},
+	"TestRouteHead":          {"viewer", "HEAD", "/Config1", http.StatusOK, ""},
+	"TestRouteOptions":       {"viewer", "OPTIONS", "/Config1", http.StatusNoContent, "DELETE, GET, HEAD, OPTIONS, PATCH, PUT"},
+	"TestRouteNotAllowed":    {"editor", "POST", "/Config1", http.StatusMethodNotAllowed, "DELETE, GET, HEAD, OPTIONS, PATCH, PUT"},
+	"TestRouteRollback":      {"editor", "GET", "/Config1/rollback", http.StatusMethodNotAllowed, "OPTIONS, POST"},
+	"TestRouteUnknown":       {"viewer", "GET", "/Config1/unknown", http.StatusNotFound, ""},
+	"TestRouteAnonymous":     {"nobody", "OPTIONS", "/Config1", http.StatusForbidden, ""},
+}
+
+func TestRoutes(t *testing.T) {
+	s := newServer(baseConfigs...)
+	for testName, test := range routeTests {
+		r := s.do(test.user, test.method, test.url, nil)
+		if r.Code != test.expected {
+			t.Error("Failed:", testName, failure{r.Body.String(), test.expected, r.Code})
+		}
+		if allow := r.Header().Get("Allow"); allow != test.allow {
+			t.Error("Failed:", testName, failure{"Wrong Allow header", test.allow, allow})
+		}
+	}
+}
+
+var historyTests = map[string]struct {
+	method   string
+	url      string
+	body     string
+	expected int
+	contains string
+}{
+	"TestHistory":               {"GET", "/Config1/history", "", http.StatusOK, `"actor":"editor"`},
+	"TestHistoryUnknown":        {"GET", "/Unknown/history", "", http.StatusNotFound, ""},
+	"TestGetRevision":           {"GET", "/Config1?revision=1", "", http.StatusOK, `"port":1,`},
+	"TestGetBadRevision":        {"GET", "/Config1?revision=one", "", http.StatusBadRequest, ""},
+	"TestGetUnknownRevision":    {"GET", "/Config1?revision=100", "", http.StatusNotFound, ""},
+	"TestGetAt":                 {"GET", "/Config1?at=2999-01-01T00:00:00Z", "", http.StatusOK, `"port":22,`},
+	"TestGetBadAt":              {"GET", "/Config1?at=yesterday", "", http.StatusBadRequest, ""},
+	"TestGetBeforeAdd":          {"GET", "/Config1?at=2000-01-01T00:00:00Z", "", http.StatusNotFound, ""},
+	"TestRollback":              {"POST", "/Config1/rollback", `{"revision": 1}`, http.StatusOK, `"port":1,`},
+	"TestRollbackUnknown":       {"POST", "/Config1/rollback", `{"revision": 100}`, http.StatusNotFound, ""},
+	"TestRollbackBadFormat":     {"POST", "/Config1/rollback", `{"revision": "one"}`, http.StatusBadRequest, ""},
+	"TestRollbackDeleted":       {"POST", "/Config2/rollback", `{"revision": 2}`, http.StatusOK, `"name":"Config2"`},
+	"TestRollbackUnknownConfig": {"POST", "/Unknown/rollback", `{"revision": 1}`, http.StatusNotFound, ""},
+}
+
+func TestHistory(t *testing.T) {
+	for testName, test := range historyTests {
+		s := newServer(baseConfigs...)
+		s.do("editor", "PATCH", "/Config1", strings.NewReader(`{"port": 22}`))
+		s.do("editor", "DELETE", "/Config2", nil)
+
+		r := s.do("editor", test.method, test.url, strings.NewReader(test.body))
+		if r.Code != test.expected {
+			t.Error("Failed:", testName, failure{"", test.expected, r.Code})
+		}
+		if !strings.Contains(r.Body.String(), test.contains) {
+			t.Error("Failed:", testName, failure{"Wrong body", test.contains, r.Body.String()})
+		}
+	}
+}
+
+var etagTests = map[string]struct {
+	method   string
+	url      string
+	header   string
+	value    string
+	accept   string
+	expected int
+	etag     string
+}{
+	"TestGetETag":                        {"GET", "/Config1", "", "", "", http.StatusOK, `"1-1"`},
+	"TestGetETagYAML":                    {"GET", "/Config1", "", "", "application/yaml", http.StatusOK, `"1-1-yaml"`},
+	"TestGetETagPretty":                  {"GET", "/Config1?pretty", "", "", "", http.StatusOK, `"1-1-pretty"`},
+	"TestIfNoneMatch":                    {"GET", "/Config1", "If-None-Match", `"1-1"`, "", http.StatusNotModified, `"1-1"`},
+	"TestIfNoneMatchWeak":                {"GET", "/Config1", "If-None-Match", `W/"1-1"`, "", http.StatusNotModified, `"1-1"`},
+	"TestIfNoneMatchStale":               {"GET", "/Config1", "If-None-Match", `"1-0"`, "", http.StatusOK, `"1-1"`},
+	"TestIfNoneMatchOtherRepresentation": {"GET", "/Config1", "If-None-Match", `"1-1-yaml"`, "", http.StatusOK, `"1-1"`},
+	"TestIfNoneMatchYAML":                {"GET", "/Config1", "If-None-Match", `"1-1-yaml"`, "application/yaml", http.StatusNotModified, `"1-1-yaml"`},
+	"TestModifyIfMatch":                  {"PATCH", "/Config1", "If-Match", `"1-1"`, "", http.StatusOK, `"1-2"`},
+	"TestModifyIfMatchList":              {"PATCH", "/Config1", "If-Match", `"1-5", "1-1"`, "", http.StatusOK, `"1-2"`},
+	"TestModifyIfMatchAny":               {"PATCH", "/Config1", "If-Match", "*", "", http.StatusOK, `"1-2"`},
+	"TestModifyIfMatchRepresentation":    {"PATCH", "/Config1", "If-Match", `"1-1-msgpack"`, "application/yaml", http.StatusOK, `"1-2-yaml"`},
+	"TestModifyIfMatchStale":             {"PATCH", "/Config1", "If-Match", `"1-2"`, "", http.StatusPreconditionFailed, ""},
+	"TestModifyIfMatchOtherID":           {"PATCH", "/Config1", "If-Match", `"2-1"`, "", http.StatusPreconditionFailed, ""},
+	"TestModifyIfMatchVersion":           {"PATCH", "/Config1", "If-Match", `"1"`, "", http.StatusPreconditionFailed, ""},
+	"TestModifyIfMatchWeak":              {"PATCH", "/Config1", "If-Match", `W/"1-1"`, "", http.StatusPreconditionFailed, ""},
+	"TestModifyIfMatchGone":              {"PATCH", "/Unknown", "If-Match", "*", "", http.StatusPreconditionFailed, ""},
+	"TestDeleteIfMatch":                  {"DELETE", "/Config1", "If-Match", `"1-1"`, "", http.StatusNoContent, ""},
+	"TestDeleteIfMatchStale":             {"DELETE", "/Config1", "If-Match", `"1-2"`, "", http.StatusPreconditionFailed, ""},
+	"TestDeleteIfMatchGone":              {"DELETE", "/Unknown", "If-Match", `"1-1"`, "", http.StatusPreconditionFailed, ""},
+}
+
+func TestETags(t *testing.T) {
+	for testName, test := range etagTests {
+		s := newServer(baseConfigs...)
+		req := httptest.NewRequest(test.method, test.url, strings.NewReader(`{"port": 22}`))
+		req.Header.Set("Cookie", s.cookies["editor"])
+		req.Header.Set("Accept", test.accept)
+		if test.header != "" {
+			req.Header.Set(test.header, test.value)
+		}
+		r := httptest.NewRecorder()
+		s.ServeHTTP(r, req)
+
+		if r.Code != test.expected {
+			t.Error("Failed:", testName, failure{"", test.expected, r.Code})
+		}
+		if test.etag != "" && r.Header().Get("ETag") != test.etag {
+			t.Error("Failed:", testName, failure{"Wrong ETag", test.etag, r.Header().Get("ETag")})
+		}
+	}
+}
+
+func TestETagRecreated(t *testing.T) {
+	s := newServer(baseConfigs...)
+	tag := s.do("editor", "GET", "/Config1", nil).Header().Get("ETag")
+	s.do("editor", "DELETE", "/Config1", nil)
+	s.do("editor", "POST", "/", strings.NewReader(`{"name": "Config1", "hostname": "new.host", "port": 22, "username": "new"}`))
+
+	req := httptest.NewRequest("PATCH", "/Config1", strings.NewReader(`{"port": 23}`))
+	req.Header.Set("Cookie", s.cookies["editor"])
+	req.Header.Set("If-Match", tag)
+	r := httptest.NewRecorder()
+	s.ServeHTTP(r, req)
+	if r.Code != http.StatusPreconditionFailed {
+		t.Error("Failed:", failure{"Stale ETag matched a new configuration", http.StatusPreconditionFailed, r.Code})
+	}
+}
+
+var listTests = map[string]struct {
+	url      string
+	expected int
+	names    []string
+}{
+	"TestList":               {"/", http.StatusOK, []string{"Config1", "Config2"}},
+	"TestListSort":           {"/?sort=port", http.StatusOK, []string{"Config1", "Config2"}},
+	"TestListFilter":         {"/?username=user2", http.StatusOK, []string{"Config2"}},
+	"TestListPage":           {"/?page=1&per_page=1", http.StatusOK, []string{"Config2"}},
+	"TestListLastPage":       {"/?page=0&per_page=100", http.StatusOK, []string{"Config1", "Config2"}},
+	"TestListBadSort":        {"/?sort=password", http.StatusBadRequest, nil},
+	"TestListBadFilter":      {"/?port=ssh", http.StatusBadRequest, nil},
+	"TestListHalfPage":       {"/?page=1", http.StatusBadRequest, nil},
+	"TestListNegativePage":   {"/?page=-1&per_page=1", http.StatusBadRequest, nil},
+	"TestListLargePage":      {"/?page=0&per_page=101", http.StatusBadRequest, nil},
+	"TestListPageOverflow":   {"/?page=92233720368547759&per_page=100", http.StatusBadRequest, nil},
+	"TestListRange":          {"/?port>=2", http.StatusOK, []string{"Config2"}},
+	"TestListFilterOverflow": {"/?port>=2147483648", http.StatusBadRequest, nil},
+	"TestListIDOverflow":     {"/?id=1,99999999999", http.StatusBadRequest, nil},
+	"TestListEncodedRange":   {"/?port%3E%3D2", http.StatusOK, []string{"Config2"}},
+	"TestListNotEqual":       {"/?name!=Config1", http.StatusOK, []string{"Config2"}},
+	"TestListGlob":           {"/?hostname=Config.*&port<2", http.StatusOK, []string{"Config1"}},
+	"TestListIn":             {"/?name=Config2,Other", http.StatusOK, []string{"Config2"}},
+	"TestListUnknownField":   {"/?password=secret", http.StatusBadRequest, nil},
+	"TestListStringRange":    {"/?name>=C", http.StatusBadRequest, nil},
+	"TestListSortOperator":   {"/?sort!=name", http.StatusBadRequest, nil},
+	"TestListSortDescending": {"/?sort=-port", http.StatusOK, []string{"Config2", "Config1"}},
+	"TestListSortMultiple":   {"/?sort=username,-name&ignore_case=true&natural=true", http.StatusOK, []string{"Config1", "Config2"}},
+	"TestListSortDuplicate":  {"/?sort=name,-name", http.StatusBadRequest, nil},
+	"TestListBadIgnoreCase":  {"/?sort=name&ignore_case=maybe", http.StatusBadRequest, nil},
+}
+
+func TestListErrorNamesParameter(t *testing.T) {
+	s := newServer(baseConfigs...)
+	r := s.do("viewer", "GET", "/?name=Config1&port>=ssh", nil)
+	var problem map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&problem)
+	if r.Code != http.StatusBadRequest || problem["parameter"] != "port>=ssh" || problem["code"] != response.CodeInvalidParameter {
+		t.Error("Failed:", failure{"Parameter not named", "port>=ssh", problem})
+	}
+}
+
+func TestList(t *testing.T) {
+	s := newServer(baseConfigs...)
+	for testName, test := range listTests {
+		r := s.do("viewer", "GET", test.url, nil)
+		if r.Code != test.expected {
+			t.Error("Failed:", testName, failure{"", test.expected, r.Code})
+			continue
+		}
+		if test.names == nil {
+			continue
+		}
+
+		var configs configuration.Configurations
+		json.NewDecoder(r.Body).Decode(&configs)
+		names := []string{}
+		for _, config := range configs.Configs {
+			names = append(names, config.Name)
+		}
+		if strings.Join(names, ",") != strings.Join(test.names, ",") {
+			t.Error("Failed:", testName, failure{"", test.names, names})
+		}
+	}
+}
+
+// nextLink returns the url of the link with the relation in the Link header.
+func nextLink(r *httptest.ResponseRecorder, rel string) string {
+	for _, link := range strings.Split(r.Header().Get("Link"), ", ") {
+		if strings.HasSuffix(link, `; rel="`+rel+`"`) {
+			return strings.TrimPrefix(link[:strings.Index(link, ">")], "<")
+		}
+	}
+	return ""
+}
+
+func TestCursorPagination(t *testing.T) {
+	configs := []configuration.Configuration{}
+	for _, name := range []string{"e", "a", "d", "b", "c"} {
+		configs = append(configs, configuration.Configuration{Name: name, HostName: name + ".host", Port: 22, Username: "user"})
+	}
+	s := newServer(configs...)
+
+	pages := []string{}
+	url := "/?sort=-port,name&port=22&limit=2"
+	for url != "" && len(pages) < 10 {
+		r := s.do("viewer", "GET", url, nil)
+		if r.Code != http.StatusOK {
+			t.Fatal("Failed:", url, failure{"", http.StatusOK, r.Code})
+		}
+		if r.Header().Get("X-Total-Count") != "5" {
+			t.Error("Failed:", url, failure{"Wrong total", "5", r.Header().Get("X-Total-Count")})
+		}
+
+		var page configuration.Configurations
+		json.NewDecoder(r.Body).Decode(&page)
+		names := []string{}
+		for _, config := range page.Configs {
+			names = append(names, config.Name)
+		}
+		pages = append(pages, strings.Join(names, ","))
+
+		// A configuration added before the current page must not shift the
+		// pages that follow.
+		if len(pages) == 1 {
+			s.store.Add(configuration.Configuration{Name: "0", HostName: "0.host", Port: 2222, Username: "user"})
+		}
+		url = nextLink(r, "next")
+		if url != "" && !strings.HasPrefix(url, "/?") {
+			t.Error("Failed:", failure{"Link does not keep the path", "/?", url})
+		}
+		if url != "" && (!strings.Contains(url, "sort=-port,name") || !strings.Contains(url, "port=22")) {
+			t.Error("Failed:", failure{"Link does not keep the parameters", "sort=-port,name&port=22", url})
+		}
+	}
+
+	expected := []string{"a,b", "c,d", "e"}
+	if strings.Join(pages, "|") != strings.Join(expected, "|") {
+		t.Error("Failed:", failure{"Wrong pages", expected, pages})
+	}
+
+	r := s.do("viewer", "GET", "/?sort=-port,name&port=22&limit=2", nil)
+	r = s.do("viewer", "GET", nextLink(r, "next"), nil)
+	r = s.do("viewer", "GET", nextLink(r, "prev"), nil)
+	var page configuration.Configurations
+	json.NewDecoder(r.Body).Decode(&page)
+	if len(page.Configs) != 2 || page.Configs[0].Name != "a" || page.Configs[1].Name != "b" {
+		t.Error("Failed:", failure{"Wrong previous page", "a,b", page.Configs})
+	}
+	if nextLink(r, "prev") != "" {
+		t.Error("Failed:", failure{"First page links to a previous page", "", nextLink(r, "prev")})
+	}
+}
+
+var cursorTests = map[string]struct {
+	url      string
+	expected int
+}{
+	"TestLimit":           {"/?limit=1", http.StatusOK},
+	"TestBadLimit":        {"/?limit=0", http.StatusBadRequest},
+	"TestLargeLimit":      {"/?limit=101", http.StatusBadRequest},
+	"TestBadCursor":       {"/?cursor=not-a-cursor", http.StatusBadRequest},
+	"TestCursorWithPage":  {"/?limit=1&page=0&per_page=1", http.StatusBadRequest},
+	"TestCursorNotNumber": {"/?sort=port&cursor=" + cursor{Sort: "port", Values: []string{"abc"}, ID: 1}.String(), http.StatusBadRequest},
+	"TestCursorOverflow":  {"/?sort=port&cursor=" + cursor{Sort: "port", Values: []string{"2147483648"}, ID: 1}.String(), http.StatusBadRequest},
+	"TestCursorNoValues":  {"/?cursor=" + cursor{Values: []string{"x"}, ID: 1}.String(), http.StatusBadRequest},
+	"TestCursorOtherSort": {"/?sort=name&natural=true&cursor=" + cursorAt(baseConfigs[0], configuration.Sort{Keys: []configuration.SortKey{{Field: "name"}}}, false).String(), http.StatusBadRequest},
+}
+
+func TestCursorParameters(t *testing.T) {
+	s := newServer(baseConfigs...)
+	for testName, test := range cursorTests {
+		r := s.do("viewer", "GET", test.url, nil)
+		if r.Code != test.expected {
+			t.Error("Failed:", testName, failure{"", test.expected, r.Code})
+		}
+	}
+}
+
+var searchTests = map[string]struct {
+	url      string
+	expected int
+	names    []string
+}{
+	"TestSearch":             {"/search?q=config.2", http.StatusOK, []string{"Config2"}},
+	"TestSearchParameter":    {"/?q=user", http.StatusOK, []string{"Config1", "Config2"}},
+	"TestSearchSorted":       {"/search?q=config&sort=-name", http.StatusOK, []string{"Config2", "Config1"}},
+	"TestSearchMissing":      {"/search", http.StatusBadRequest, nil},
+	"TestSearchEmpty":        {"/search?q=+", http.StatusBadRequest, nil},
+	"TestSearchRankedCursor": {"/search?q=config&cursor=" + cursorAt(baseConfigs[0], configuration.Sort{}, false).String(), http.StatusBadRequest, nil},
+	"TestSearchSortedCursor": {"/search?q=config&sort=name&cursor=" + cursorAt(configuration.Configuration{ID: 1, Name: "Config1"}, configuration.Sort{Keys: []configuration.SortKey{{Field: "name"}}}, false).String(), http.StatusOK, []string{"Config2"}},
+}
+
+func TestSearch(t *testing.T) {
+	s := newServer(baseConfigs...)
+	for testName, test := range searchTests {
+		r := s.do("viewer", "GET", test.url, nil)
+		if r.Code != test.expected {
+			t.Error("Failed:", testName, failure{"", test.expected, r.Code})
+			continue
+		}
+		if test.names == nil {
+			continue
+		}
+
+		var configs configuration.Configurations
+		json.NewDecoder(r.Body).Decode(&configs)
+		names := []string{}
+		for _, config := range configs.Configs {
+			names = append(names, config.Name)
+		}
+		if strings.Join(names, ",") != strings.Join(test.names, ",") {
+			t.Error("Failed:", testName, failure{"", test.names, names})
+		}
+	}
+}
+
+var labelConfigs = []configuration.Configuration{
+	{Name: "web", HostName: "web.example.com", Port: 22, Username: "deploy", Labels: configuration.Labels{"env": "prod", "team": "payments"}},
+	{Name: "db", HostName: "db.example.com", Port: 5432, Username: "postgres", Labels: configuration.Labels{"env": "prod", "team": "qa"}},
+	{Name: "cache", HostName: "cache.example.com", Port: 6379, Username: "redis"},
+}
+
+var labelTests = map[string]struct {
+	method   string
+	url      string
+	body     string
+	expected int
+	names    []string
+}{
+	"TestLabelSelector":      {"GET", "/?label=env=prod,team!=qa", "", http.StatusOK, []string{"web"}},
+	"TestLabelEscaped":       {"GET", "/?label=env%3Dprod", "", http.StatusOK, []string{"web", "db"}},
+	"TestLabelParameters":    {"GET", "/?label=env=prod&label=team=qa", "", http.StatusOK, []string{"db"}},
+	"TestLabelNotExists":     {"GET", "/?label=!env", "", http.StatusOK, []string{"cache"}},
+	"TestLabelWithFilter":    {"GET", "/?label=env=prod&port>100", "", http.StatusOK, []string{"db"}},
+	"TestLabelBadSelector":   {"GET", "/?label=env=prod%20eu", "", http.StatusBadRequest, nil},
+	"TestLabelBadOperator":   {"GET", "/?label!=env", "", http.StatusBadRequest, nil},
+	"TestLabelAdd":           {"POST", "/", `{"name": "mail", "hostname": "mail.example.com", "port": 25, "username": "postfix", "labels": {"env": "prod"}}`, http.StatusOK, []string{"mail"}},
+	"TestLabelAddInvalid":    {"POST", "/", `{"name": "mail", "hostname": "mail.example.com", "port": 25, "username": "postfix", "labels": {"env": "prod/eu"}}`, http.StatusUnprocessableEntity, nil},
+	"TestLabelModify":        {"PATCH", "/cache", `{"labels": {"env": "staging"}}`, http.StatusOK, []string{"cache"}},
+	"TestLabelModifyInvalid": {"PATCH", "/cache", `{"labels": {"": "staging"}}`, http.StatusUnprocessableEntity, nil},
+}
+
+func TestLabels(t *testing.T) {
+	for testName, test := range labelTests {
+		s := newServer(labelConfigs...)
+		r := s.do("editor", test.method, test.url, strings.NewReader(test.body))
+		if r.Code != test.expected {
+			t.Error("Failed:", testName, failure{r.Body.String(), test.expected, r.Code})
+			continue
+		}
+		if test.names == nil {
+			continue
+		}
+
+		var configs configuration.Configurations
+		json.NewDecoder(r.Body).Decode(&configs)
+		names := []string{}
+		for _, config := range configs.Configs {
+			names = append(names, config.Name)
+		}
+		if strings.Join(names, ",") != strings.Join(test.names, ",") {
+			t.Error("Failed:", testName, failure{"", test.names, names})
+		}
+	}
+}
+
+func TestLabelsReturned(t *testing.T) {
+	s := newServer(labelConfigs...)
+	s.do("editor", "PATCH", "/web", strings.NewReader(`{"labels": {"env": "staging"}}`))
+
+	r := s.do("viewer", "GET", "/web", nil)
+	var configs configuration.Configurations
+	json.NewDecoder(r.Body).Decode(&configs)
+	expected := configuration.Labels{"env": "staging"}
+	if len(configs.Configs) != 1 || !reflect.DeepEqual(configs.Configs[0].Labels, expected) {
+		t.Error("Failed:", failure{"Labels were not replaced", expected, configs.Configs})
+	}
+
+	r = s.do("viewer", "GET", "/cache", nil)
+	if strings.Contains(r.Body.String(), "labels") {
+		t.Error("Failed:", failure{"Empty labels were returned", nil, r.Body.String()})
+	}
+}
+
+const attributeSchema = `{"schema": {
+  "type": "object",
+  "required": ["protocol"],
+  "properties": {"protocol": {"enum": ["ssh", "sftp"]}, "timeout": {"type": "integer"}}
+}}`
+
+var schemaTests = map[string]struct {
+	user     string
+	method   string
+	url      string
+	body     string
+	expected int
+	response string
+}{
+	"TestGetSchema":            {"viewer", "GET", "/schema", "", http.StatusOK, `"required":[`},
+	"TestEditorSetSchema":      {"editor", "PUT", "/schema", `{"schema": {}}`, http.StatusForbidden, ""},
+	"TestEditorSetSchemaSlash": {"editor", "PUT", "/schema/", `{"schema": {}}`, http.StatusForbidden, ""},
+	"TestAdminSetSchema":       {"admin", "PUT", "/schema", `{"schema": {"type": "object"}}`, http.StatusOK, `"updated_by":"admin"`},
+	"TestSetInvalidSchema":     {"admin", "PUT", "/schema", `{"schema": {"type": 7}}`, http.StatusUnprocessableEntity, `"field":"schema"`},
+	"TestSetMissingSchema":     {"admin", "PUT", "/schema", `{}`, http.StatusUnprocessableEntity, `"message":"schema is required"`},
+	"TestSetMalformedSchema":   {"admin", "PUT", "/schema", `{"schema": `, http.StatusBadRequest, ""},
+	"TestAddAttributes":        {"editor", "POST", "/", `{"name": "New", "hostname": "new.host", "port": 22, "username": "new", "attributes": {"protocol": "ssh", "timeout": 30}}`, http.StatusOK, `"timeout":30`},
+	"TestAddInvalid":           {"editor", "POST", "/", `{"name": "New", "hostname": "new.host", "port": 22, "username": "new", "attributes": {"timeout": "30"}}`, http.StatusUnprocessableEntity, `"field":"attributes.timeout"`},
+	"TestModifyAttributes":     {"editor", "PATCH", "/Config1", `{"attributes": {"protocol": "sftp"}}`, http.StatusOK, `"protocol":"sftp"`},
+	"TestModifyInvalid":        {"editor", "PATCH", "/Config1", `{"attributes": {"protocol": "ftp"}}`, http.StatusUnprocessableEntity, `"field":"attributes.protocol"`},
+}
+
+func TestSchema(t *testing.T) {
+	for testName, test := range schemaTests {
+		s := newServer(baseConfigs[0])
+		s.store.Modify("Config1", configuration.Configuration{Attributes: configuration.Attributes{"protocol": "ssh"}})
+		if r := s.do("admin", "PUT", "/schema", strings.NewReader(attributeSchema)); r.Code != http.StatusOK {
+			t.Fatal("Failed to set the schema:", r.Body.String())
+		}
+
+		r := s.do(test.user, test.method, test.url, strings.NewReader(test.body))
+		if r.Code != test.expected {
+			t.Error("Failed:", testName, failure{r.Body.String(), test.expected, r.Code})
+			continue
+		}
+		if !strings.Contains(r.Body.String(), test.response) {
+			t.Error("Failed:", testName, failure{"Wrong body", test.response, r.Body.String()})
+		}
+	}
+}
+
+var validationTests = map[string]struct {
+	method   string
+	url      string
+	body     string
+	expected int
+	fields   []string
+}{
+	"TestAddValid":          {"POST", "/", `{"name": "web", "hostname": "10.0.0.1", "port": 22, "username": "deploy"}`, http.StatusOK, nil},
+	"TestAddEmpty":          {"POST", "/", `{}`, http.StatusUnprocessableEntity, []string{"name", "hostname", "port", "username"}},
+	"TestAddInvalidFields":  {"POST", "/", `{"name": "web 1", "hostname": "web example.com", "port": 99999, "username": "deploy"}`, http.StatusUnprocessableEntity, []string{"name", "hostname", "port"}},
+	"TestAddReservedName":   {"POST", "/", `{"name": "schema", "hostname": "web.example.com", "port": 22, "username": "deploy"}`, http.StatusUnprocessableEntity, []string{"name"}},
+	"TestAddMalformed":      {"POST", "/", `{"name": `, http.StatusBadRequest, nil},
+	"TestModifyPortZero":    {"PATCH", "/Config1", `{"port": 0}`, http.StatusUnprocessableEntity, []string{"port"}},
+	"TestModifyEmptyName":   {"PATCH", "/Config1", `{"name": "", "username": "ok"}`, http.StatusUnprocessableEntity, []string{"name"}},
+	"TestModifyUnsetFields": {"PATCH", "/Config1", `{"username": "deploy"}`, http.StatusOK, nil},
+	"TestModifyNotObject":   {"PATCH", "/Config1", `[1]`, http.StatusBadRequest, nil},
+}
+
+func TestValidation(t *testing.T) {
+	for testName, test := range validationTests {
+		s := newServer(baseConfigs...)
+		r := s.do("editor", test.method, test.url, strings.NewReader(test.body))
+		if r.Code != test.expected {
+			t.Error("Failed:", testName, failure{r.Body.String(), test.expected, r.Code})
+			continue
+		}
+		if test.fields == nil {
+			continue
+		}
+
+		var ve configuration.ValidationError
+		json.NewDecoder(r.Body).Decode(&ve)
+		fields := []string{}
+		for _, fe := range ve.Errors {
+			fields = append(fields, fe.Field)
+		}
+		if strings.Join(fields, ",") != strings.Join(test.fields, ",") {
+			t.Error("Failed:", testName, failure{"", test.fields, fields})
+		}
+	}
+}
+
+var patchTests = map[string]struct {
+	method      string
+	url         string
+	contentType string
+	ifMatch     string
+	body        string
+	expected    int
+	code        string
+	contains    string
+}{
+	"TestPutReplaces":         {"PUT", "/Config1", "", "", `{"hostname": "web.example.com", "port": 22, "username": "deploy"}`, http.StatusOK, "", `"hostname":"web.example.com"`},
+	"TestPutCreates":          {"PUT", "/web", "", "", `{"hostname": "web.example.com", "port": 22, "username": "deploy"}`, http.StatusCreated, "", `"name":"web"`},
+	"TestPutCreateIfMatch":    {"PUT", "/web", "", `"3-1"`, `{"hostname": "web.example.com", "port": 22, "username": "deploy"}`, http.StatusPreconditionFailed, response.CodePreconditionFailed, ""},
+	"TestPutStale":            {"PUT", "/Config1", "", `"1-7"`, `{"hostname": "web.example.com", "port": 22, "username": "deploy"}`, http.StatusPreconditionFailed, response.CodePreconditionFailed, ""},
+	"TestPutIncomplete":       {"PUT", "/Config1", "", "", `{"port": 22}`, http.StatusUnprocessableEntity, response.CodeValidationFailed, `"field":"hostname"`},
+	"TestPutRenameTaken":      {"PUT", "/Config1", "", "", `{"name": "Config2", "hostname": "web.example.com", "port": 22, "username": "deploy"}`, http.StatusConflict, response.CodeConflict, ""},
+	"TestMergePatch":          {"PATCH", "/Config1", MergePatchType, "", `{"labels": {"env": "prod"}, "port": 2222}`, http.StatusOK, "", `"env":"prod"`},
+	"TestMergePatchNull":      {"PATCH", "/Config1", MergePatchType, "", `{"port": null}`, http.StatusUnprocessableEntity, response.CodeValidationFailed, `"field":"port"`},
+	"TestMergePatchMalformed": {"PATCH", "/Config1", MergePatchType, "", `{"port": `, http.StatusBadRequest, response.CodeMalformedBody, ""},
+	"TestJSONPatch":           {"PATCH", "/Config1", JSONPatchType, "", `[{"op": "test", "path": "/port", "value": 1}, {"op": "replace", "path": "/port", "value": 2222}]`, http.StatusOK, "", `"port":2222`},
+	"TestJSONPatchTestFails":  {"PATCH", "/Config1", JSONPatchType, "", `[{"op": "test", "path": "/port", "value": 22}]`, http.StatusConflict, response.CodeTestFailed, `"path":"/port"`},
+	"TestJSONPatchBadPath":    {"PATCH", "/Config1", JSONPatchType, "", `[{"op": "remove", "path": "/labels/env"}]`, http.StatusUnprocessableEntity, response.CodeInvalidPatch, `"operation":"remove"`},
+	"TestJSONPatchNotArray":   {"PATCH", "/Config1", JSONPatchType, "", `{"op": "remove"}`, http.StatusBadRequest, response.CodeMalformedBody, ""},
+	"TestJSONPatchIfMatch":    {"PATCH", "/Config1", JSONPatchType, `"1-7"`, `[]`, http.StatusPreconditionFailed, response.CodePreconditionFailed, ""},
+	"TestPatchUnsupported":    {"PATCH", "/Config1", "text/plain", "", `port=22`, http.StatusUnsupportedMediaType, response.CodeUnsupportedMedia, ""},
+	"TestPatchCharset":        {"PATCH", "/Config1", "application/json; charset=utf-8", "", `{"port": 22}`, http.StatusOK, "", `"port":22`},
+}
+
+func TestPatches(t *testing.T) {
+	for testName, test := range patchTests {
+		s := newServer(baseConfigs...)
+		req := httptest.NewRequest(test.method, test.url, strings.NewReader(test.body))
+		req.Header.Set("Cookie", s.cookies["editor"])
+		if test.contentType != "" {
+			req.Header.Set("Content-Type", test.contentType)
+		}
+		if test.ifMatch != "" {
+			req.Header.Set("If-Match", test.ifMatch)
+		}
+		r := httptest.NewRecorder()
+		s.ServeHTTP(r, req)
+
+		body := r.Body.String()
+		var problem map[string]interface{}
+		json.Unmarshal(r.Body.Bytes(), &problem)
+		switch {
+		case r.Code != test.expected:
+			t.Error("Failed:", testName, failure{body, test.expected, r.Code})
+		case test.code != "" && problem["code"] != test.code:
+			t.Error("Failed:", testName, failure{"Wrong problem", test.code, body})
+		case !strings.Contains(body, test.contains):
+			t.Error("Failed:", testName, failure{"Wrong body", test.contains, body})
+		case r.Code < 300 && r.Header().Get("ETag") == "":
+			t.Error("Failed:", testName, failure{"Missing ETag", "", r.Header()})
+		}
+		if test.code == response.CodeUnsupportedMedia && r.Header().Get("Accept-Patch") == "" {
+			t.Error("Failed:", testName, failure{"Missing Accept-Patch", "", r.Header()})
+		}
+	}
+}
+
+var batchTests = map[string]struct {
+	body     string
+	expected int
+	statuses []int
+	index    int
+	names    []string
+}{
+	"TestBatch": {
+		`{"atomic": true, "operations": [
+		  {"op": "create", "configuration": {"name": "web", "hostname": "web.example.com", "port": 22, "username": "deploy"}},
+		  {"op": "update", "name": "Config1", "patch": {"port": 2222}},
+		  {"op": "update", "name": "web", "patch": [{"op": "replace", "path": "/port", "value": 2200}]},
+		  {"op": "delete", "name": "Config2", "version": 1}]}`,
+		http.StatusOK, []int{http.StatusCreated, http.StatusOK, http.StatusOK, http.StatusNoContent}, 0, []string{"Config1", "web"},
+	},
+	"TestBatchAtomicFails": {
+		`{"atomic": true, "operations": [
+		  {"op": "delete", "name": "Config1"},
+		  {"op": "create", "configuration": {"name": "Config2", "hostname": "web.example.com", "port": 22, "username": "deploy"}}]}`,
+		http.StatusConflict, nil, 1, []string{"Config1", "Config2"},
+	},
+	"TestBatchAtomicInvalid": {
+		`{"atomic": true, "operations": [
+		  {"op": "delete", "name": "Config1"},
+		  {"op": "create", "configuration": {"name": "web"}}]}`,
+		http.StatusUnprocessableEntity, nil, 1, []string{"Config1", "Config2"},
+	},
+	"TestBatchBestEffort": {
+		`{"operations": [
+		  {"op": "create", "configuration": {"name": "Config2", "hostname": "web.example.com", "port": 22, "username": "deploy"}},
+		  {"op": "create", "configuration": {"name": "web"}},
+		  {"op": "rename", "name": "Config1"},
+		  {"op": "update", "name": "Config1", "patch": [{"op": "test", "path": "/port", "value": 7}]},
+		  {"op": "update", "name": "Config1", "patch": "port=7"},
+		  {"op": "delete", "name": "Missing"},
+		  {"op": "delete", "name": "Missing", "version": 1},
+		  {"op": "delete", "name": "Config1"}]}`,
+		http.StatusOK, []int{http.StatusConflict, http.StatusUnprocessableEntity, http.StatusUnprocessableEntity, http.StatusConflict, http.StatusUnprocessableEntity, http.StatusNoContent, http.StatusPreconditionFailed, http.StatusNoContent}, 0, []string{"Config2"},
+	},
+	"TestBatchAtomicDeleteMissing": {
+		`{"atomic": true, "operations": [
+		  {"op": "delete", "name": "Missing"},
+		  {"op": "delete", "name": "Config1"}]}`,
+		http.StatusOK, []int{http.StatusNoContent, http.StatusNoContent}, 0, []string{"Config2"},
+	},
+	"TestBatchEmpty":     {`{"operations": []}`, http.StatusUnprocessableEntity, nil, 0, []string{"Config1", "Config2"}},
+	"TestBatchMalformed": {`{"operations": `, http.StatusBadRequest, nil, 0, []string{"Config1", "Config2"}},
+}
+
+func TestBatch(t *testing.T) {
+	for testName, test := range batchTests {
+		s := newServer(baseConfigs...)
+		r := s.do("editor", "POST", "/batch", strings.NewReader(test.body))
+		if r.Code != test.expected {
+			t.Error("Failed:", testName, failure{r.Body.String(), test.expected, r.Code})
+			continue
+		}
+
+		var body struct {
+			Index   int `json:"index"`
+			Results []struct {
+				Status int `json:"status"`
+			} `json:"results"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		statuses := []int{}
+		for _, result := range body.Results {
+			statuses = append(statuses, result.Status)
+		}
+		if test.statuses != nil && !reflect.DeepEqual(statuses, test.statuses) {
+			t.Error("Failed:", testName, failure{"Wrong statuses", test.statuses, statuses})
+		}
+		if body.Index != test.index {
+			t.Error("Failed:", testName, failure{"Wrong index", test.index, body.Index})
+		}
+
+		configs, _ := s.store.GetAll()
+		names := []string{}
+		for _, config := range configs {
+			names = append(names, config.Name)
+		}
+		if !reflect.DeepEqual(names, test.names) {
+			t.Error("Failed:", testName, failure{"Wrong configurations", test.names, names})
+		}
+	}
+}
+
+func TestBatchPermission(t *testing.T) {
+	s := newServer(baseConfigs...)
+	r := s.do("viewer", "POST", "/batch", strings.NewReader(`{"operations": [{"op": "delete", "name": "Config1"}]}`))
+	if r.Code != http.StatusForbidden {
+		t.Error("Failed:", failure{r.Body.String(), http.StatusForbidden, r.Code})
+	}
+}
+
+var lookupTests = map[string]struct {
+	method   string
+	url      string
+	body     string
+	expected int
+	names    []string
+	missing  []string
+}{
+	"TestLookupQuery":          {"GET", "/?name=Config2&name=Missing&name=Config1", "", http.StatusOK, []string{"Config1", "Config2"}, []string{"Missing"}},
+	"TestLookupQueryList":      {"GET", "/?name=Config1,Config1", "", http.StatusOK, []string{"Config1"}, []string{}},
+	"TestLookupQueryPattern":   {"GET", "/?name=Config*&name=Missing", "", http.StatusOK, []string{"Config1", "Config2"}, []string{"Missing"}},
+	"TestLookupQueryNoMissing": {"GET", "/?name=Config*", "", http.StatusOK, []string{"Config1", "Config2"}, nil},
+	"TestLookupBody":           {"POST", "/lookup", `{"names": ["Config2", "Missing", "Config1"]}`, http.StatusOK, []string{"Config2", "Config1"}, []string{"Missing"}},
+	"TestLookupBodyAllMissing": {"POST", "/lookup", `{"names": ["Missing"]}`, http.StatusOK, []string{}, []string{"Missing"}},
+	"TestLookupBodyEmpty":      {"POST", "/lookup", `{"names": []}`, http.StatusUnprocessableEntity, nil, nil},
+	"TestLookupBodyMalformed":  {"POST", "/lookup", `{"names": `, http.StatusBadRequest, nil, nil},
+}
+
+func TestLookup(t *testing.T) {
+	s := newServer(baseConfigs...)
+	for testName, test := range lookupTests {
+		r := s.do("viewer", test.method, test.url, strings.NewReader(test.body))
+		if r.Code != test.expected {
+			t.Error("Failed:", testName, failure{r.Body.String(), test.expected, r.Code})
+			continue
+		}
+		if r.Code != http.StatusOK {
+			continue
+		}
+
+		var body struct {
+			Configs []configuration.Configuration `json:"configurations"`
+			Missing []string                      `json:"missing"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		names := []string{}
+		for _, config := range body.Configs {
+			names = append(names, config.Name)
+		}
+		if !reflect.DeepEqual(names, test.names) {
+			t.Error("Failed:", testName, failure{"Wrong configurations", test.names, names})
+		}
+		if !reflect.DeepEqual(body.Missing, test.missing) {
+			t.Error("Failed:", testName, failure{"Wrong missing names", test.missing, body.Missing})
+		}
+	}
+}
+
+var importTests = map[string]struct {
+	url         string
+	contentType string
+	body        string
+	expected    int
+	summary     map[string]int
+	ports       []int
+}{
+	"TestImportJSON": {
+		"/import?conflict=overwrite", "application/json",
+		`{"configurations": [{"id": 7, "name": "Config1", "hostname": "Config.1", "port": 11, "username": "user1"}, {"name": "web", "hostname": "web.example.com", "port": 22, "username": "deploy"}]}`,
+		http.StatusOK, map[string]int{"update": 1, "create": 1}, []int{11, 2, 22},
+	},
+	"TestImportYAML": {
+		"/import?conflict=skip", "application/yaml",
+		"configurations:\n- name: Config1\n  hostname: Config.1\n  port: 11\n  username: user1\n- name: web\n  hostname: web.example.com\n  port: 22\n  username: deploy\n  attributes:\n    tunnel: {local: 8080}\n",
+		http.StatusOK, map[string]int{"skip": 1, "create": 1}, []int{1, 2, 22},
+	},
+	"TestImportCSV": {
+		"/import?conflict=overwrite", "text/csv",
+		"name,hostname,port,username,labels\nConfig2,Config.2,2,user2,\nweb,web.example.com,22,deploy,env=prod\n",
+		http.StatusOK, map[string]int{"unchanged": 1, "create": 1}, []int{1, 2, 22},
+	},
+	"TestImportDryRun": {
+		"/import?dry_run=true", "",
+		`[{"name": "Config1", "hostname": "Config.1", "port": 11, "username": "user1"}, {"name": "web", "hostname": "web.example.com", "port": 22, "username": "deploy"}]`,
+		http.StatusOK, map[string]int{"conflict": 1, "create": 1}, []int{1, 2},
+	},
+	"TestImportConflict": {
+		"/import", "",
+		`[{"name": "Config1", "hostname": "Config.1", "port": 11, "username": "user1"}, {"name": "web", "hostname": "web.example.com", "port": 22, "username": "deploy"}]`,
+		http.StatusConflict, nil, []int{1, 2},
+	},
+	"TestImportInvalid": {
+		"/import", "",
+		`[{"name": "web", "hostname": "web.example.com", "port": 22, "username": "deploy"}, {"name": "db"}]`,
+		http.StatusUnprocessableEntity, nil, []int{1, 2},
+	},
+	"TestImportSSHConfig": {
+		"/import?conflict=skip", "text/plain",
+		"Host Config1 web\n  User deploy\n\nHost web\n  HostName web.example.com\n\nHost *\n  Port 2222\n",
+		http.StatusOK, map[string]int{"skip": 1, "create": 1}, []int{1, 2, 2222},
+	},
+	"TestImportSSHConfigMalformed": {"/import?format=ssh_config", "", "Host web\n  Port ssh\n", http.StatusBadRequest, nil, []int{1, 2}},
+	"TestImportEmpty":              {"/import", "", `[]`, http.StatusUnprocessableEntity, nil, []int{1, 2}},
+	"TestImportMalformed":          {"/import", "text/csv", "name,flavor\nweb,vanilla\n", http.StatusBadRequest, nil, []int{1, 2}},
+	"TestImportUnknownPolicy":      {"/import?conflict=merge", "", `[]`, http.StatusBadRequest, nil, []int{1, 2}},
+	"TestImportUnknownFormat":      {"/import?format=xml", "", `[]`, http.StatusBadRequest, nil, []int{1, 2}},
+	"TestImportUnsupportedType":    {"/import", "application/xml", `<configurations/>`, http.StatusUnsupportedMediaType, nil, []int{1, 2}},
+}
+
+func TestImport(t *testing.T) {
+	for testName, test := range importTests {
+		s := newServer(baseConfigs...)
+		req := httptest.NewRequest("POST", test.url, strings.NewReader(test.body))
+		req.Header.Set("Cookie", s.cookies["editor"])
+		if test.contentType != "" {
+			req.Header.Set("Content-Type", test.contentType)
+		}
+		r := httptest.NewRecorder()
+		s.ServeHTTP(r, req)
+		if r.Code != test.expected {
+			t.Error("Failed:", testName, failure{r.Body.String(), test.expected, r.Code})
+			continue
+		}
+
+		if test.summary != nil {
+			var body struct {
+				Summary map[string]int `json:"summary"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			for action, count := range body.Summary {
+				if count != test.summary[action] {
+					t.Error("Failed:", testName, failure{"Wrong summary", test.summary, body.Summary})
+					break
+				}
+			}
+		}
+
+		configs, _ := s.store.GetAll()
+		ports := []int{}
+		for _, config := range configs {
+			ports = append(ports, config.Port)
+		}
+		if !reflect.DeepEqual(ports, test.ports) {
+			t.Error("Failed:", testName, failure{"Wrong configurations", test.ports, ports})
+		}
+	}
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	configs := []configuration.Configuration{
+		{Name: "web", HostName: "web.example.com", Port: 22, Username: "deploy", Labels: configuration.Labels{"env": "prod", "team": "web"}, Attributes: configuration.Attributes{"tunnel": map[string]interface{}{"local": float64(8080)}}},
+		{Name: "db", HostName: "db.example.com", Port: 5432, Username: "postgres"},
+	}
+	for _, format := range []string{FormatJSON, FormatYAML, FormatCSV} {
+		r := newServer(configs...).do("viewer", "GET", "/export?format="+format, nil)
+		if r.Code != http.StatusOK || r.Header().Get("Content-Type") != formatTypes[format] {
+			t.Error("Failed:", format, failure{r.Body.String(), formatTypes[format], r.Header().Get("Content-Type")})
+			continue
+		}
+
+		s := newServer()
+		req := httptest.NewRequest("POST", "/import", r.Body)
+		req.Header.Set("Cookie", s.cookies["editor"])
+		req.Header.Set("Content-Type", formatTypes[format])
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Error("Failed:", format, failure{w.Body.String(), http.StatusOK, w.Code})
+			continue
+		}
+		imported, _ := s.store.GetAll()
+		for i := range imported {
+			imported[i].ID, imported[i].Version = 0, 0
+		}
+		if !reflect.DeepEqual(imported, configs) {
+			t.Error("Failed:", format, failure{"Configurations did not round trip", configs, imported})
+		}
+	}
+}
+
+func TestImportExportPermissions(t *testing.T) {
+	s := newServer(baseConfigs...)
+	if r := s.do("viewer", "POST", "/import", strings.NewReader(`[]`)); r.Code != http.StatusForbidden {
+		t.Error("Failed:", failure{r.Body.String(), http.StatusForbidden, r.Code})
+	}
+	if r := s.do("viewer", "GET", "/export?format=csv", nil); r.Code != http.StatusOK {
+		t.Error("Failed:", failure{r.Body.String(), http.StatusOK, r.Code})
+	}
+}
+
+var negotiationTests = map[string]struct {
+	method      string
+	url         string
+	accept      string
+	contentType string
+	body        string
+	expected    int
+	responds    string
+	contains    string
+}{
+	"TestListYAML":             {"GET", "/", "application/yaml", "", "", http.StatusOK, "application/yaml", "- id: 1\n  name: Config1\n"},
+	"TestListCSV":              {"GET", "/?sort=name", "text/csv", "", "", http.StatusOK, "text/csv", "id,name,hostname,port,username,version,labels,attributes\n1,Config1,Config.1,1,user1,1,,\n"},
+	"TestListMsgPack":          {"GET", "/", "application/msgpack", "", "", http.StatusOK, "application/msgpack", "Config1"},
+	"TestListPretty":           {"GET", "/?pretty", "", "", "", http.StatusOK, "application/json", "\"name\": \"Config1\""},
+	"TestSchemaNotCSV":         {"GET", "/schema", "text/csv", "", "", http.StatusNotAcceptable, response.ProblemContentType, response.CodeNotAcceptable},
+	"TestNotAcceptable":        {"GET", "/Config1", "application/xml", "", "", http.StatusNotAcceptable, response.ProblemContentType, response.CodeNotAcceptable},
+	"TestAddYAML":              {"POST", "/", "", "application/yaml", "name: web\nhostname: web.example.com\nport: 22\nusername: deploy\n", http.StatusOK, "application/json", `"name":"web"`},
+	"TestAddMsgPack":           {"POST", "/", "application/yaml", "application/msgpack", "\x84\xa4name\xa3web\xa8hostname\xafweb.example.com\xa4port\x16\xa8username\xa6deploy", http.StatusOK, "application/yaml", "name: web\n"},
+	"TestAddMalformedYAML":     {"POST", "/", "", "application/yaml", "name: [", http.StatusBadRequest, response.ProblemContentType, response.CodeMalformedBody},
+	"TestAddUnsupported":       {"POST", "/", "", "text/plain", `{"name": "web"}`, http.StatusUnsupportedMediaType, response.ProblemContentType, response.CodeUnsupportedMedia},
+	"TestModifyYAML":           {"PATCH", "/Config1", "", "text/yaml", "port: 2222\n", http.StatusOK, "application/json", `"port":2222`},
+	"TestReplaceYAML":          {"PUT", "/Config1", "", "application/yaml", "hostname: web.example.com\nport: 22\nusername: deploy\n", http.StatusOK, "application/json", `"hostname":"web.example.com"`},
+	"TestModifyYAMLInvalid":    {"PATCH", "/Config1", "", "application/yaml", "port: 0\n", http.StatusUnprocessableEntity, response.ProblemContentType, `"field":"port"`},
+	"TestModifyCSVUnsupported": {"PATCH", "/Config1", "", "text/csv", "port\n22\n", http.StatusUnsupportedMediaType, response.ProblemContentType, response.CodeUnsupportedMedia},
+}
+
+func TestNegotiation(t *testing.T) {
+	for testName, test := range negotiationTests {
+		s := newServer(baseConfigs...)
+		req := httptest.NewRequest(test.method, test.url, strings.NewReader(test.body))
+		req.Header.Set("Cookie", s.cookies["editor"])
+		req.Header.Set("Accept", test.accept)
+		if test.contentType != "" {
+			req.Header.Set("Content-Type", test.contentType)
+		}
+		r := httptest.NewRecorder()
+		s.ServeHTTP(r, req)
+
+		switch {
+		case r.Code != test.expected:
+			t.Error("Failed:", testName, failure{r.Body.String(), test.expected, r.Code})
+		case r.Header().Get("Content-Type") != test.responds:
+			t.Error("Failed:", testName, failure{"Wrong Content-Type", test.responds, r.Header().Get("Content-Type")})
+		case !strings.Contains(r.Body.String(), test.contains):
+			t.Error("Failed:", testName, failure{"Wrong body", test.contains, r.Body.String()})
+		}
+	}
+}
+
+var sshConfigTests = map[string]struct {
+	url      string
+	expected int
+	body     string
+}{
+	"TestSSHConfig":         {"/ssh_config", http.StatusOK, "Host Config1\n    HostName Config.1\n    Port 1\n    User user1\n\nHost Config2\n    HostName Config.2\n    Port 2\n    User user2\n"},
+	"TestSSHConfigFiltered": {"/ssh_config?port>=2", http.StatusOK, "Host Config2\n    HostName Config.2\n    Port 2\n    User user2\n"},
+	"TestSSHConfigSorted":   {"/ssh_config?sort=-name&name=Config1,Config2&limit=1", http.StatusOK, "Host Config2\n    HostName Config.2\n    Port 2\n    User user2\n"},
+	"TestSSHConfigNone":     {"/ssh_config?username=nobody", http.StatusOK, ""},
+	"TestSSHConfigBadParam": {"/ssh_config?port>=ssh", http.StatusBadRequest, ""},
+}
+
+func TestSSHConfig(t *testing.T) {
+	s := newServer(baseConfigs...)
+	for testName, test := range sshConfigTests {
+		r := s.do("viewer", "GET", test.url, nil)
+		if r.Code != test.expected {
+			t.Error("Failed:", testName, failure{r.Body.String(), test.expected, r.Code})
+			continue
+		}
+		if r.Code == http.StatusOK && r.Body.String() != test.body {
+			t.Error("Failed:", testName, failure{"Wrong body", test.body, r.Body.String()})
+		}
+	}
+}
+
+var problemTests = map[string]struct {
+	user     string
+	method   string
+	url      string
+	body     string
+	header   string
+	expected int
+	code     string
+}{
+	"TestProblemNotFound":     {"viewer", "GET", "/Unknown", "", "", http.StatusNotFound, response.CodeNotFound},
+	"TestProblemForbidden":    {"viewer", "DELETE", "/Config1", "", "", http.StatusForbidden, response.CodeForbidden},
+	"TestProblemUnauth":       {"nobody", "GET", "/", "", "", http.StatusForbidden, response.CodeUnauthenticated},
+	"TestProblemMalformed":    {"editor", "POST", "/", `{`, "", http.StatusBadRequest, response.CodeMalformedBody},
+	"TestProblemParameter":    {"viewer", "GET", "/?port>=ssh", "", "", http.StatusBadRequest, response.CodeInvalidParameter},
+	"TestProblemConflict":     {"editor", "PATCH", "/Config1", `{"name": "Config2"}`, "", http.StatusConflict, response.CodeConflict},
+	"TestProblemPrecondition": {"editor", "DELETE", "/Config1", "", `"1-7"`, http.StatusPreconditionFailed, response.CodePreconditionFailed},
+	"TestProblemValidation":   {"editor", "PATCH", "/Config1", `{"port": 0}`, "", http.StatusUnprocessableEntity, response.CodeValidationFailed},
+	"TestProblemNoRoute":      {"viewer", "GET", "/Config1/a/b", "", "", http.StatusNotFound, response.CodeNotFound},
+	"TestProblemMethod":       {"viewer", "POST", "/Config1", "", "", http.StatusMethodNotAllowed, response.CodeMethodNotAllowed},
+}
+
+func TestProblems(t *testing.T) {
+	for testName, test := range problemTests {
+		s := newServer(baseConfigs...)
+		req := httptest.NewRequest(test.method, test.url, strings.NewReader(test.body))
+		req.Header.Set("Cookie", s.cookies[test.user])
+		req.Header.Set(request.IDHeader, "request-1")
+		if test.header != "" {
+			req.Header.Set("If-Match", test.header)
+		}
+		r := httptest.NewRecorder()
+		request.WithID(s).ServeHTTP(r, req)
+
+		var problem map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&problem)
+		switch {
+		case r.Code != test.expected:
+			t.Error("Failed:", testName, failure{"Wrong status", test.expected, r.Code})
+		case r.Header().Get("Content-Type") != response.ProblemContentType:
+			t.Error("Failed:", testName, failure{"Wrong content type", response.ProblemContentType, r.Header().Get("Content-Type")})
+		case problem["code"] != test.code || problem["status"] != float64(test.expected):
+			t.Error("Failed:", testName, failure{"Wrong problem", test.code, problem})
+		case problem["request_id"] != "request-1":
+			t.Error("Failed:", testName, failure{"Missing request ID", "request-1", problem["request_id"]})
+		}
+	}
+}
+
+func TestProblemMembers(t *testing.T) {
+	s := newServer(baseConfigs...)
+	r := s.do("editor", "PATCH", "/Config1", strings.NewReader(`{"name": "Config2", "port": 99999}`))
+	var problem struct {
+		Errors []configuration.FieldError `json:"errors"`
+	}
+	json.NewDecoder(r.Body).Decode(&problem)
+	if len(problem.Errors) != 1 || problem.Errors[0].Field != "port" {
+		t.Error("Failed:", failure{"Invalid fields not listed", "port", problem.Errors})
+	}
+
+	r = s.do("editor", "PATCH", "/Config1", strings.NewReader(`{"name": "Config2"}`))
+	var conflict struct {
+		Configurations []configuration.Configuration `json:"configurations"`
+	}
+	json.NewDecoder(r.Body).Decode(&conflict)
+	if len(conflict.Configurations) != 1 || conflict.Configurations[0].Name != "Config2" {
+		t.Error("Failed:", failure{"Conflicting configuration not listed", "Config2", conflict.Configurations})
+	}
+}
+
+var storeFailedErr = errors.New("store failed")
+
+// failingStore is a store whose Add always fails.
+type failingStore struct {
+	configuration.ConfigurationStore
+}
+
+func (fs failingStore) Add(configs ...configuration.Configuration) ([]configuration.Configuration, error) {
+	return nil, storeFailedErr
+}
+
+func (fs failingStore) As(actor string) configuration.ConfigurationStore {
+	return fs
+}
+
+func TestAddStoreFailure(t *testing.T) {
+	s := newServer(baseConfigs...)
+	s.Handler = s.auth.VerifySessions(New(failingStore{s.store}))
+	r := s.do("editor", "POST", "/", strings.NewReader(`{"name": "New", "hostname": "new.host", "port": 22, "username": "new"}`))
+	if r.Code != http.StatusInternalServerError {
+		t.Error("Failed:", failure{"Wrong status", http.StatusInternalServerError, r.Code})
+	}
+	var problem map[string]interface{}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&problem); err != nil || problem["code"] != response.CodeServerError {
+		t.Error("Failed:", failure{"Wrong problem", response.CodeServerError, problem})
+	}
+	if decoder.More() {
+		t.Error("Failed:", failure{"A body was sent after the problem", nil, r.Body.String()})
+	}
+}
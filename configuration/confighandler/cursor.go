@@ -0,0 +1,159 @@
+package confighandler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/warrenharper/restapi/configuration"
+)
+
+// defaultLimit is the size of a page when a cursor is given without a limit.
+const defaultLimit = 20
+
+var (
+	InvalidCursorErr = errors.New("Invalid cursor")
+	CursorSortErr    = errors.New("Cursor was created for a different sort")
+)
+
+// cursor is the position of a page of configurations. It is sent to clients
+// as an opaque token.
+type cursor struct {
+	Sort   string   `json:"s,omitempty"`
+	Values []string `json:"v,omitempty"`
+	ID     int      `json:"i"`
+
+	// Prev is true if the page ends before the position rather than
+	// starting after it.
+	Prev bool `json:"p,omitempty"`
+}
+
+// String returns the token of the cursor.
+func (c cursor) String() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// cursorAt returns the cursor of the page that starts after the configuration
+// or, if prev is true, ends before it.
+func cursorAt(config configuration.Configuration, sort configuration.Sort, prev bool) cursor {
+	position := configuration.PositionOf(config, sort)
+	return cursor{Sort: sort.String(), Values: position.Values, ID: position.ID, Prev: prev}
+}
+
+// parseCursor returns the cursor of the token.
+func parseCursor(token string) (c cursor, err error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return c, InvalidCursorErr
+	}
+	if err = json.Unmarshal(raw, &c); err != nil {
+		return c, InvalidCursorErr
+	}
+	return c, nil
+}
+
+// cursorParameters sets the position and limit of the options from the
+// "cursor" and "limit" parameters and returns the size of the page. The page
+// size is zero if neither parameter is present.
+func cursorParameters(params []parameter, opts *configuration.QueryOptions) (limit int, err error) {
+	var cursorParam, limitParam *parameter
+	for i := range params {
+		switch params[i].name {
+		case "cursor":
+			cursorParam = &params[i]
+		case "limit":
+			limitParam = &params[i]
+		}
+	}
+	if cursorParam == nil && limitParam == nil {
+		return 0, nil
+	}
+	if opts.Limit != 0 {
+		return 0, ParameterError{"page", errors.New("page cannot be used with a cursor or limit")}
+	}
+
+	limit = defaultLimit
+	if limitParam != nil {
+		limit, err = strconv.Atoi(limitParam.value)
+		if err != nil || limit < 1 || limit > maxPerPage {
+			return 0, ParameterError{limitParam.text, errors.New("limit must be a number from 1 to " + strconv.Itoa(maxPerPage))}
+		}
+	}
+
+	if cursorParam != nil {
+		if opts.Ranked() {
+			return 0, ParameterError{cursorParam.text, configuration.RankedPositionErr}
+		}
+		c, err := parseCursor(cursorParam.value)
+		if err != nil {
+			return 0, ParameterError{cursorParam.text, err}
+		}
+		if c.Sort != opts.Sort.String() {
+			return 0, ParameterError{cursorParam.text, CursorSortErr}
+		}
+
+		position := &configuration.Position{Values: c.Values, ID: c.ID}
+		if c.Prev {
+			opts.Before = position
+		} else {
+			opts.After = position
+		}
+	}
+
+	// One more configuration than the page holds is requested to find out
+	// if there is another page.
+	opts.Limit = limit + 1
+	return limit, nil
+}
+
+// paginate trims the configurations that were listed with the options to the
+// size of the page and sets the Link header of the response to the first,
+// previous and next pages.
+func paginate(w http.ResponseWriter, r *http.Request, opts configuration.QueryOptions, configs []configuration.Configuration, limit int) []configuration.Configuration {
+	more := len(configs) > limit
+	if more && opts.Before != nil {
+		configs = configs[1:]
+	} else if more {
+		configs = configs[:limit]
+	}
+
+	// Search results that are ordered by rank have no positions to link to.
+	links := []string{link(r, "", "first")}
+	if len(configs) > 0 && !opts.Ranked() {
+		if opts.Before != nil || more {
+			next := cursorAt(configs[len(configs)-1], opts.Sort, false)
+			links = append(links, link(r, next.String(), "next"))
+		}
+		if opts.After != nil || (opts.Before != nil && more) {
+			prev := cursorAt(configs[0], opts.Sort, true)
+			links = append(links, link(r, prev.String(), "prev"))
+		}
+	}
+	w.Header().Set("Link", strings.Join(links, ", "))
+	return configs
+}
+
+// link returns a link to the listing of the request at the cursor with the
+// relation. The parameters of the request other than the cursor are kept.
+func link(r *http.Request, token, rel string) string {
+	path := r.RequestURI
+	if index := strings.Index(path, "?"); index >= 0 {
+		path = path[:index]
+	}
+
+	terms := make([]string, 0)
+	params, _ := parseQuery(r.URL.RawQuery)
+	for _, param := range params {
+		if param.name != "cursor" {
+			terms = append(terms, param.raw)
+		}
+	}
+	if token != "" {
+		terms = append(terms, "cursor="+token)
+	}
+	return "<" + path + "?" + strings.Join(terms, "&") + `>; rel="` + rel + `"`
+}
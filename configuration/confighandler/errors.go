@@ -0,0 +1,71 @@
+package confighandler
+
+import (
+	"net/http"
+
+	"github.com/warrenharper/restapi/configuration"
+	"github.com/warrenharper/restapi/utils/response"
+)
+
+// BadParameter sends a problem with a 400 code for a malformed parameter.
+// The "parameter" member of the problem names the parameter if err is a
+// ParameterError.
+func BadParameter(w http.ResponseWriter, r *http.Request, err error) {
+	p := response.NewProblem(http.StatusBadRequest, response.CodeInvalidParameter, err.Error())
+	if pe, ok := err.(ParameterError); ok {
+		p = p.With("parameter", pe.Param)
+	}
+	response.WriteProblem(w, r, p)
+}
+
+// PreconditionFailed sends a problem with a 412 code for a request whose
+// precondition does not match the configuration.
+func PreconditionFailed(w http.ResponseWriter, r *http.Request) {
+	response.WriteProblem(w, r, problemFor(configuration.VersionMismatchErr))
+}
+
+// Conflict sends a problem with a 409 code whose "configurations" member
+// lists the configuration that already has the name.
+func Conflict(w http.ResponseWriter, r *http.Request, config configuration.Configuration) {
+	response.WriteProblem(w, r, problemFor(configuration.Error{Err: configuration.DuplicateConfigErr, Configuration: config}))
+}
+
+// UnprocessableEntity sends a problem with a 422 code whose "errors" member
+// lists the fields that are invalid.
+func UnprocessableEntity(w http.ResponseWriter, r *http.Request, ve configuration.ValidationError) {
+	response.WriteProblem(w, r, problemFor(ve))
+}
+
+// problemFor returns the problem that describes an error returned by a
+// ConfigurationStore. A failed test operation of a patch means the
+// configuration has changed so it is a conflict, and its "operation" and
+// "path" members name the operation. Errors that the client cannot cause are
+// server errors.
+func problemFor(err error) response.Problem {
+	switch e := err.(type) {
+	case configuration.Error:
+		if e.Err == configuration.DuplicateConfigErr {
+			p := response.NewProblem(http.StatusConflict, response.CodeConflict, configuration.DuplicateConfigErr.Error())
+			return p.With("configurations", []configuration.Configuration{e.Configuration})
+		}
+	case configuration.ValidationError:
+		p := response.NewProblem(http.StatusUnprocessableEntity, response.CodeValidationFailed, "The request has invalid fields")
+		return p.With("errors", e.Errors)
+	case configuration.PatchError:
+		p := response.NewProblem(http.StatusUnprocessableEntity, response.CodeInvalidPatch, e.Err.Error())
+		if e.Err == configuration.PatchTestFailedErr {
+			p = response.NewProblem(http.StatusConflict, response.CodeTestFailed, e.Err.Error())
+		}
+		return p.With("operation", e.Op).With("path", e.Path)
+	}
+
+	switch err {
+	case configuration.DoesNotExistErr:
+		return response.NewProblem(http.StatusNotFound, response.CodeNotFound, err.Error())
+	case configuration.VersionMismatchErr:
+		return response.NewProblem(http.StatusPreconditionFailed, response.CodePreconditionFailed, err.Error())
+	case configuration.ImportConflictErr:
+		return response.NewProblem(http.StatusConflict, response.CodeConflict, err.Error())
+	}
+	return response.NewProblem(http.StatusInternalServerError, response.CodeServerError, "The server failed to handle the request")
+}
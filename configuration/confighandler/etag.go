@@ -0,0 +1,85 @@
+package confighandler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/warrenharper/restapi/configuration"
+	"github.com/warrenharper/restapi/utils/response"
+)
+
+// etag returns the entity tag of the configuration's representation for the
+// request. It is the quoted id and version of the configuration, so that a
+// configuration that is deleted and created again has new tags, followed by
+// the name of the representation if it is not compact JSON, such as
+// "7-3-yaml".
+func etag(r *http.Request, config configuration.Configuration) string {
+	tag := strconv.Itoa(config.ID) + "-" + strconv.Itoa(config.Version)
+	if representation := response.Representation(r, configuration.Configurations{[]configuration.Configuration{config}}); representation != "" {
+		tag += "-" + representation
+	}
+	return strconv.Quote(tag)
+}
+
+// sameVersion returns a function that reports whether an entity tag is the
+// tag of any representation of the configuration's version.
+func sameVersion(config configuration.Configuration) func(tag string) bool {
+	prefix := strconv.Itoa(config.ID) + "-" + strconv.Itoa(config.Version)
+	return func(tag string) bool {
+		unquoted, err := strconv.Unquote(tag)
+		return err == nil && (unquoted == prefix || strings.HasPrefix(unquoted, prefix+"-"))
+	}
+}
+
+// matchesETag reports whether the list of entity tags in the header of an
+// If-Match or If-None-Match request contains a tag that match accepts. Weak
+// tags are only tried when weak is true, as If-Match requires the strong
+// comparison.
+func matchesETag(header string, weak bool, match func(tag string) bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.HasPrefix(candidate, "W/") {
+			if !weak {
+				continue
+			}
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if match(candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatch checks the If-Match header of the request against the
+// configuration with the name and returns the version that the request
+// expects to change, or 0 if the request has no If-Match header. The tag of
+// any representation of the current version matches. If the precondition
+// fails it sends a 412 code and returns false.
+func (ch Handler) ifMatch(w http.ResponseWriter, r *http.Request, configName string) (version int, ok bool) {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return 0, true
+	}
+
+	configs, err := ch.Get(configName)
+	if err == configuration.DoesNotExistErr {
+		PreconditionFailed(w, r)
+		return 0, false
+	}
+	if err != nil {
+		response.ServerError(w, r)
+		return 0, false
+	}
+
+	config := configuration.Configurations{configs}.GetFirst()
+	if !matchesETag(header, false, sameVersion(config)) {
+		PreconditionFailed(w, r)
+		return 0, false
+	}
+	return config.Version, true
+}
@@ -0,0 +1,160 @@
+package confighandler
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/warrenharper/restapi/configuration"
+	"github.com/warrenharper/restapi/configuration/sshconfig"
+	"github.com/warrenharper/restapi/utils/media"
+)
+
+// The formats that configurations can be exported and imported in.
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+	FormatCSV  = "csv"
+
+	// FormatSSHConfig is an OpenSSH client configuration, see sshconfig.
+	FormatSSHConfig = "ssh_config"
+)
+
+var UnknownFormatErr = errors.New("format must be json, yaml, csv or ssh_config")
+
+// formatTypes are the media types of the formats.
+var formatTypes = map[string]string{
+	FormatJSON:      media.JSON,
+	FormatYAML:      media.YAML,
+	FormatCSV:       media.CSV,
+	FormatSSHConfig: sshConfigType,
+}
+
+// sshConfigType is the media type of an OpenSSH client configuration, which
+// has none of its own.
+const sshConfigType = "text/plain"
+
+// acceptImport lists the Content-Types that an import can have.
+const acceptImport = media.JSON + ", " + media.YAML + ", " + media.CSV + ", " + sshConfigType
+
+// formatOf returns the format of a Content-Type or "" if it has none.
+func formatOf(header string) string {
+	mediaType := media.TypeOf(header)
+	for format, formatType := range formatTypes {
+		if formatType == mediaType {
+			return format
+		}
+	}
+	return ""
+}
+
+// encodeConfigs returns the configurations in the format. JSON and YAML have
+// the same shape as a list of configurations and CSV has its Rows.
+func encodeConfigs(format string, configs []configuration.Configuration) ([]byte, error) {
+	if format == FormatSSHConfig {
+		buff := &bytes.Buffer{}
+		err := sshconfig.Write(buff, configs)
+		return buff.Bytes(), err
+	}
+	return media.Encode(formatTypes[format], configuration.Configurations{configs}, true)
+}
+
+// decodeConfigs returns the configurations in the body, which is in the
+// format. A JSON or YAML body is either a list of configurations or an array
+// of them and an OpenSSH client configuration has one for each of its hosts.
+func decodeConfigs(format string, body io.Reader) (configs []configuration.Configuration, err error) {
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case FormatCSV:
+		return decodeCSV(raw)
+	case FormatSSHConfig:
+		return sshconfig.Parse(bytes.NewReader(raw))
+	}
+	if raw, err = media.ToJSON(formatTypes[format], raw); err != nil {
+		return nil, err
+	}
+
+	raw = bytes.TrimSpace(raw)
+	if len(raw) > 0 && raw[0] == '[' {
+		err = json.Unmarshal(raw, &configs)
+		return configs, err
+	}
+	var list configuration.Configurations
+	err = json.Unmarshal(raw, &list)
+	return list.Configs, err
+}
+
+// decodeCSV returns the configurations in the CSV. The first row names the
+// columns, which may be any of configuration.Columns in any order. Empty
+// cells are left unset.
+func decodeCSV(raw []byte) (configs []configuration.Configuration, err error) {
+	rows, err := csv.NewReader(bytes.NewReader(raw)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("the header row is missing")
+	}
+	header := rows[0]
+	for _, column := range header {
+		if !contains(configuration.Columns, column) {
+			return nil, fmt.Errorf("unknown column %q", column)
+		}
+	}
+
+	for index, row := range rows[1:] {
+		config := configuration.Configuration{}
+		for i, cell := range row {
+			if cell == "" {
+				continue
+			}
+			if err = setColumn(&config, header[i], cell); err != nil {
+				return nil, fmt.Errorf("row %d: %s", index+2, err.Error())
+			}
+		}
+		configs = append(configs, config)
+	}
+	return configs, nil
+}
+
+// setColumn sets the field of the configuration that the column holds.
+func setColumn(config *configuration.Configuration, column, cell string) (err error) {
+	switch column {
+	case "id":
+		config.ID, err = strconv.Atoi(cell)
+	case "name":
+		config.Name = cell
+	case "hostname":
+		config.HostName = cell
+	case "port":
+		config.Port, err = strconv.Atoi(cell)
+	case "username":
+		config.Username = cell
+	case "version":
+		config.Version, err = strconv.Atoi(cell)
+	case "labels":
+		config.Labels, err = configuration.ParseLabels(cell)
+	case "attributes":
+		err = json.Unmarshal([]byte(cell), &config.Attributes)
+	}
+	if err != nil {
+		return fmt.Errorf("%s is malformed", column)
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package confighandler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/warrenharper/restapi/configuration"
+	"github.com/warrenharper/restapi/utils/response"
+)
+
+// rollbackRequest is the body of a request to roll back a configuration.
+type rollbackRequest struct {
+	Revision int `json:"revision"`
+}
+
+// handleHistory sends every revision of the configuration whose name matches
+// the name in the url with a 200 code. If the configuration has never existed
+// sends a 404 code.
+func (ch Handler) handleHistory(w http.ResponseWriter, r *http.Request, configName string) {
+	revisions, err := ch.History(configName)
+	if err == configuration.DoesNotExistErr {
+		response.NotFound(w, r, configuration.DoesNotExistErr.Error())
+		return
+	}
+	if err != nil {
+		response.ServerError(w, r)
+		return
+	}
+
+	response.Respond(w, r, http.StatusOK, configuration.Revisions{Revisions: revisions})
+}
+
+// handleGetRevision sends the configuration whose name matches the name in
+// the url as it was right after the revision in the "revision" parameter or
+// at the RFC 3339 time in the "at" parameter with a 200 code. If the
+// configuration did not exist then sends a 404 code.
+func (ch Handler) handleGetRevision(w http.ResponseWriter, r *http.Request, configName string) {
+	revisions, err := ch.History(configName)
+	if err == configuration.DoesNotExistErr {
+		response.NotFound(w, r, configuration.DoesNotExistErr.Error())
+		return
+	}
+	if err != nil {
+		response.ServerError(w, r)
+		return
+	}
+
+	var config configuration.Configuration
+	if revision := r.FormValue("revision"); revision != "" {
+		id, convErr := strconv.Atoi(revision)
+		if convErr != nil {
+			BadParameter(w, r, ParameterError{"revision=" + revision, errors.New("revision must be a revision id")})
+			return
+		}
+		config, err = configuration.AtRevision(revisions, id)
+	} else {
+		at, parseErr := time.Parse(time.RFC3339, r.FormValue("at"))
+		if parseErr != nil {
+			BadParameter(w, r, ParameterError{"at=" + r.FormValue("at"), errors.New("at must be an RFC 3339 time")})
+			return
+		}
+		config, err = configuration.AsOf(revisions, at)
+	}
+
+	if err == configuration.DoesNotExistErr || err == configuration.RevisionDoesNotExistErr {
+		response.NotFound(w, r, err.Error())
+		return
+	}
+
+	response.Respond(w, r, http.StatusOK, configuration.Configurations{[]configuration.Configuration{config}})
+}
+
+// handleRollback restores the configuration whose name matches the name in
+// the url to how it was right after the revision in the request body and
+// sends it with a 200 code. The restoration is recorded as a new revision. If
+// the revision is not one of the configuration's revisions sends a 404 code.
+// If the restored name collides with another configuration sends a 409 code
+// with that configuration in the body of the response.
+func (ch Handler) handleRollback(w http.ResponseWriter, r *http.Request, configName string) {
+	var rr rollbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&rr); err != nil {
+		response.MalformedBody(w, r)
+		return
+	}
+
+	config, err := ch.store(r).Rollback(configName, rr.Revision)
+	if err == configuration.DoesNotExistErr || err == configuration.RevisionDoesNotExistErr {
+		response.NotFound(w, r, err.Error())
+		return
+	} else if confErr, ok := err.(configuration.Error); ok && confErr.Err == configuration.DuplicateConfigErr {
+		Conflict(w, r, confErr.Configuration)
+		return
+	} else if err != nil {
+		response.ServerError(w, r)
+		return
+	}
+
+	configs := make([]configuration.Configuration, 0, 1)
+	if config.Name != "" {
+		configs = append(configs, config)
+	}
+	response.Respond(w, r, http.StatusOK, configuration.Configurations{configs})
+}
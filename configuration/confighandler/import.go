@@ -0,0 +1,148 @@
+package confighandler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/warrenharper/restapi/configuration"
+	"github.com/warrenharper/restapi/utils/response"
+)
+
+// MaxImportSize is the most configurations an import can have.
+const MaxImportSize = 5000
+
+// importResult reports the action that an import took for a configuration.
+// The configuration is only sent for those that were created or updated.
+type importResult struct {
+	Name          string                       `json:"name"`
+	Action        string                       `json:"action"`
+	Configuration *configuration.Configuration `json:"configuration,omitempty"`
+}
+
+type importResponse struct {
+	DryRun  bool           `json:"dry_run"`
+	Summary map[string]int `json:"summary"`
+	Results []importResult `json:"results"`
+}
+
+// handleExport sends every configuration in the format of the "format"
+// parameter, JSON if there is none, with a 200 code. The response is sent as
+// an attachment named after the format. If the format is unknown sends a 400
+// code.
+func (ch Handler) handleExport(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = FormatJSON
+	}
+	if _, ok := formatTypes[format]; !ok {
+		BadParameter(w, r, ParameterError{"format", UnknownFormatErr})
+		return
+	}
+
+	configs, err := ch.GetAll()
+	if err != nil {
+		response.ServerError(w, r)
+		return
+	}
+	raw, err := encodeConfigs(format, configs)
+	if err != nil {
+		response.ServerError(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", formatTypes[format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "configurations."+format))
+	response.Write(w, http.StatusOK, raw)
+}
+
+// handleImport adds the configurations in the body, which is in the format
+// of the "format" parameter or else of the Content-Type, and sends the
+// action taken for each of them with a 200 code. The "conflict" parameter is
+// the policy for names that are taken: skip, overwrite or fail, the default.
+// If the "dry_run" parameter is true nothing is changed and the actions that
+// would be taken are sent.
+//
+// Either the whole import is made or none of it is. If a name is taken and
+// the policy is fail sends a 409 code whose "conflicts" member lists the
+// names. If a configuration fails sends its problem with an "index" member
+// that is its position. If the parameters or body are malformed sends a 400
+// code, if the Content-Type is not supported a 415 code and if there are no
+// configurations or too many a 422 code.
+func (ch Handler) handleImport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	policy := query.Get("conflict")
+	if policy == "" {
+		policy = configuration.ConflictFail
+	}
+	if policy != configuration.ConflictSkip && policy != configuration.ConflictOverwrite && policy != configuration.ConflictFail {
+		BadParameter(w, r, ParameterError{"conflict", configuration.UnknownConflictPolicyErr})
+		return
+	}
+	dryRun := false
+	if value := query.Get("dry_run"); value != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			BadParameter(w, r, ParameterError{"dry_run", err})
+			return
+		}
+	}
+
+	format := query.Get("format")
+	if format != "" {
+		if _, ok := formatTypes[format]; !ok {
+			BadParameter(w, r, ParameterError{"format", UnknownFormatErr})
+			return
+		}
+	} else if header := r.Header.Get("Content-Type"); header == "" {
+		format = FormatJSON
+	} else if format = formatOf(header); format == "" {
+		w.Header().Set("Accept-Post", acceptImport)
+		response.Error(w, r, http.StatusUnsupportedMediaType, response.CodeUnsupportedMedia, "Imports must have a Content-Type of "+acceptImport)
+		return
+	}
+
+	configs, err := decodeConfigs(format, r.Body)
+	if err != nil {
+		response.Error(w, r, http.StatusBadRequest, response.CodeMalformedBody, "The request body is not valid "+strings.ToUpper(format)+": "+err.Error())
+		return
+	}
+	if len(configs) == 0 || len(configs) > MaxImportSize {
+		message := fmt.Sprintf("configurations must have between 1 and %d configurations", MaxImportSize)
+		UnprocessableEntity(w, r, configuration.ValidationError{Errors: []configuration.FieldError{{Field: "configurations", Message: message}}})
+		return
+	}
+
+	results, err := configuration.Import(ch.store(r), configs, policy, dryRun)
+	if be, ok := err.(configuration.BatchError); ok {
+		response.WriteProblem(w, r, problemFor(be.Err).With("index", be.Index))
+		return
+	}
+	if err == configuration.ImportConflictErr && !dryRun {
+		conflicts := []string{}
+		for _, result := range results {
+			if result.Action == configuration.ImportConflict {
+				conflicts = append(conflicts, result.Name)
+			}
+		}
+		response.WriteProblem(w, r, problemFor(err).With("conflicts", conflicts))
+		return
+	}
+	if err != nil && err != configuration.ImportConflictErr {
+		response.ServerError(w, r)
+		return
+	}
+
+	ir := importResponse{DryRun: dryRun, Summary: map[string]int{}, Results: make([]importResult, len(results))}
+	for _, action := range []string{configuration.ImportCreate, configuration.ImportUpdate, configuration.ImportUnchanged, configuration.ImportSkip, configuration.ImportConflict} {
+		ir.Summary[action] = 0
+	}
+	for i, result := range results {
+		ir.Summary[result.Action]++
+		ir.Results[i] = importResult{Name: result.Name, Action: result.Action}
+		if !dryRun && (result.Action == configuration.ImportCreate || result.Action == configuration.ImportUpdate) {
+			ir.Results[i].Configuration = &results[i].Configuration
+		}
+	}
+	response.Respond(w, r, http.StatusOK, ir)
+}
@@ -0,0 +1,105 @@
+package confighandler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/warrenharper/restapi/configuration"
+	"github.com/warrenharper/restapi/utils/response"
+)
+
+// MaxLookupSize is the most names that a lookup can request.
+const MaxLookupSize = 1000
+
+// lookupRequest is the body of a lookup request.
+type lookupRequest struct {
+	Names []string `json:"names"`
+}
+
+// lookupResult lists the configurations that were found along with the
+// requested names that no configuration has.
+type lookupResult struct {
+	Configs []configuration.Configuration `json:"configurations"`
+	Missing []string                      `json:"missing"`
+}
+
+// handleLookup sends the configurations with the names in the body, in the
+// order of the names, and the names that no configuration has with a 200
+// code. If the body is malformed sends a 400 code and if it has no names or
+// too many a 422 code.
+func (ch Handler) handleLookup(w http.ResponseWriter, r *http.Request) {
+	var lr lookupRequest
+	if err := json.NewDecoder(r.Body).Decode(&lr); err != nil {
+		response.MalformedBody(w, r)
+		return
+	}
+	names := unique(lr.Names)
+	if len(names) == 0 || len(names) > MaxLookupSize {
+		message := fmt.Sprintf("names must have between 1 and %d names", MaxLookupSize)
+		UnprocessableEntity(w, r, configuration.ValidationError{Errors: []configuration.FieldError{{Field: "names", Message: message}}})
+		return
+	}
+
+	configs, missing, err := ch.lookup(names)
+	if err != nil {
+		response.ServerError(w, r)
+		return
+	}
+	response.Respond(w, r, http.StatusOK, lookupResult{configs, missing})
+}
+
+// lookup returns the configurations with the names in the order of the
+// names and the names that no configuration has.
+func (ch Handler) lookup(names []string) (configs []configuration.Configuration, missing []string, err error) {
+	found, err := ch.Get(names...)
+	if err != nil && err != configuration.DoesNotExistErr {
+		return configs, missing, err
+	}
+
+	byName := make(map[string]configuration.Configuration, len(found))
+	for _, config := range found {
+		byName[config.Name] = config
+	}
+	configs, missing = make([]configuration.Configuration, 0, len(found)), make([]string, 0)
+	for _, name := range names {
+		if config, ok := byName[name]; ok {
+			configs = append(configs, config)
+		} else {
+			missing = append(missing, name)
+		}
+	}
+	return configs, missing, nil
+}
+
+// requestedNames returns the names that the "name=" filter of the options
+// lists, leaving out patterns.
+func requestedNames(opts configuration.QueryOptions) []string {
+	var names []string
+	for _, filter := range opts.Filters {
+		if filter.Field != "name" || filter.Op != configuration.Equal {
+			continue
+		}
+		for _, value := range filter.Values {
+			if !strings.ContainsAny(value, "*?") {
+				names = append(names, value)
+			}
+		}
+	}
+	return unique(names)
+}
+
+// unique returns the non-empty names without duplicates in their first
+// order.
+func unique(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	result := make([]string, 0, len(names))
+	for _, name := range names {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			result = append(result, name)
+		}
+	}
+	return result
+}
@@ -0,0 +1,119 @@
+package confighandler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/warrenharper/restapi/configuration"
+	"github.com/warrenharper/restapi/utils/media"
+	"github.com/warrenharper/restapi/utils/request"
+	"github.com/warrenharper/restapi/utils/response"
+)
+
+const (
+	// MergePatchType is the Content-Type of an RFC 7396 JSON merge patch.
+	MergePatchType = "application/merge-patch+json"
+
+	// JSONPatchType is the Content-Type of an RFC 6902 JSON patch.
+	JSONPatchType = "application/json-patch+json"
+)
+
+// acceptBody lists the Content-Types that a configuration in a body can
+// have.
+const acceptBody = media.JSON + ", " + media.YAML + ", " + media.MsgPack
+
+// acceptPatch lists the Content-Types that a PATCH request can have.
+const acceptPatch = acceptBody + ", " + MergePatchType + ", " + JSONPatchType
+
+// decodePatch returns the patch in the body of a PATCH request. A body of
+// MergePatchType is a configuration.MergePatch and a body of JSONPatchType is
+// a configuration.JSONPatch. A JSON, YAML or MessagePack body, or a body
+// without a Content-Type, is a configuration whose fields that are set
+// replace the stored ones and whose set fields must be valid. If the body
+// cannot be decoded sends a 400 code, if the fields are invalid a 422 code
+// and if the Content-Type is not supported a 415 code, and returns false.
+func decodePatch(w http.ResponseWriter, r *http.Request) (configuration.Patch, bool) {
+	switch media.TypeOf(r.Header.Get("Content-Type")) {
+	case MergePatchType:
+		var patch json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			response.MalformedBody(w, r)
+			return nil, false
+		}
+		return configuration.MergePatch(patch), true
+	case JSONPatchType:
+		var patch configuration.JSONPatch
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			response.MalformedBody(w, r)
+			return nil, false
+		}
+		return patch, true
+	}
+
+	raw, err := request.JSONBody(r)
+	if err == media.UnsupportedTypeErr {
+		w.Header().Set("Accept-Patch", acceptPatch)
+		response.Error(w, r, http.StatusUnsupportedMediaType, response.CodeUnsupportedMedia, "PATCH requests must have a Content-Type of "+acceptPatch)
+		return nil, false
+	}
+	config := configuration.Configuration{}
+	if err != nil {
+		response.MalformedBody(w, r)
+		return nil, false
+	}
+	fields, err := decodeFields(bytes.NewReader(raw), &config)
+	if err != nil {
+		response.MalformedBody(w, r)
+		return nil, false
+	}
+	if err = config.ValidateFields(fields...); err != nil {
+		UnprocessableEntity(w, r, err.(configuration.ValidationError))
+		return nil, false
+	}
+	return config, true
+}
+
+// decodeBody decodes the JSON, YAML or MessagePack body of the request into
+// v by its Content-Type, JSON if it has none. If the Content-Type is not
+// supported sends a 415 code and if the body cannot be decoded a 400 code,
+// and returns false.
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	raw, err := request.JSONBody(r)
+	if err == media.UnsupportedTypeErr {
+		if r.Method == "POST" {
+			w.Header().Set("Accept-Post", acceptBody)
+		}
+		response.Error(w, r, http.StatusUnsupportedMediaType, response.CodeUnsupportedMedia, "The body must have a Content-Type of "+acceptBody)
+		return false
+	}
+	if err != nil || json.Unmarshal(raw, v) != nil {
+		response.MalformedBody(w, r)
+		return false
+	}
+	return true
+}
+
+// decodeFields decodes the JSON object in the body into the configuration
+// and returns the names of the fields that the object sets.
+func decodeFields(body io.Reader, config *configuration.Configuration) (fields []string, err error) {
+	var raw json.RawMessage
+	if err = json.NewDecoder(body).Decode(&raw); err != nil {
+		return fields, err
+	}
+	var set map[string]json.RawMessage
+	if err = json.Unmarshal(raw, &set); err != nil {
+		return fields, err
+	}
+	if err = json.Unmarshal(raw, config); err != nil {
+		return fields, err
+	}
+
+	for _, field := range configuration.Fields {
+		if _, ok := set[field]; ok {
+			fields = append(fields, field)
+		}
+	}
+	return fields, nil
+}
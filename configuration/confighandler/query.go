@@ -0,0 +1,224 @@
+package confighandler
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/warrenharper/restapi/configuration"
+	"github.com/warrenharper/restapi/utils/response"
+)
+
+// maxPerPage is the largest page that can be requested.
+const maxPerPage = 100
+
+// listParameters are the parameters of a listing that are not filters.
+var listParameters = map[string]bool{
+	"sort":        true,
+	"page":        true,
+	"per_page":    true,
+	"cursor":      true,
+	"limit":       true,
+	"ignore_case": true,
+	"natural":     true,
+	"q":           true,
+	"label":       true,
+}
+
+// operators are the operators of a filter parameter. Longer operators come
+// before their prefixes.
+var operators = []configuration.Operator{
+	configuration.NotEqual,
+	configuration.LessOrEqual,
+	configuration.GreaterOrEqual,
+	configuration.Equal,
+	configuration.Less,
+	configuration.Greater,
+}
+
+// ParameterError is returned for a malformed parameter. Param is the
+// parameter as it appears in the query string.
+type ParameterError struct {
+	Param string
+	Err   error
+}
+
+func (pe ParameterError) Error() string {
+	return fmt.Sprintf("Bad parameter %q: %s", pe.Param, pe.Err.Error())
+}
+
+// parameter is one term of a query string split around its operator. Raw is
+// the term as it appears in the query string and text is the term unescaped.
+type parameter struct {
+	raw   string
+	text  string
+	name  string
+	op    configuration.Operator
+	value string
+}
+
+// parseQuery splits the raw query string into its parameters. Unlike
+// url.ParseQuery it keeps the operator that separates a name from its value.
+// Names never contain an operator so the operator may be escaped.
+func parseQuery(rawQuery string) (params []parameter, err error) {
+	for _, raw := range strings.Split(rawQuery, "&") {
+		if raw == "" {
+			continue
+		}
+
+		term, err := url.QueryUnescape(raw)
+		if err != nil {
+			return params, ParameterError{raw, err}
+		}
+
+		param := parameter{raw: raw, text: term, name: term}
+		if index := strings.IndexAny(term, "!<>="); index >= 0 {
+			param.name = term[:index]
+			for _, op := range operators {
+				if strings.HasPrefix(term[index:], string(op)) {
+					param.op = op
+					param.value = term[index+len(op):]
+					break
+				}
+			}
+		}
+		params = append(params, param)
+	}
+	return params, nil
+}
+
+// queryOptions builds the options of a listing from the parameters of the
+// request. The "sort" parameter lists the fields to sort by, "page" and
+// "per_page" select a page and any parameter named after a field filters
+// the configurations by that field, such as "port>=1024" or
+// "hostname=*.example.com". A comma separated list of values matches any of
+// them, as do repeated "name=" parameters. The "label" parameter selects configurations by their labels, such
+// as "label=env=prod,team!=qa". The "q" parameter searches the configurations. The "cursor" and
+// "limit" parameters select a page by cursor in
+// which case the size of the page is returned. The "pretty" parameter is
+// left to the response. Errors name the parameter
+// that is malformed.
+func queryOptions(r *http.Request) (opts configuration.QueryOptions, limit int, err error) {
+	params, err := parseQuery(r.URL.RawQuery)
+	if err != nil {
+		return opts, 0, err
+	}
+
+	values := url.Values{}
+	for _, param := range params {
+		if param.name == response.PrettyParameter {
+			continue
+		}
+		if listParameters[param.name] {
+			if param.op != configuration.Equal {
+				return opts, 0, ParameterError{param.text, configuration.InvalidOperatorErr}
+			}
+			values.Add(param.name, param.value)
+			if param.name == "label" {
+				selectors, err := configuration.ParseSelectors(param.value)
+				if err != nil {
+					return opts, 0, ParameterError{param.text, err}
+				}
+				opts.Labels = append(opts.Labels, selectors...)
+			}
+			continue
+		}
+
+		filter := configuration.Filter{
+			Field:  param.name,
+			Op:     param.op,
+			Values: strings.Split(param.value, ","),
+		}
+		if err := filter.Validate(); err != nil {
+			return opts, 0, ParameterError{param.text, err}
+		}
+		if index := nameFilter(opts.Filters); filter.Field == "name" && filter.Op == configuration.Equal && index >= 0 {
+			opts.Filters[index].Values = append(opts.Filters[index].Values, filter.Values...)
+			continue
+		}
+		opts.Filters = append(opts.Filters, filter)
+	}
+
+	if err = sortParameters(values, &opts); err != nil {
+		return opts, 0, err
+	}
+	opts.Search = values.Get("q")
+
+	if err = handlePaginateParameters(values, &opts); err != nil {
+		return opts, 0, err
+	}
+	if limit, err = cursorParameters(params, &opts); err != nil {
+		return opts, 0, err
+	}
+
+	// The other parameters have been checked one by one, so what is left to
+	// fail is a cursor whose position does not suit the sort.
+	if err = opts.Validate(); err != nil {
+		if opts.After != nil || opts.Before != nil {
+			return opts, 0, ParameterError{"cursor", InvalidCursorErr}
+		}
+		return opts, 0, err
+	}
+	return opts, limit, nil
+}
+
+// nameFilter returns the index of the "name=" filter or -1 if there is none.
+func nameFilter(filters []configuration.Filter) int {
+	for index, filter := range filters {
+		if filter.Field == "name" && filter.Op == configuration.Equal {
+			return index
+		}
+	}
+	return -1
+}
+
+// sortParameters sets the sort of the options from the "sort" parameter,
+// which lists the fields to sort by such as "-port,name", and the
+// "ignore_case" and "natural" parameters, which turn on the options of the
+// sort.
+func sortParameters(values url.Values, opts *configuration.QueryOptions) (err error) {
+	if list := values.Get("sort"); list != "" {
+		if opts.Sort, err = configuration.ParseSort(list); err != nil {
+			return ParameterError{"sort=" + list, err}
+		}
+	}
+
+	for name, option := range map[string]*bool{"ignore_case": &opts.Sort.IgnoreCase, "natural": &opts.Sort.Natural} {
+		if value := values.Get(name); value != "" {
+			if *option, err = strconv.ParseBool(value); err != nil {
+				return ParameterError{name + "=" + value, errors.New(name + " must be true or false")}
+			}
+		}
+	}
+	return nil
+}
+
+// handlePaginateParameters sets the offset and limit of the options from the
+// "page" and "per_page" parameters, which must either both be present or
+// both be absent.
+func handlePaginateParameters(values url.Values, opts *configuration.QueryOptions) error {
+	pageParam, perPageParam := values.Get("page"), values.Get("per_page")
+	if pageParam == "" && perPageParam == "" {
+		return nil
+	}
+
+	pageNum, pnErr := strconv.Atoi(pageParam)
+	perPage, ppErr := strconv.Atoi(perPageParam)
+
+	switch {
+	case pnErr != nil || pageNum < 0:
+		return ParameterError{"page=" + pageParam, fmt.Errorf("page must be a number that is 0 or more")}
+	case ppErr != nil || perPage < 1 || perPage > maxPerPage:
+		return ParameterError{"per_page=" + perPageParam, fmt.Errorf("per_page must be a number from 1 to %d", maxPerPage)}
+	case pageNum > math.MaxInt/perPage:
+		return ParameterError{"page=" + pageParam, fmt.Errorf("page must be at most %d", math.MaxInt/perPage)}
+	}
+
+	opts.Offset = pageNum * perPage
+	opts.Limit = perPage
+	return nil
+}
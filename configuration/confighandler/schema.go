@@ -0,0 +1,47 @@
+package confighandler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/warrenharper/restapi/configuration"
+	"github.com/warrenharper/restapi/utils/response"
+)
+
+// handleGetSchema sends the schema that the attributes of configurations
+// must satisfy with a 200 code.
+func (ch Handler) handleGetSchema(w http.ResponseWriter, r *http.Request) {
+	schema, err := ch.Schema()
+	if err != nil {
+		response.ServerError(w, r)
+		return
+	}
+	response.Respond(w, r, http.StatusOK, schema)
+}
+
+// handleSetSchema replaces the schema that the attributes of configurations
+// must satisfy with the schema in the request body and sends it with a 200
+// code. If the schema is not a valid JSON Schema sends a 422 code listing
+// the problem.
+func (ch Handler) handleSetSchema(w http.ResponseWriter, r *http.Request) {
+	schema := configuration.AttributeSchema{}
+	if err := json.NewDecoder(r.Body).Decode(&schema); err != nil {
+		response.MalformedBody(w, r)
+		return
+	}
+	if len(schema.Schema) == 0 {
+		UnprocessableEntity(w, r, configuration.ValidationError{Errors: []configuration.FieldError{{Field: "schema", Message: "schema is required"}}})
+		return
+	}
+
+	schema, err := ch.store(r).SetSchema(schema)
+	if ve, ok := err.(configuration.ValidationError); ok {
+		UnprocessableEntity(w, r, ve)
+		return
+	}
+	if err != nil {
+		response.ServerError(w, r)
+		return
+	}
+	response.Respond(w, r, http.StatusOK, schema)
+}
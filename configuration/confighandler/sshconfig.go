@@ -0,0 +1,38 @@
+package confighandler
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/warrenharper/restapi/configuration/sshconfig"
+	"github.com/warrenharper/restapi/utils/response"
+)
+
+// handleSSHConfig sends the configurations that match the parameters of the
+// request, which are those of handleGetAll, as an OpenSSH client
+// configuration with a Host block for each of them and a 200 code. If the
+// parameters are malformed sends a 400 code.
+func (ch Handler) handleSSHConfig(w http.ResponseWriter, r *http.Request) {
+	opts, limit, err := queryOptions(r)
+	if err != nil {
+		BadParameter(w, r, err)
+		return
+	}
+
+	configs, err := ch.List(opts)
+	if err != nil {
+		response.ServerError(w, r)
+		return
+	}
+	if limit > 0 {
+		configs = paginate(w, r, opts, configs, limit)
+	}
+
+	buff := &bytes.Buffer{}
+	if err = sshconfig.Write(buff, configs); err != nil {
+		response.ServerError(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	response.Write(w, http.StatusOK, buff.Bytes())
+}
@@ -1,9 +1,36 @@
 package configuration
 
+import (
+	"strconv"
+)
+
+// Columns are the columns of the table of a list of configurations.
+var Columns = []string{"id", "name", "hostname", "port", "username", "version", "labels", "attributes"}
+
 type Configurations struct {
 	Configs []Configuration `json:"configurations"`
 }
 
+// Rows returns the configurations as a table whose first row is Columns.
+// The labels are written as by Labels.String and the attributes as JSON.
+func (cs Configurations) Rows() [][]string {
+	rows := [][]string{Columns}
+	for _, config := range cs.Configs {
+		attributes, _ := marshalAttributes(config.Attributes)
+		rows = append(rows, []string{
+			strconv.Itoa(config.ID),
+			config.Name,
+			config.HostName,
+			strconv.Itoa(config.Port),
+			config.Username,
+			strconv.Itoa(config.Version),
+			config.Labels.String(),
+			string(attributes),
+		})
+	}
+	return rows
+}
+
 // GetFirst retrieves the first configuration from the Configurations object.
 // If the length Configurations object's Configs is less than 1 it returns an
 // uninitialized struct.
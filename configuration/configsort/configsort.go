@@ -14,19 +14,21 @@ type Sorter struct {
 	Order   Orderer
 }
 
-// Sort sorts the configs according to the order that was given.
+// Sort sorts the configs according to the order that was given. Configs that
+// are equal in the order keep their relative positions.
 func (s *Sorter) Sort(o Orderer, configs []configuration.Configuration) []configuration.Configuration {
 	s.Configs = configs
 	s.Order = o
-	sort.Sort(s)
+	sort.Stable(s)
 	return s.Configs
 }
 
-// Sort reverse sorts the configs according to the order that was given.
+// Reverse sorts the configs in the reverse of the order that was given.
+// Configs that are equal in the order keep their relative positions.
 func (s *Sorter) Reverse(o Orderer, configs []configuration.Configuration) []configuration.Configuration {
 	s.Configs = configs
 	s.Order = o
-	sort.Reverse(s)
+	sort.Stable(sort.Reverse(s))
 	return s.Configs
 }
 
@@ -35,9 +37,7 @@ func (s Sorter) Len() int {
 }
 
 func (s Sorter) Swap(i, j int) {
-	temp := s.Configs[i]
-	s.Configs[i] = s.Configs[j]
-	s.Configs[j] = temp
+	s.Configs[i], s.Configs[j] = s.Configs[j], s.Configs[i]
 }
 
 func (s Sorter) Less(i, j int) bool {
@@ -65,5 +65,13 @@ func (s *Sorter) ByPort(i, j int) bool {
 // ByUsername returns true if the username of the configuration at index i is less than
 // the username of the configuration at index j.
 func (s *Sorter) ByUsername(i, j int) bool {
-	return s.Configs[i].Username < s.Configs[i].Username
+	return s.Configs[i].Username < s.Configs[j].Username
+}
+
+// By returns an Orderer that orders the configurations by the keys and
+// options of the sort, the same way that a ConfigurationStore lists them.
+func (s *Sorter) By(order configuration.Sort) Orderer {
+	return func(i, j int) bool {
+		return order.Compare(s.Configs[i], s.Configs[j]) < 0
+	}
 }
@@ -0,0 +1,93 @@
+package configsort
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/warrenharper/restapi/configuration"
+)
+
+type failure struct {
+	Prefix   string
+	Expected interface{}
+	Actual   interface{}
+}
+
+func (f failure) Error() string {
+	str := f.Prefix
+	if f.Expected != nil {
+		str += fmt.Sprintf("\n Expected: %v", f.Expected)
+	}
+
+	if f.Actual != nil {
+		str += fmt.Sprintf("\n Actual: %v", f.Actual)
+	}
+
+	return str
+}
+
+func baseConfigs() []configuration.Configuration {
+	return []configuration.Configuration{
+		{ID: 1, Name: "web10", HostName: "b.example.com", Port: 22, Username: "deploy"},
+		{ID: 2, Name: "Web2", HostName: "a.example.com", Port: 5432, Username: "postgres"},
+		{ID: 3, Name: "cache", HostName: "c.example.com", Port: 22, Username: "Admin"},
+		{ID: 4, Name: "web2", HostName: "a.example.com", Port: 25, Username: "deploy"},
+	}
+}
+
+// sortBy returns the sort of the list and options.
+func sortBy(list string, ignoreCase, natural bool) configuration.Sort {
+	s, err := configuration.ParseSort(list)
+	if err != nil {
+		panic(err)
+	}
+	s.IgnoreCase, s.Natural = ignoreCase, natural
+	return s
+}
+
+var sortTests = map[string]struct {
+	order    func(*Sorter) Orderer
+	reverse  bool
+	expected []int
+}{
+	"TestByName":              {func(s *Sorter) Orderer { return s.ByName }, false, []int{2, 3, 1, 4}},
+	"TestByHostName":          {func(s *Sorter) Orderer { return s.ByHostName }, false, []int{2, 4, 1, 3}},
+	"TestByPort":              {func(s *Sorter) Orderer { return s.ByPort }, false, []int{1, 3, 4, 2}},
+	"TestByUsername":          {func(s *Sorter) Orderer { return s.ByUsername }, false, []int{3, 1, 4, 2}},
+	"TestReverseByName":       {func(s *Sorter) Orderer { return s.ByName }, true, []int{4, 1, 3, 2}},
+	"TestReverseByHostName":   {func(s *Sorter) Orderer { return s.ByHostName }, true, []int{3, 1, 2, 4}},
+	"TestReverseByPort":       {func(s *Sorter) Orderer { return s.ByPort }, true, []int{2, 4, 1, 3}},
+	"TestReverseByUsername":   {func(s *Sorter) Orderer { return s.ByUsername }, true, []int{2, 1, 4, 3}},
+	"TestByMultipleKeys":      {func(s *Sorter) Orderer { return s.By(sortBy("port,name", false, false)) }, false, []int{3, 1, 4, 2}},
+	"TestByDescendingKey":     {func(s *Sorter) Orderer { return s.By(sortBy("-port,name", false, false)) }, false, []int{2, 4, 3, 1}},
+	"TestByMixedKeys":         {func(s *Sorter) Orderer { return s.By(sortBy("hostname,-name", false, false)) }, false, []int{4, 2, 1, 3}},
+	"TestByTiesOrderedByID":   {func(s *Sorter) Orderer { return s.By(sortBy("hostname", false, false)) }, false, []int{2, 4, 1, 3}},
+	"TestByIgnoreCase":        {func(s *Sorter) Orderer { return s.By(sortBy("username", true, false)) }, false, []int{3, 1, 4, 2}},
+	"TestByNatural":           {func(s *Sorter) Orderer { return s.By(sortBy("name", false, true)) }, false, []int{2, 3, 4, 1}},
+	"TestByNaturalIgnoreCase": {func(s *Sorter) Orderer { return s.By(sortBy("name", true, true)) }, false, []int{3, 2, 4, 1}},
+	"TestByDescendingID":      {func(s *Sorter) Orderer { return s.By(sortBy("-id", false, false)) }, false, []int{4, 3, 2, 1}},
+}
+
+func TestSort(t *testing.T) {
+	for name, test := range sortTests {
+		s := &Sorter{Configs: baseConfigs()}
+		order := test.order(s)
+
+		var configs []configuration.Configuration
+		if test.reverse {
+			configs = s.Reverse(order, s.Configs)
+		} else {
+			configs = s.Sort(order, s.Configs)
+		}
+
+		ids := make([]string, 0, len(configs))
+		for _, config := range configs {
+			ids = append(ids, fmt.Sprint(config.ID))
+		}
+		expected := strings.Trim(fmt.Sprint(test.expected), "[]")
+		if strings.Join(ids, " ") != expected {
+			t.Errorf("%s Failed: %s", name, failure{"", expected, strings.Join(ids, " ")})
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 
 	"github.com/lib/pq"
+	"github.com/xeipuuv/gojsonschema"
 )
 
 const (
@@ -15,9 +16,16 @@ const (
 
 var DuplicateConfigErr = errors.New("Configuration exists with the same name")
 var DoesNotExistErr = errors.New("Configuration does not exist")
+var VersionMismatchErr = errors.New("Configuration has been changed since the given version")
 
+// ConfigurationController is a ConfigurationStore that stores the
+// configurations in Postgres.
 type ConfigurationController struct {
 	*sql.DB
+
+	// Actor is recorded as the author of the revisions made by the
+	// controller.
+	Actor string
 }
 
 type Error struct {
@@ -30,16 +38,48 @@ func (ce Error) Error() string {
 }
 
 type Configuration struct {
-	ID       int    `json:"id,omitempty""`
+	ID       int    `json:"id,omitempty"`
 	Name     string `json:"name,omitempty"`
 	HostName string `json:"hostname,omitempty"`
 	Port     int    `json:"port,omitempty"`
 	Username string `json:"username,omitempty"`
+
+	// Labels group configurations and can be used to select them.
+	Labels Labels `json:"labels,omitempty"`
+
+	// Attributes are the custom fields of the configuration.
+	Attributes Attributes `json:"attributes,omitempty"`
+
+	// Version starts at 1 and is incremented every time the configuration
+	// changes.
+	Version int `json:"version,omitempty"`
+}
+
+// configColumns are the columns of a configuration in the order scanConfig
+// reads them. The labels are aggregated into a JSON object.
+const configColumns = `id, config_name, host_name, username, port, version, attributes,
+  (SELECT json_object_agg(key, value) FROM configuration_labels WHERE config_id = configurations.id) AS labels`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanConfig reads a row of configColumns into the config.
+func scanConfig(row scanner, config *Configuration) (err error) {
+	var attributes, labels []byte
+	if err = row.Scan(&config.ID, &config.Name, &config.HostName, &config.Username, &config.Port, &config.Version, &attributes, &labels); err != nil {
+		return err
+	}
+	if config.Attributes, err = unmarshalAttributes(attributes); err != nil {
+		return err
+	}
+	config.Labels, err = scanLabels(labels)
+	return err
 }
 
 // GetAll returns a list of all of the stored configurations
 func (cc *ConfigurationController) GetAll() (configs []Configuration, err error) {
-	rows, err := cc.DB.Query("SELECT id, config_name, host_name, username, port FROM configurations ORDER BY id ASC")
+	rows, err := cc.DB.Query("SELECT " + configColumns + " FROM configurations ORDER BY id ASC")
 	configs = make([]Configuration, 0)
 	if err == sql.ErrNoRows {
 		return configs, nil
@@ -49,7 +89,7 @@ func (cc *ConfigurationController) GetAll() (configs []Configuration, err error)
 	defer rows.Close()
 	for rows.Next() {
 		config := Configuration{}
-		err = rows.Scan(&config.ID, &config.Name, &config.HostName, &config.Username, &config.Port)
+		err = scanConfig(rows, &config)
 		if err == nil {
 			configs = append(configs, config)
 		}
@@ -57,6 +97,42 @@ func (cc *ConfigurationController) GetAll() (configs []Configuration, err error)
 	return configs, rows.Err()
 }
 
+// List returns the configurations that match the options. The filtering,
+// sorting and paging is done by the database.
+func (cc *ConfigurationController) List(opts QueryOptions) (configs []Configuration, err error) {
+	configs = make([]Configuration, 0)
+	if err = opts.Validate(); err != nil {
+		return configs, err
+	}
+
+	query, args := buildListQuery(opts)
+	rows, err := cc.DB.Query(query, args...)
+	if err != nil {
+		return configs, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		config := Configuration{}
+		if err := scanConfig(rows, &config); err != nil {
+			return configs, err
+		}
+		configs = append(configs, config)
+	}
+	return configs, rows.Err()
+}
+
+// Count returns the number of configurations that match the filters and
+// search of the options.
+func (cc *ConfigurationController) Count(opts QueryOptions) (count int, err error) {
+	if err = opts.Validate(); err != nil {
+		return count, err
+	}
+	query, args := buildCountQuery(opts)
+	err = cc.DB.QueryRow(query, args...).Scan(&count)
+	return count, err
+}
+
 // Get returns a configuration that matches the name in the argument. If no such
 // configuration exists a DoesNotExistError is returned.
 func (cc *ConfigurationController) Get(names ...string) (configs []Configuration, err error) {
@@ -76,7 +152,7 @@ func (cc *ConfigurationController) Get(names ...string) (configs []Configuration
 
 	for rows.Next() {
 		config := Configuration{}
-		err := rows.Scan(&config.ID, &config.Name, &config.HostName, &config.Username, &config.Port)
+		err := scanConfig(rows, &config)
 		if err != nil {
 			return configs, err
 		}
@@ -94,38 +170,24 @@ func (cc *ConfigurationController) Get(names ...string) (configs []Configuration
 }
 
 // Add attempts to add all of the configurations in the argument to the database. It returns
-// a list of the names of the configurations that have been added. It return a
+// a list of the configurations that have been added and records a revision for each. It return a
 // Error with an Err of DuplicateConfigError on the addition of a configuration
-// that has the same name of an existing configuration.
+// that has the same name of an existing configuration and a ValidationError
+// if the attributes of a configuration do not satisfy the schema.
 func (cc *ConfigurationController) Add(configs ...Configuration) (configsAdded []Configuration, err error) {
-	var (
-		tx   *sql.Tx
-		stmt *sql.Stmt
-	)
-	tx, err = cc.DB.Begin()
+	tx, err := cc.DB.Begin()
 	if err != nil {
-		tx.Rollback()
 		return configsAdded, err
 	}
 
-	stmt, err = tx.Prepare("INSERT INTO configurations(config_name, host_name, username, port) VALUES($1,$2,$3,$4)")
+	schema, err := compileSchema(tx)
 	if err != nil {
 		tx.Rollback()
 		return configsAdded, err
 	}
 
 	for _, config := range configs {
-		_, err = stmt.Exec(config.Name, config.HostName, config.Username, config.Port)
-
-		if err != nil {
-			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == uniqueViolation {
-				conflicts, _ := cc.Get(config.Name)
-				config := Configurations{conflicts}.GetFirst()
-				err = Error{
-					Err:           DuplicateConfigErr,
-					Configuration: config,
-				}
-			}
+		if config, err = cc.add(tx, schema, config); err != nil {
 			tx.Rollback()
 			return configsAdded, err
 		}
@@ -137,30 +199,53 @@ func (cc *ConfigurationController) Add(configs ...Configuration) (configsAdded [
 
 }
 
-// Delete will delete all of the configurations whose name is in the list
-// of names in the arugment. It will not return an error if the name is not found.
-func (cc *ConfigurationController) Delete(names ...string) (err error) {
-	var (
-		tx   *sql.Tx
-		stmt *sql.Stmt
-	)
-	tx, err = cc.DB.Begin()
+// add inserts the configuration and its labels in the transaction and
+// records a revision.
+func (cc *ConfigurationController) add(tx *sql.Tx, schema *gojsonschema.Schema, config Configuration) (Configuration, error) {
+	var attributes []byte
+	err := validateAttributes(schema, config)
+	if err == nil {
+		config.Attributes = copyAttributes(config.Attributes)
+		attributes, err = marshalAttributes(config.Attributes)
+	}
 	if err != nil {
-		tx.Rollback()
-		return err
+		return config, err
 	}
 
-	stmt, err = tx.Prepare("DELETE FROM configurations where config_name = $1")
+	err = tx.QueryRow(
+		"INSERT INTO configurations(config_name, host_name, username, port, version, attributes) VALUES($1,$2,$3,$4,1,$5) RETURNING id, version",
+		config.Name, config.HostName, config.Username, config.Port, attributes).Scan(&config.ID, &config.Version)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == uniqueViolation {
+			conflicts, _ := cc.Get(config.Name)
+			err = Error{
+				Err:           DuplicateConfigErr,
+				Configuration: Configurations{conflicts}.GetFirst(),
+			}
+		}
+		return config, err
+	}
+
+	config.Labels = copyLabels(config.Labels)
+	if err = saveLabels(tx, config.ID, config.Labels); err != nil {
+		return config, err
+	}
+	return config, cc.recordRevision(tx, ActionAdd, nil, &config)
+}
+
+// Delete will delete all of the configurations whose name is in the list
+// of names in the arugment. It will not return an error if the name is not found.
+// A revision is recorded for every configuration that is deleted.
+func (cc *ConfigurationController) Delete(names ...string) (err error) {
+	tx, err := cc.DB.Begin()
 	if err != nil {
-		tx.Rollback()
 		return err
 	}
 
 	for _, name := range names {
-		_, err := stmt.Exec(name)
-
-		if err == sql.ErrNoRows {
-			err = nil
+		err = cc.remove(tx, name, 0)
+		if err == DoesNotExistErr {
+			continue
 		}
 		if err != nil {
 			tx.Rollback()
@@ -172,76 +257,121 @@ func (cc *ConfigurationController) Delete(names ...string) (err error) {
 
 }
 
-// Modify modifies the field of configuration with the same name as the name
-// argument to match the fields of the second argument. All fields that are
-// not set will retain their values. A configuration with the updated fields
-// will be returned.
-func (cc *ConfigurationController) Modify(name string, config Configuration) (newConfig Configuration, err error) {
-	var (
-		tx           *sql.Tx
-		actualConfig Configuration
-	)
-
-	tx, err = cc.DB.Begin()
+// DeleteVersion deletes the configuration with the name if its version
+// matches the version argument. If it does not VersionMismatchErr is
+// returned and if there is no such configuration DoesNotExistErr is returned.
+func (cc *ConfigurationController) DeleteVersion(name string, version int) (err error) {
+	tx, err := cc.DB.Begin()
 	if err != nil {
+		return err
+	}
+	if err = cc.remove(tx, name, version); err != nil {
 		tx.Rollback()
-		return newConfig, err
+		return err
 	}
+	return tx.Commit()
+}
 
-	err = tx.QueryRow("SELECT id, config_name, host_name, username, port FROM configurations WHERE config_name = $1", name).Scan(&actualConfig.ID, &actualConfig.Name, &actualConfig.HostName, &actualConfig.Username, &actualConfig.Port)
-
+// remove deletes the configuration with the name in the transaction and
+// records a revision. If version is not 0 it must match the version of the
+// configuration. The configuration is read before it is deleted so that its
+// labels, which are deleted with it, are recorded in the revision.
+func (cc *ConfigurationController) remove(tx *sql.Tx, name string, version int) error {
+	config := Configuration{}
+	row := tx.QueryRow("SELECT "+configColumns+" FROM configurations WHERE config_name = $1 FOR UPDATE", name)
+	err := scanConfig(row, &config)
 	if err == sql.ErrNoRows {
-		err = DoesNotExistErr
+		return DoesNotExistErr
+	}
+	if err != nil {
+		return err
+	}
+	if version != 0 && config.Version != version {
+		return VersionMismatchErr
+	}
+
+	if _, err = tx.Exec("DELETE FROM configurations WHERE id = $1", config.ID); err != nil {
+		return err
 	}
+	return cc.recordRevision(tx, ActionDelete, &config, nil)
+}
+
+// Modify applies the patch to the configuration with the same name as the
+// name argument while its row is locked, so that the patch is made to the
+// latest version and no other change can be made in between. The updated
+// configuration is returned and the change is recorded as a revision. If the
+// attributes do not satisfy the schema a ValidationError is returned. Errors
+// of the patch, such as VersionMismatchErr or a PatchError, are returned as
+// they are.
+func (cc *ConfigurationController) Modify(name string, patch Patch) (newConfig Configuration, err error) {
+	tx, err := cc.DB.Begin()
 	if err != nil {
+		return newConfig, err
+	}
+	if newConfig, err = cc.modify(tx, name, patch); err != nil {
 		tx.Rollback()
 		return newConfig, err
 	}
+	return newConfig, tx.Commit()
+}
 
-	if config.Name == "" {
-		config.Name = actualConfig.Name
+// modify applies the patch to the configuration with the name in the
+// transaction and records a revision.
+func (cc *ConfigurationController) modify(tx *sql.Tx, name string, patch Patch) (config Configuration, err error) {
+	actualConfig := Configuration{}
+	row := tx.QueryRow("SELECT "+configColumns+" FROM configurations WHERE config_name = $1 FOR UPDATE", name)
+	err = scanConfig(row, &actualConfig)
+	if err == sql.ErrNoRows {
+		return config, DoesNotExistErr
 	}
-
-	if config.HostName == "" {
-		config.HostName = actualConfig.HostName
+	if err != nil {
+		return config, err
 	}
 
-	if config.Username == "" {
-		config.Username = actualConfig.Username
+	if config, err = patch.Apply(actualConfig); err != nil {
+		return config, err
 	}
+	config.ID, config.Version = actualConfig.ID, actualConfig.Version+1
 
-	if config.Port == 0 {
-		config.Port = actualConfig.Port
+	schema, err := compileSchema(tx)
+	if err == nil {
+		err = validateAttributes(schema, config)
+	}
+	var attributes []byte
+	if err == nil {
+		attributes, err = marshalAttributes(config.Attributes)
+	}
+	if err != nil {
+		return config, err
 	}
 
 	_, err = tx.Exec(
-		`UPDATE configurations 
-         SET 
+		`UPDATE configurations
+         SET
            config_name = $1,
            host_name = $2,
            username = $3,
-           port = $4
+           port = $4,
+           version = $5,
+           attributes = $6
         WHERE
-          config_name = $5`, config.Name, config.HostName, config.Username, config.Port, name)
+          config_name = $7`, config.Name, config.HostName, config.Username, config.Port, config.Version, attributes, name)
 
 	if err != nil {
 		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == uniqueViolation {
 			conflicts, _ := cc.Get(config.Name)
-			config := Configurations{conflicts}.GetFirst()
 			err = Error{
 				Err:           DuplicateConfigErr,
-				Configuration: config,
+				Configuration: Configurations{conflicts}.GetFirst(),
 			}
-		} else if err == sql.ErrNoRows {
-			err = DoesNotExistErr
 		}
-		tx.Rollback()
-		return newConfig, err
+		return config, err
 	}
 
-	tx.Commit()
-	return config, nil
-
+	if err = saveLabels(tx, config.ID, config.Labels); err != nil {
+		return config, err
+	}
+	return config, cc.recordRevision(tx, ActionModify, &actualConfig, &config)
 }
 
 func buildGetQuery(names ...string) (query string, args []interface{}) {
@@ -249,7 +379,7 @@ func buildGetQuery(names ...string) (query string, args []interface{}) {
 		return query, args
 	}
 	args = make([]interface{}, 0, len(names))
-	buff := bytes.NewBufferString("SELECT id, config_name, host_name, username, port FROM configurations WHERE config_name = $1")
+	buff := bytes.NewBufferString("SELECT " + configColumns + " FROM configurations WHERE config_name = $1")
 	args = append(args, names[0])
 
 	for index, name := range names[1:] {
@@ -2,6 +2,7 @@ package configuration
 
 import (
 	"database/sql"
+	"flag"
 	"fmt"
 	"log"
 	"testing"
@@ -9,6 +10,8 @@ import (
 	_ "github.com/lib/pq"
 )
 
+var postgres = flag.Bool("postgres", false, "run the store tests against the apitest database")
+
 type failure struct {
 	Prefix   string
 	Expected interface{}
@@ -27,6 +30,8 @@ func SetupDB() *sql.DB {
 func ResetDB(db *sql.DB) {
 	db.Exec("DELETE FROM users")
 	db.Exec("DELETE FROM configurations")
+	db.Exec("TRUNCATE configuration_revisions")
+	db.Exec("DELETE FROM attribute_schema")
 	db.Exec("DELETE FROM sessions")
 }
 
@@ -58,11 +63,11 @@ var baseExpected = []Configuration{
 }
 
 var tests = map[string]struct {
-	test     func(*ConfigurationController, []Configuration) error
+	test     func(ConfigurationStore, []Configuration) error
 	expected []Configuration
 }{
 	"TestEmptyConfigs": {
-		test: func(cc *ConfigurationController, expected []Configuration) error {
+		test: func(cc ConfigurationStore, expected []Configuration) error {
 			configs, err := cc.GetAll()
 			if len(configs) != len(expected) {
 				return failure{"Configs length does not match", len(expected), len(configs)}
@@ -73,15 +78,11 @@ var tests = map[string]struct {
 	},
 
 	"TestGetAll": {
-		test: func(cc *ConfigurationController, expected []Configuration) error {
+		test: func(cc ConfigurationStore, expected []Configuration) error {
 			for _, config := range expected {
-				_, err := cc.DB.Exec(`
-	                         INSERT INTO configurations(config_name, host_name, port, username) VALUES ($1, $2, $3, $4)`,
-					config.Name, config.HostName, config.Port, config.Username)
-				if err != nil {
+				if _, err := cc.Add(config); err != nil {
 					return err
 				}
-
 			}
 
 			configs, err := cc.GetAll()
@@ -103,7 +104,7 @@ var tests = map[string]struct {
 	},
 
 	"TestAddOne": {
-		test: func(cc *ConfigurationController, expected []Configuration) error {
+		test: func(cc ConfigurationStore, expected []Configuration) error {
 			configs, err := cc.Add(expected...)
 			names := make([]string, 0, len(expected))
 			if err != nil {
@@ -131,7 +132,7 @@ var tests = map[string]struct {
 	},
 
 	"TestAddMultiple": {
-		test: func(cc *ConfigurationController, expected []Configuration) error {
+		test: func(cc ConfigurationStore, expected []Configuration) error {
 			configs, err := cc.Add(expected...)
 			names := make([]string, 0, len(expected))
 			if err != nil {
@@ -158,7 +159,7 @@ var tests = map[string]struct {
 		expected: baseExpected,
 	},
 	"TestAddCollision": {
-		test: func(cc *ConfigurationController, data []Configuration) error {
+		test: func(cc ConfigurationStore, data []Configuration) error {
 			_, err := cc.Add(data...)
 			if err, ok := err.(Error); !ok || err.Err != DuplicateConfigErr {
 				return failure{"Errors do not match",
@@ -168,12 +169,11 @@ var tests = map[string]struct {
 					},
 					err}
 			}
-			count := -1
-			err = cc.DB.QueryRow("SELECT COUNT(id) from configurations").Scan(&count)
+			configs, err := cc.GetAll()
 			if err != nil {
 				return err
 			}
-			if count != 0 {
+			if count := len(configs); count != 0 {
 				return failure{"Too many configurations in DB", 0, count}
 			}
 
@@ -192,7 +192,7 @@ var tests = map[string]struct {
 		},
 	},
 	"Delete": {
-		test: func(cc *ConfigurationController, data []Configuration) error {
+		test: func(cc ConfigurationStore, data []Configuration) error {
 			expected := make([]Configuration, 0, len(data))
 			toDelete := make([]Configuration, 0, 4)
 			expected = append(append(expected, data[0:4]...), data[7])
@@ -224,7 +224,7 @@ var tests = map[string]struct {
 		expected: baseExpected,
 	},
 	"DeleteNonexisting": {
-		test: func(cc *ConfigurationController, data []Configuration) error {
+		test: func(cc ConfigurationStore, data []Configuration) error {
 			if _, err := cc.Add(data...); err != nil {
 				return err
 			}
@@ -237,7 +237,7 @@ var tests = map[string]struct {
 	},
 
 	"TestModify": {
-		test: func(cc *ConfigurationController, data []Configuration) error {
+		test: func(cc ConfigurationStore, data []Configuration) error {
 
 			_, err := cc.Add(data...)
 			if err != nil {
@@ -271,7 +271,7 @@ var tests = map[string]struct {
 	},
 
 	"TestModifyAllFields": {
-		test: func(cc *ConfigurationController, data []Configuration) error {
+		test: func(cc ConfigurationStore, data []Configuration) error {
 			_, err := cc.Add(data...)
 			expectedConfig := Configuration{
 				Name:     "Something else",
@@ -307,7 +307,7 @@ var tests = map[string]struct {
 		expected: baseExpected[:1],
 	},
 	"TestModifyNonExisting": {
-		test: func(cc *ConfigurationController, data []Configuration) error {
+		test: func(cc ConfigurationStore, data []Configuration) error {
 			_, err := cc.Add(data...)
 			expectedConfig := Configuration{
 				Name:     "Something else",
@@ -333,10 +333,61 @@ var tests = map[string]struct {
 		},
 		expected: baseExpected[:1],
 	},
+
+	"TestVersions": {
+		test: func(cc ConfigurationStore, expected []Configuration) error {
+			configs, err := cc.Add(expected...)
+			if err != nil {
+				return err
+			}
+			if configs[0].Version != 1 {
+				return failure{"Wrong version after adding", 1, configs[0].Version}
+			}
+
+			config, err := cc.Modify(expected[0].Name, Configuration{Port: 22})
+			if err != nil {
+				return err
+			}
+			if config.Version != 2 {
+				return failure{"Wrong version after modifying", 2, config.Version}
+			}
+
+			if _, err := cc.Modify(expected[0].Name, Configuration{Port: 23, Version: 1}); err != VersionMismatchErr {
+				return failure{"Stale modification was not rejected", VersionMismatchErr, err}
+			}
+			if config, err = cc.Modify(expected[0].Name, Configuration{Port: 23, Version: 2}); err != nil || config.Version != 3 {
+				return failure{"Current modification was rejected", 3, err}
+			}
+			return nil
+		},
+		expected: baseExpected[:1],
+	},
+
+	"TestDeleteVersion": {
+		test: func(cc ConfigurationStore, expected []Configuration) error {
+			if _, err := cc.Add(expected...); err != nil {
+				return err
+			}
+			if err := cc.DeleteVersion(expected[0].Name, 2); err != VersionMismatchErr {
+				return failure{"Stale deletion was not rejected", VersionMismatchErr, err}
+			}
+			if err := cc.DeleteVersion(expected[0].Name, 1); err != nil {
+				return err
+			}
+			if err := cc.DeleteVersion(expected[0].Name, 1); err != DoesNotExistErr {
+				return failure{"Deleted configuration still exists", DoesNotExistErr, err}
+			}
+			return nil
+		},
+		expected: baseExpected[:1],
+	},
 }
 
 func TestConfiguration(t *testing.T) {
-	cc := &ConfigurationController{SetupDB()}
+	if !*postgres {
+		t.Skip("run with -postgres to test against the apitest database")
+	}
+	cc := &ConfigurationController{DB: SetupDB()}
 	for name, test := range tests {
 		if err := test.test(cc, test.expected); err != nil {
 			t.Errorf("%s Failed: %s", name, err.Error())
@@ -345,3 +396,57 @@ func TestConfiguration(t *testing.T) {
 	}
 
 }
+
+func TestMemoryStore(t *testing.T) {
+	for name, test := range tests {
+		if err := test.test(NewMemoryStore(), test.expected); err != nil {
+			t.Errorf("%s Failed: %s", name, err.Error())
+		}
+	}
+}
+
+// storeTest tests a store that holds the seed configurations of its table
+// and returns why it failed.
+type storeTest func(cs ConfigurationStore) error
+
+// runStoreTests runs every test against a new MemoryStore and, when run with
+// -postgres, against the apitest database after it is reset. The seed
+// configurations are added to the store before each test.
+func runStoreTests(t *testing.T, tests map[string]storeTest, seed []Configuration) {
+	t.Run("Memory", func(t *testing.T) {
+		runStore(t, tests, seed, func() ConfigurationStore { return NewMemoryStore() })
+	})
+	t.Run("Postgres", func(t *testing.T) {
+		if !*postgres {
+			t.Skip("run with -postgres to test against the apitest database")
+		}
+		cc := &ConfigurationController{DB: SetupDB()}
+		runStore(t, tests, seed, func() ConfigurationStore {
+			ResetDB(cc.DB)
+			return cc
+		})
+	})
+}
+
+func runStore(t *testing.T, tests map[string]storeTest, seed []Configuration, newStore func() ConfigurationStore) {
+	for name, test := range tests {
+		cs := newStore()
+		if len(seed) > 0 {
+			if _, err := cs.Add(seed...); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := test(cs); err != nil {
+			t.Errorf("%s Failed: %s", name, err)
+		}
+	}
+}
+
+// configNames returns the names of the configurations in order.
+func configNames(configs []Configuration) []string {
+	names := make([]string, 0, len(configs))
+	for _, config := range configs {
+		names = append(names, config.Name)
+	}
+	return names
+}
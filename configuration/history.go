@@ -0,0 +1,271 @@
+package configuration
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	ActionAdd      = "add"
+	ActionModify   = "modify"
+	ActionDelete   = "delete"
+	ActionRollback = "rollback"
+)
+
+var RevisionDoesNotExistErr = errors.New("Revision does not exist")
+
+// now is used in place of time.Now so that tests can control the clock.
+var now = time.Now
+
+// Revision is an immutable record of a change to a configuration. Before is
+// nil for additions and After is nil for deletions.
+type Revision struct {
+	ID              int            `json:"id"`
+	ConfigurationID int            `json:"configuration_id"`
+	Action          string         `json:"action"`
+	Actor           string         `json:"actor"`
+	CreatedAt       time.Time      `json:"created_at"`
+	Before          *Configuration `json:"before"`
+	After           *Configuration `json:"after"`
+}
+
+type Revisions struct {
+	Revisions []Revision `json:"revisions"`
+}
+
+// AtRevision returns the configuration as it was right after the revision
+// with the id. If the revisions do not contain the id
+// RevisionDoesNotExistErr is returned and if the configuration was deleted
+// by the revision DoesNotExistErr is returned.
+func AtRevision(revisions []Revision, id int) (config Configuration, err error) {
+	for _, revision := range revisions {
+		if revision.ID != id {
+			continue
+		}
+		if revision.After == nil {
+			return config, DoesNotExistErr
+		}
+		return *revision.After, nil
+	}
+	return config, RevisionDoesNotExistErr
+}
+
+// AsOf returns the configuration as it was at the time. The revisions must be
+// ordered by id. If the configuration did not exist at the time
+// DoesNotExistErr is returned.
+func AsOf(revisions []Revision, at time.Time) (config Configuration, err error) {
+	var latest *Revision
+	for i, revision := range revisions {
+		if revision.CreatedAt.After(at) {
+			break
+		}
+		latest = &revisions[i]
+	}
+	if latest == nil || latest.After == nil {
+		return config, DoesNotExistErr
+	}
+	return *latest.After, nil
+}
+
+// As returns a ConfigurationController that records actor as the author of
+// the revisions it makes.
+func (cc *ConfigurationController) As(actor string) ConfigurationStore {
+	return &ConfigurationController{DB: cc.DB, Actor: actor}
+}
+
+// History returns every revision of the configuration with the name ordered
+// by id. The name may also be the name of a deleted configuration. If the
+// configuration has no revisions DoesNotExistErr is returned.
+func (cc *ConfigurationController) History(name string) (revisions []Revision, err error) {
+	revisions = make([]Revision, 0)
+	id, err := configID(cc.DB, name)
+	if err != nil {
+		return revisions, err
+	}
+
+	rows, err := cc.DB.Query("SELECT id, config_id, action, actor, created_at, before, after FROM configuration_revisions WHERE config_id = $1 ORDER BY id ASC", id)
+	if err != nil {
+		return revisions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			revision      Revision
+			before, after []byte
+		)
+		if err := rows.Scan(&revision.ID, &revision.ConfigurationID, &revision.Action, &revision.Actor, &revision.CreatedAt, &before, &after); err != nil {
+			return revisions, err
+		}
+		if revision.Before, err = unmarshalConfig(before); err != nil {
+			return revisions, err
+		}
+		if revision.After, err = unmarshalConfig(after); err != nil {
+			return revisions, err
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, rows.Err()
+}
+
+// Rollback restores the configuration with the name to how it was right
+// after the revision with the id. The restoration is recorded as a new
+// revision. The attributes are restored even if they no longer satisfy the
+// schema. If restoring the configuration's name would collide with another
+// configuration an Error with an Err of DuplicateConfigErr is returned.
+func (cc *ConfigurationController) Rollback(name string, revisionID int) (config Configuration, err error) {
+	tx, err := cc.DB.Begin()
+	if err != nil {
+		return config, err
+	}
+
+	config, err = cc.rollback(tx, name, revisionID)
+	if err != nil {
+		tx.Rollback()
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == uniqueViolation {
+			conflicts, _ := cc.Get(config.Name)
+			err = Error{
+				Err:           DuplicateConfigErr,
+				Configuration: Configurations{conflicts}.GetFirst(),
+			}
+		}
+		return config, err
+	}
+	return config, tx.Commit()
+}
+
+func (cc *ConfigurationController) rollback(tx *sql.Tx, name string, revisionID int) (config Configuration, err error) {
+	id, err := configID(tx, name)
+	if err != nil {
+		return config, err
+	}
+
+	var after []byte
+	err = tx.QueryRow("SELECT after FROM configuration_revisions WHERE id = $1 AND config_id = $2", revisionID, id).Scan(&after)
+	if err == sql.ErrNoRows {
+		err = RevisionDoesNotExistErr
+	}
+	if err != nil {
+		return config, err
+	}
+	target, err := unmarshalConfig(after)
+	if err != nil {
+		return config, err
+	}
+
+	var (
+		actual  Configuration
+		current *Configuration
+	)
+	err = scanConfig(tx.QueryRow("SELECT "+configColumns+" FROM configurations WHERE id = $1 FOR UPDATE", id), &actual)
+	switch err {
+	case nil:
+		current = &actual
+	case sql.ErrNoRows:
+		// A deleted configuration continues from the version it was
+		// deleted at.
+		err = tx.QueryRow(
+			`SELECT COALESCE((before->>'version')::int, 0) FROM configuration_revisions
+             WHERE config_id = $1 ORDER BY id DESC LIMIT 1`, id).Scan(&actual.Version)
+		if err != nil {
+			return config, err
+		}
+	default:
+		return config, err
+	}
+	if target != nil {
+		target.Version = actual.Version + 1
+	}
+
+	var attributes []byte
+	if target != nil {
+		config = *target
+		if attributes, err = marshalAttributes(config.Attributes); err != nil {
+			return config, err
+		}
+	}
+
+	switch {
+	case target == nil && current == nil:
+		return config, DoesNotExistErr
+	case target == nil:
+		_, err = tx.Exec("DELETE FROM configurations WHERE id = $1", id)
+	case current == nil:
+		_, err = tx.Exec("INSERT INTO configurations(id, config_name, host_name, username, port, version, attributes) VALUES($1,$2,$3,$4,$5,$6,$7)", id, config.Name, config.HostName, config.Username, config.Port, config.Version, attributes)
+	default:
+		_, err = tx.Exec("UPDATE configurations SET config_name = $1, host_name = $2, username = $3, port = $4, version = $5, attributes = $6 WHERE id = $7", config.Name, config.HostName, config.Username, config.Port, config.Version, attributes, id)
+	}
+	if err == nil && target != nil {
+		err = saveLabels(tx, id, config.Labels)
+	}
+	if err != nil {
+		return config, err
+	}
+
+	return config, cc.recordRevision(tx, ActionRollback, current, target)
+}
+
+// recordRevision adds a revision from before to after to the
+// configuration_revisions table.
+func (cc *ConfigurationController) recordRevision(tx *sql.Tx, action string, before, after *Configuration) error {
+	var (
+		id   int
+		name string
+	)
+	if after != nil {
+		id, name = after.ID, after.Name
+	} else {
+		id, name = before.ID, before.Name
+	}
+
+	beforeJson, err := marshalConfig(before)
+	if err != nil {
+		return err
+	}
+	afterJson, err := marshalConfig(after)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO configuration_revisions(config_id, config_name, action, actor, created_at, before, after)
+         VALUES($1, $2, $3, $4, $5, $6, $7)`, id, name, action, cc.Actor, now(), beforeJson, afterJson)
+	return err
+}
+
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// configID returns the id of the configuration with the name. If no
+// configuration has the name, the id of the configuration that most recently
+// had the name is returned.
+func configID(db queryRower, name string) (id int, err error) {
+	err = db.QueryRow("SELECT id FROM configurations WHERE config_name = $1", name).Scan(&id)
+	if err == sql.ErrNoRows {
+		err = db.QueryRow("SELECT config_id FROM configuration_revisions WHERE config_name = $1 ORDER BY id DESC LIMIT 1", name).Scan(&id)
+	}
+	if err == sql.ErrNoRows {
+		err = DoesNotExistErr
+	}
+	return id, err
+}
+
+func marshalConfig(config *Configuration) ([]byte, error) {
+	if config == nil {
+		return nil, nil
+	}
+	return json.Marshal(config)
+}
+
+func unmarshalConfig(raw []byte) (*Configuration, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	config := &Configuration{}
+	return config, json.Unmarshal(raw, config)
+}
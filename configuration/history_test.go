@@ -0,0 +1,159 @@
+package configuration
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+var historyTests = map[string]storeTest{
+	"TestHistoryRecordsActors": func(cs ConfigurationStore) error {
+		cs.As("alice").Add(baseExpected[0])
+		cs.As("bob").Modify("Config1", Configuration{Port: 22})
+		cs.As("carol").Delete("Config1")
+
+		revisions, err := cs.History("Config1")
+		if err != nil {
+			return failure{"Unexpected error", nil, err}
+		}
+
+		actions := []string{}
+		actors := []string{}
+		for _, revision := range revisions {
+			actions = append(actions, revision.Action)
+			actors = append(actors, revision.Actor)
+		}
+		if expected := []string{ActionAdd, ActionModify, ActionDelete}; !reflect.DeepEqual(actions, expected) {
+			return failure{"Wrong actions", expected, actions}
+		}
+		if expected := []string{"alice", "bob", "carol"}; !reflect.DeepEqual(actors, expected) {
+			return failure{"Wrong actors", expected, actors}
+		}
+		if revisions[1].Before.Port != 1 || revisions[1].After.Port != 22 {
+			return failure{"Wrong modification", baseExpected[0], revisions[1]}
+		}
+		return nil
+	},
+	"TestHistoryFollowsRenames": func(cs ConfigurationStore) error {
+		cs.Add(baseExpected[0])
+		cs.Modify("Config1", Configuration{Name: "Renamed"})
+
+		for _, name := range []string{"Config1", "Renamed"} {
+			revisions, err := cs.History(name)
+			if err != nil {
+				return failure{"Unexpected error for " + name, nil, err}
+			}
+			if len(revisions) != 2 {
+				return failure{"Wrong number of revisions for " + name, 2, len(revisions)}
+			}
+		}
+		return nil
+	},
+	"TestHistoryUnknown": func(cs ConfigurationStore) error {
+		if _, err := cs.History("Config1"); err != DoesNotExistErr {
+			return failure{"Wrong error", DoesNotExistErr, err}
+		}
+		return nil
+	},
+	"TestRollbackModify": func(cs ConfigurationStore) error {
+		cs.Add(baseExpected[0])
+		revisions, _ := cs.History("Config1")
+		cs.Modify("Config1", Configuration{Name: "Renamed", Port: 22})
+
+		config, err := cs.As("alice").Rollback("Renamed", revisions[0].ID)
+		if err != nil {
+			return failure{"Unexpected error", nil, err}
+		}
+		if config.Name != "Config1" || config.Port != 1 {
+			return failure{"Wrong configuration", baseExpected[0], config}
+		}
+		if _, err := cs.Get("Renamed"); err != DoesNotExistErr {
+			return failure{"Renamed configuration still exists", DoesNotExistErr, err}
+		}
+
+		revisions, _ = cs.History("Config1")
+		last := revisions[len(revisions)-1]
+		if last.Action != ActionRollback || last.Actor != "alice" {
+			return failure{"Rollback not recorded", ActionRollback, last}
+		}
+		return nil
+	},
+	"TestRollbackDelete": func(cs ConfigurationStore) error {
+		added, _ := cs.Add(baseExpected[0])
+		revisions, _ := cs.History("Config1")
+		cs.Delete("Config1")
+
+		config, err := cs.Rollback("Config1", revisions[0].ID)
+		if err != nil {
+			return failure{"Unexpected error", nil, err}
+		}
+		if config.ID != added[0].ID {
+			return failure{"Restored configuration has a new id", added[0].ID, config.ID}
+		}
+		if config.Version != 2 {
+			return failure{"Restored configuration did not get a new version", 2, config.Version}
+		}
+		if configs, err := cs.Get("Config1"); err != nil || configs[0].ID != added[0].ID {
+			return failure{"Configuration not restored", added[0], configs}
+		}
+		return nil
+	},
+	"TestRollbackDuplicate": func(cs ConfigurationStore) error {
+		cs.Add(baseExpected[0])
+		revisions, _ := cs.History("Config1")
+		cs.Modify("Config1", Configuration{Name: "Renamed"})
+		cs.Add(baseExpected[0])
+
+		_, err := cs.Rollback("Renamed", revisions[0].ID)
+		if confErr, ok := err.(Error); !ok || confErr.Err != DuplicateConfigErr {
+			return failure{"Wrong error", DuplicateConfigErr, err}
+		}
+		return nil
+	},
+	"TestRollbackUnknownRevision": func(cs ConfigurationStore) error {
+		cs.Add(baseExpected[0], baseExpected[1])
+		revisions, _ := cs.History("Config2")
+
+		if _, err := cs.Rollback("Config1", revisions[0].ID); err != RevisionDoesNotExistErr {
+			return failure{"Wrong error", RevisionDoesNotExistErr, err}
+		}
+		return nil
+	},
+}
+
+func TestHistory(t *testing.T) {
+	runStoreTests(t, historyTests, nil)
+}
+
+func TestAsOf(t *testing.T) {
+	defer func() { now = time.Now }()
+
+	start := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	ms := NewMemoryStore()
+	for i, step := range []func(){
+		func() { ms.Add(baseExpected[0]) },
+		func() { ms.Modify("Config1", Configuration{Port: 22}) },
+		func() { ms.Delete("Config1") },
+	} {
+		now = func() time.Time { return start.Add(time.Duration(i) * time.Hour) }
+		step()
+	}
+	revisions, _ := ms.History("Config1")
+
+	tests := map[string]struct {
+		at   time.Time
+		port int
+		err  error
+	}{
+		"TestBeforeAdd":   {start.Add(-time.Minute), 0, DoesNotExistErr},
+		"TestAfterAdd":    {start.Add(30 * time.Minute), 1, nil},
+		"TestAfterModify": {start.Add(time.Hour), 22, nil},
+		"TestAfterDelete": {start.Add(3 * time.Hour), 0, DoesNotExistErr},
+	}
+	for name, test := range tests {
+		config, err := AsOf(revisions, test.at)
+		if err != test.err || config.Port != test.port {
+			t.Errorf("%s Failed: %s", name, failure{"", test.port, config.Port})
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package configuration
+
+import (
+	"errors"
+	"reflect"
+)
+
+// The conflict policies of an import decide what happens to a configuration
+// whose name is already taken.
+const (
+	ConflictSkip      = "skip"
+	ConflictOverwrite = "overwrite"
+	ConflictFail      = "fail"
+)
+
+// The actions that an import takes for a configuration.
+const (
+	ImportCreate    = "create"
+	ImportUpdate    = "update"
+	ImportUnchanged = "unchanged"
+	ImportSkip      = "skip"
+	ImportConflict  = "conflict"
+)
+
+var UnknownConflictPolicyErr = errors.New("Conflict policy must be skip, overwrite or fail")
+var ImportConflictErr = errors.New("Configurations exist with the same names")
+
+// ImportResult is the action that an import takes for a configuration. The
+// Configuration is the configuration that was created or updated, or that
+// is in the way of a skip or conflict.
+type ImportResult struct {
+	Name          string
+	Action        string
+	Configuration Configuration
+}
+
+// Import adds the configurations to the store, deciding by the policy what
+// to do with those whose names are taken: ConflictSkip leaves them alone,
+// ConflictOverwrite replaces them unless they are unchanged and ConflictFail
+// imports nothing if there are any. The IDs and versions of the
+// configurations are ignored. Every change is made in one atomic Batch so
+// either the whole import is made or none of it is.
+//
+// A result is returned for every configuration in order. If dryRun is set
+// the results are returned without making any changes. If a configuration
+// is invalid or its name appears twice a BatchError with its index is
+// returned, and with ConflictFail ImportConflictErr is returned along with
+// the results when a name is taken.
+func Import(cs ConfigurationStore, configs []Configuration, policy string, dryRun bool) (results []ImportResult, err error) {
+	if policy != ConflictSkip && policy != ConflictOverwrite && policy != ConflictFail {
+		return nil, UnknownConflictPolicyErr
+	}
+	all, err := cs.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]Configuration, len(all))
+	for _, config := range all {
+		existing[config.Name] = config
+	}
+
+	var ops []Operation
+	var indexes []int
+	var conflicts bool
+	seen := make(map[string]bool, len(configs))
+	for index, config := range configs {
+		config.ID, config.Version = 0, 0
+		if err := config.Validate(); err != nil {
+			return nil, BatchError{index, err}
+		}
+		if seen[config.Name] {
+			return nil, BatchError{index, Error{DuplicateConfigErr, config}}
+		}
+		seen[config.Name] = true
+
+		result := ImportResult{Name: config.Name, Action: ImportCreate, Configuration: config}
+		actual, exists := existing[config.Name]
+		switch {
+		case !exists:
+			ops = append(ops, Operation{Op: OpCreate, Name: config.Name, Configuration: config})
+			indexes = append(indexes, index)
+		case policy == ConflictSkip:
+			result.Action, result.Configuration = ImportSkip, actual
+		case policy == ConflictFail:
+			result.Action, result.Configuration = ImportConflict, actual
+			conflicts = true
+		case sameContent(actual, config):
+			result.Action, result.Configuration = ImportUnchanged, actual
+		default:
+			result.Action = ImportUpdate
+			ops = append(ops, Operation{Op: OpUpdate, Name: config.Name, Version: actual.Version, Patch: Replacement(config)})
+			indexes = append(indexes, index)
+		}
+		results = append(results, result)
+	}
+	if conflicts {
+		return results, ImportConflictErr
+	}
+	if dryRun || len(ops) == 0 {
+		return results, nil
+	}
+
+	opResults, err := cs.Batch(ops, true)
+	if be, ok := err.(BatchError); ok {
+		return nil, BatchError{indexes[be.Index], be.Err}
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i, opResult := range opResults {
+		results[indexes[i]].Configuration = opResult.Configuration
+	}
+	return results, nil
+}
+
+// sameContent determines if the fields, labels and attributes of two
+// configurations are equal.
+func sameContent(x, y Configuration) bool {
+	return EqualConfigurations(x, y) &&
+		reflect.DeepEqual(copyLabels(x.Labels), copyLabels(y.Labels)) &&
+		reflect.DeepEqual(copyAttributes(x.Attributes), copyAttributes(y.Attributes))
+}
@@ -0,0 +1,137 @@
+package configuration
+
+import (
+	"reflect"
+	"testing"
+)
+
+var importConfigs = []Configuration{
+	{Name: "cache", HostName: "cache.example.com", Port: 6379, Username: "redis"},
+	{ID: 9, Name: "web", HostName: "web.example.com", Port: 2222, Username: "deploy", Version: 7},
+	{Name: "db", HostName: "db.example.com", Port: 5432, Username: "postgres"},
+}
+
+// importActions returns the actions of the results.
+func importActions(results []ImportResult) []string {
+	actions := []string{}
+	for _, result := range results {
+		actions = append(actions, result.Action)
+	}
+	return actions
+}
+
+var importTests = map[string]storeTest{
+	"TestImportSkip": func(cs ConfigurationStore) error {
+		results, err := Import(cs, importConfigs, ConflictSkip, false)
+		if err != nil {
+			return err
+		}
+		expected := []string{ImportCreate, ImportSkip, ImportSkip}
+		if actions := importActions(results); !reflect.DeepEqual(actions, expected) {
+			return failure{"Wrong actions", expected, actions}
+		}
+		configs, err := cs.Get("web")
+		if err != nil {
+			return err
+		}
+		if configs[0].Port != 22 {
+			return failure{"Skipped configuration was changed", 22, configs[0].Port}
+		}
+		if _, err := cs.Get("cache"); err != nil {
+			return failure{"Configuration was not created", nil, err}
+		}
+		return nil
+	},
+
+	"TestImportOverwrite": func(cs ConfigurationStore) error {
+		results, err := Import(cs, importConfigs, ConflictOverwrite, false)
+		if err != nil {
+			return err
+		}
+		expected := []string{ImportCreate, ImportUpdate, ImportUnchanged}
+		if actions := importActions(results); !reflect.DeepEqual(actions, expected) {
+			return failure{"Wrong actions", expected, actions}
+		}
+		if results[1].Configuration.Port != 2222 || results[1].Configuration.Version != 2 {
+			return failure{"Configuration was not replaced", 2222, results[1].Configuration}
+		}
+		configs, err := cs.Get("db")
+		if err != nil {
+			return err
+		}
+		if configs[0].Version != 1 {
+			return failure{"Unchanged configuration was modified", 1, configs[0].Version}
+		}
+		return nil
+	},
+
+	"TestImportFail": func(cs ConfigurationStore) error {
+		results, err := Import(cs, importConfigs, ConflictFail, false)
+		if err != ImportConflictErr {
+			return failure{"Wrong error", ImportConflictErr, err}
+		}
+		expected := []string{ImportCreate, ImportConflict, ImportConflict}
+		if actions := importActions(results); !reflect.DeepEqual(actions, expected) {
+			return failure{"Wrong actions", expected, actions}
+		}
+		if _, err := cs.Get("cache"); err != DoesNotExistErr {
+			return failure{"Configuration was created", DoesNotExistErr, err}
+		}
+		return nil
+	},
+
+	"TestImportDryRun": func(cs ConfigurationStore) error {
+		results, err := Import(cs, importConfigs, ConflictOverwrite, true)
+		if err != nil {
+			return err
+		}
+		expected := []string{ImportCreate, ImportUpdate, ImportUnchanged}
+		if actions := importActions(results); !reflect.DeepEqual(actions, expected) {
+			return failure{"Wrong actions", expected, actions}
+		}
+		configs, err := cs.GetAll()
+		if err != nil {
+			return err
+		}
+		if len(configs) != 2 || configs[0].Port != 22 {
+			return failure{"Dry run made changes", batchConfigs, configs}
+		}
+		return nil
+	},
+
+	"TestImportInvalid": func(cs ConfigurationStore) error {
+		configs := []Configuration{importConfigs[0], {Name: "search"}}
+		_, err := Import(cs, configs, ConflictOverwrite, false)
+		if be, ok := err.(BatchError); !ok || be.Index != 1 {
+			return failure{"Wrong error", BatchError{Index: 1}, err}
+		}
+		if _, err := cs.Get("cache"); err != DoesNotExistErr {
+			return failure{"Configuration was created", DoesNotExistErr, err}
+		}
+		return nil
+	},
+
+	"TestImportDuplicateNames": func(cs ConfigurationStore) error {
+		configs := []Configuration{importConfigs[0], importConfigs[0]}
+		_, err := Import(cs, configs, ConflictOverwrite, false)
+		be, ok := err.(BatchError)
+		if !ok || be.Index != 1 {
+			return failure{"Wrong error", BatchError{Index: 1}, err}
+		}
+		if configErr, ok := be.Err.(Error); !ok || configErr.Err != DuplicateConfigErr {
+			return failure{"Wrong error", DuplicateConfigErr, be.Err}
+		}
+		return nil
+	},
+
+	"TestImportUnknownPolicy": func(cs ConfigurationStore) error {
+		if _, err := Import(cs, importConfigs, "merge", false); err != UnknownConflictPolicyErr {
+			return failure{"Wrong error", UnknownConflictPolicyErr, err}
+		}
+		return nil
+	},
+}
+
+func TestImport(t *testing.T) {
+	runStoreTests(t, importTests, batchConfigs)
+}
@@ -0,0 +1,192 @@
+package configuration
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var InvalidLabelErr = errors.New("Label keys and values may only contain letters, digits, '.', '_' and '-', keys may also contain '/', and neither may be longer than 63 characters")
+
+var (
+	labelKeyPattern   = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]{0,61}[A-Za-z0-9])?$`)
+	labelValuePattern = regexp.MustCompile(`^([A-Za-z0-9]([A-Za-z0-9._-]{0,61}[A-Za-z0-9])?)?$`)
+)
+
+// Labels are key/value pairs that group configurations, such as env=prod or
+// team=payments.
+type Labels map[string]string
+
+// Validate returns InvalidLabelErr if a key or value is malformed.
+func (l Labels) Validate() error {
+	for key, value := range l {
+		if !labelKeyPattern.MatchString(key) || !labelValuePattern.MatchString(value) {
+			return InvalidLabelErr
+		}
+	}
+	return nil
+}
+
+// copyLabels returns a copy of the labels or nil if there are none.
+func copyLabels(l Labels) Labels {
+	if len(l) == 0 {
+		return nil
+	}
+	labels := make(Labels, len(l))
+	for key, value := range l {
+		labels[key] = value
+	}
+	return labels
+}
+
+// String returns the labels as "key=value" pairs separated by commas,
+// sorted by key.
+func (l Labels) String() string {
+	pairs := make([]string, 0, len(l))
+	for key, value := range l {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// ParseLabels returns the labels of "key=value" pairs separated by commas,
+// as written by String. It returns InvalidLabelErr if a pair is malformed.
+func ParseLabels(list string) (Labels, error) {
+	labels := Labels{}
+	for _, pair := range strings.Split(list, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, InvalidLabelErr
+		}
+		labels[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return labels, labels.Validate()
+}
+
+// LabelOperator is how a LabelSelector compares the labels of a
+// configuration.
+type LabelOperator string
+
+const (
+	LabelEquals    LabelOperator = "="
+	LabelNotEquals LabelOperator = "!="
+	LabelExists    LabelOperator = "exists"
+	LabelNotExists LabelOperator = "!exists"
+)
+
+// LabelSelector matches configurations by one of their labels. LabelEquals
+// matches the configurations whose label with the key has the value and
+// LabelNotEquals matches the rest. LabelExists and LabelNotExists match the
+// configurations that have or lack a label with the key.
+type LabelSelector struct {
+	Key   string
+	Op    LabelOperator
+	Value string
+}
+
+// ParseSelectors returns the selectors of a comma separated list such as
+// "env=prod,team!=qa,critical,!deprecated". It returns InvalidLabelErr if a
+// selector is malformed.
+func ParseSelectors(list string) (selectors []LabelSelector, err error) {
+	for _, requirement := range strings.Split(list, ",") {
+		requirement = strings.TrimSpace(requirement)
+		var selector LabelSelector
+		switch {
+		case strings.Contains(requirement, "!="):
+			parts := strings.SplitN(requirement, "!=", 2)
+			selector = LabelSelector{Key: parts[0], Op: LabelNotEquals, Value: parts[1]}
+		case strings.Contains(requirement, "="):
+			parts := strings.SplitN(requirement, "=", 2)
+			selector = LabelSelector{Key: parts[0], Op: LabelEquals, Value: strings.TrimPrefix(parts[1], "=")}
+		case strings.HasPrefix(requirement, "!"):
+			selector = LabelSelector{Key: requirement[1:], Op: LabelNotExists}
+		default:
+			selector = LabelSelector{Key: requirement, Op: LabelExists}
+		}
+
+		if err := selector.Validate(); err != nil {
+			return selectors, err
+		}
+		selectors = append(selectors, selector)
+	}
+	return selectors, nil
+}
+
+// Validate returns InvalidLabelErr if the key or value of the selector is
+// malformed and InvalidOperatorErr if its operator is unknown.
+func (ls LabelSelector) Validate() error {
+	switch ls.Op {
+	case LabelEquals, LabelNotEquals, LabelExists, LabelNotExists:
+	default:
+		return InvalidOperatorErr
+	}
+	return Labels{ls.Key: ls.Value}.Validate()
+}
+
+// matches reports whether the labels satisfy the selector.
+func (ls LabelSelector) matches(labels Labels) bool {
+	value, ok := labels[ls.Key]
+	switch ls.Op {
+	case LabelEquals:
+		return ok && value == ls.Value
+	case LabelNotEquals:
+		return !ok || value != ls.Value
+	case LabelExists:
+		return ok
+	case LabelNotExists:
+		return !ok
+	}
+	return false
+}
+
+// writeSelector writes the SQL condition of the selector to the buffer and
+// returns the arguments with the selector's key and value appended.
+func writeSelector(buff *bytes.Buffer, selector LabelSelector, args []interface{}) []interface{} {
+	args = append(args, selector.Key)
+	condition := fmt.Sprintf("EXISTS (SELECT 1 FROM configuration_labels WHERE config_id = configurations.id AND key = $%d", len(args))
+	if selector.Op == LabelEquals || selector.Op == LabelNotEquals {
+		args = append(args, selector.Value)
+		condition += fmt.Sprintf(" AND value = $%d", len(args))
+	}
+	condition += ")"
+
+	if selector.Op == LabelNotEquals || selector.Op == LabelNotExists {
+		condition = "NOT " + condition
+	}
+	buff.WriteString(condition)
+	return args
+}
+
+// saveLabels replaces the labels of the configuration with the id.
+func saveLabels(tx *sql.Tx, id int, labels Labels) error {
+	if _, err := tx.Exec("DELETE FROM configuration_labels WHERE config_id = $1", id); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, err := tx.Exec("INSERT INTO configuration_labels(config_id, key, value) VALUES($1, $2, $3)", id, key, labels[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanLabels unmarshals the labels that configColumns aggregates.
+func scanLabels(raw []byte) (labels Labels, err error) {
+	if raw == nil {
+		return nil, nil
+	}
+	err = json.Unmarshal(raw, &labels)
+	return labels, err
+}
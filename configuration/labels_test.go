@@ -0,0 +1,199 @@
+package configuration
+
+import (
+	"reflect"
+	"testing"
+)
+
+var labelConfigs = []Configuration{
+	{Name: "web", HostName: "web.example.com", Port: 22, Username: "deploy", Labels: Labels{"env": "prod", "team": "payments"}},
+	{Name: "db", HostName: "db.example.com", Port: 5432, Username: "postgres", Labels: Labels{"env": "prod", "team": "qa", "critical": "true"}},
+	{Name: "cache", HostName: "cache.example.com", Port: 6379, Username: "redis", Labels: Labels{"env": "staging"}},
+	{Name: "mail", HostName: "mail.example.com", Port: 25, Username: "postfix"},
+}
+
+var selectorTests = map[string]struct {
+	selectors string
+	expected  []string
+}{
+	"TestSelectEquals":     {"env=prod", []string{"web", "db"}},
+	"TestSelectDoubleEq":   {"env==staging", []string{"cache"}},
+	"TestSelectNotEquals":  {"team!=qa", []string{"web", "cache", "mail"}},
+	"TestSelectExists":     {"critical", []string{"db"}},
+	"TestSelectNotExists":  {"!env", []string{"mail"}},
+	"TestSelectEvery":      {"env=prod,team!=qa", []string{"web"}},
+	"TestSelectNoMatch":    {"env=dev", []string{}},
+	"TestSelectEmptyValue": {"env=", []string{}},
+}
+
+func TestSelectors(t *testing.T) {
+	storeTests := make(map[string]storeTest, len(selectorTests))
+	for name, test := range selectorTests {
+		storeTests[name] = func(cs ConfigurationStore) error {
+			selectors, err := ParseSelectors(test.selectors)
+			if err != nil {
+				return err
+			}
+			opts := QueryOptions{Labels: selectors}
+			configs, err := cs.List(opts)
+			if err != nil {
+				return err
+			}
+			if names := configNames(configs); !reflect.DeepEqual(names, test.expected) {
+				return failure{"", test.expected, names}
+			}
+			if count, err := cs.Count(opts); err != nil || count != len(test.expected) {
+				return failure{"Wrong count", len(test.expected), count}
+			}
+			return nil
+		}
+	}
+	runStoreTests(t, storeTests, labelConfigs)
+}
+
+var labelTests = map[string]storeTest{
+	"TestLabelsStored": func(cs ConfigurationStore) error {
+		configs, err := cs.Get("db")
+		if err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(configs[0].Labels, labelConfigs[1].Labels) {
+			return failure{"Wrong labels", labelConfigs[1].Labels, configs[0].Labels}
+		}
+		return nil
+	},
+
+	"TestModifyKeepsLabels": func(cs ConfigurationStore) error {
+		config, err := cs.Modify("web", Configuration{Port: 2222})
+		if err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(config.Labels, labelConfigs[0].Labels) {
+			return failure{"Labels were not kept", labelConfigs[0].Labels, config.Labels}
+		}
+		return nil
+	},
+
+	"TestModifyReplacesLabels": func(cs ConfigurationStore) error {
+		expected := Labels{"env": "staging"}
+		if _, err := cs.Modify("web", Configuration{Labels: expected}); err != nil {
+			return err
+		}
+		configs, err := cs.Get("web")
+		if err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(configs[0].Labels, expected) {
+			return failure{"Labels were not replaced", expected, configs[0].Labels}
+		}
+		return nil
+	},
+
+	"TestModifyClearsLabels": func(cs ConfigurationStore) error {
+		if _, err := cs.Modify("web", Configuration{Labels: Labels{}}); err != nil {
+			return err
+		}
+		configs, err := cs.Get("web")
+		if err != nil {
+			return err
+		}
+		if configs[0].Labels != nil {
+			return failure{"Labels were not cleared", nil, configs[0].Labels}
+		}
+		return nil
+	},
+
+	"TestRollbackRestoresLabels": func(cs ConfigurationStore) error {
+		if _, err := cs.Modify("web", Configuration{Labels: Labels{"env": "dev"}}); err != nil {
+			return err
+		}
+		if err := cs.Delete("web"); err != nil {
+			return err
+		}
+		revisions, err := cs.History("web")
+		if err != nil {
+			return err
+		}
+		if before := revisions[2].Before; before == nil || before.Labels["env"] != "dev" {
+			return failure{"Deletion did not record the labels", "dev", before}
+		}
+
+		config, err := cs.Rollback("web", revisions[0].ID)
+		if err != nil {
+			return err
+		}
+		configs, err := cs.Get("web")
+		if err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(configs[0].Labels, labelConfigs[0].Labels) || !reflect.DeepEqual(config.Labels, labelConfigs[0].Labels) {
+			return failure{"Labels were not restored", labelConfigs[0].Labels, configs[0].Labels}
+		}
+		return nil
+	},
+}
+
+func TestLabels(t *testing.T) {
+	runStoreTests(t, labelTests, labelConfigs)
+}
+
+func TestParseSelectors(t *testing.T) {
+	tests := map[string]struct {
+		list     string
+		expected []LabelSelector
+		err      error
+	}{
+		"TestParseEvery": {"env=prod, team!=qa,critical,!deprecated", []LabelSelector{
+			{"env", LabelEquals, "prod"},
+			{"team", LabelNotEquals, "qa"},
+			{"critical", LabelExists, ""},
+			{"deprecated", LabelNotExists, ""},
+		}, nil},
+		"TestParseEmptyKey":    {"=prod", nil, InvalidLabelErr},
+		"TestParseBadValue":    {"env=prod eu", nil, InvalidLabelErr},
+		"TestParseEmpty":       {"", nil, InvalidLabelErr},
+		"TestParseTrailing":    {"env=prod,", nil, InvalidLabelErr},
+		"TestParsePrefixedKey": {"example.com/tier=1", []LabelSelector{{"example.com/tier", LabelEquals, "1"}}, nil},
+	}
+	for name, test := range tests {
+		selectors, err := ParseSelectors(test.list)
+		if err != test.err {
+			t.Errorf("%s Failed: %s", name, failure{"Wrong error", test.err, err})
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(selectors, test.expected) {
+			t.Errorf("%s Failed: %s", name, failure{"", test.expected, selectors})
+		}
+	}
+}
+
+func TestValidateLabels(t *testing.T) {
+	tests := map[string]struct {
+		labels Labels
+		err    error
+	}{
+		"TestValidLabels":    {Labels{"env": "prod", "example.com/team": "pay_ments-1", "empty": ""}, nil},
+		"TestKeyTooLong":     {Labels{"k23456789012345678901234567890123456789012345678901234567890123x": "v"}, InvalidLabelErr},
+		"TestKeyPunctuation": {Labels{"-env": "prod"}, InvalidLabelErr},
+		"TestValueSlash":     {Labels{"env": "prod/eu"}, InvalidLabelErr},
+	}
+	for name, test := range tests {
+		if err := test.labels.Validate(); err != test.err {
+			t.Errorf("%s Failed: %s", name, failure{"", test.err, err})
+		}
+	}
+}
+
+func TestSelectorQuery(t *testing.T) {
+	selectors, _ := ParseSelectors("env=prod,!critical")
+	query, args := buildCountQuery(QueryOptions{Labels: selectors})
+	expected := "SELECT count(*) FROM configurations WHERE " +
+		"EXISTS (SELECT 1 FROM configuration_labels WHERE config_id = configurations.id AND key = $1 AND value = $2) AND " +
+		"NOT EXISTS (SELECT 1 FROM configuration_labels WHERE config_id = configurations.id AND key = $3)"
+	if query != expected {
+		t.Error("Failed:", failure{"Wrong query", expected, query})
+	}
+	if !reflect.DeepEqual(args, []interface{}{"env", "prod", "critical"}) {
+		t.Error("Failed:", failure{"Wrong arguments", []interface{}{"env", "prod", "critical"}, args})
+	}
+}
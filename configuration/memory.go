@@ -0,0 +1,451 @@
+package configuration
+
+import (
+	"sort"
+	"sync"
+)
+
+// MemoryStore is a ConfigurationStore that keeps the configurations in
+// memory. It is safe for concurrent use.
+type MemoryStore struct {
+	*memoryState
+
+	// actor is recorded as the author of the revisions made by the store.
+	actor string
+}
+
+// memoryState is shared by a MemoryStore and the views returned by As.
+type memoryState struct {
+	mu             sync.RWMutex
+	lastID         int
+	lastRevisionID int
+	configs        map[string]Configuration
+	revisions      []Revision
+	schema         AttributeSchema
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{memoryState: &memoryState{configs: make(map[string]Configuration), schema: DefaultSchema}}
+}
+
+// As returns a view of the store that records actor as the author of the
+// revisions it makes.
+func (ms *MemoryStore) As(actor string) ConfigurationStore {
+	return &MemoryStore{memoryState: ms.memoryState, actor: actor}
+}
+
+// GetAll returns a list of all of the stored configurations ordered by id.
+func (ms *MemoryStore) GetAll() (configs []Configuration, err error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	configs = make([]Configuration, 0, len(ms.configs))
+	for _, config := range ms.configs {
+		configs = append(configs, config)
+	}
+	sort.Sort(byID(configs))
+	return configs, nil
+}
+
+// List returns the configurations that match the options.
+func (ms *MemoryStore) List(opts QueryOptions) (configs []Configuration, err error) {
+	if err = opts.Validate(); err != nil {
+		return make([]Configuration, 0), err
+	}
+	configs, err = ms.GetAll()
+	return query(configs, opts), err
+}
+
+// Count returns the number of configurations that match the filters and
+// search of the options.
+func (ms *MemoryStore) Count(opts QueryOptions) (int, error) {
+	if err := opts.Validate(); err != nil {
+		return 0, err
+	}
+	configs, err := ms.GetAll()
+	return len(query(configs, opts.counted())), err
+}
+
+// Get returns the configurations whose names match the arguments. If any of
+// the configurations cannot be found a DoesNotExistErr is returned.
+func (ms *MemoryStore) Get(names ...string) (configs []Configuration, err error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	configs = make([]Configuration, 0, len(names))
+	found := make(map[string]bool, len(names))
+	for _, name := range names {
+		config, ok := ms.configs[name]
+		if !ok || found[name] {
+			continue
+		}
+		found[name] = true
+		configs = append(configs, config)
+	}
+
+	if len(configs) != len(names) {
+		err = DoesNotExistErr
+	}
+	return configs, err
+}
+
+// Add adds all of the configurations in the argument or none of them. It
+// returns an Error with an Err of DuplicateConfigErr on the addition of a
+// configuration that has the same name as an existing configuration and a
+// ValidationError if the attributes of a configuration do not satisfy the
+// schema.
+func (ms *MemoryStore) Add(configs ...Configuration) (configsAdded []Configuration, err error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.add(configs...)
+}
+
+// add adds all of the configurations or none of them. The caller must hold
+// the lock.
+func (ms *MemoryStore) add(configs ...Configuration) (configsAdded []Configuration, err error) {
+	schema, err := ms.schema.compile()
+	if err != nil {
+		return configsAdded, err
+	}
+
+	pending := make(map[string]bool, len(configs))
+	for _, config := range configs {
+		if err := validateAttributes(schema, config); err != nil {
+			return configsAdded, err
+		}
+		if existing, ok := ms.configs[config.Name]; ok {
+			return configsAdded, Error{Err: DuplicateConfigErr, Configuration: existing}
+		}
+		if pending[config.Name] {
+			return configsAdded, Error{Err: DuplicateConfigErr}
+		}
+		pending[config.Name] = true
+	}
+
+	for _, config := range configs {
+		ms.lastID++
+		config.ID = ms.lastID
+		config.Version = 1
+		config.Labels = copyLabels(config.Labels)
+		config.Attributes = copyAttributes(config.Attributes)
+		ms.configs[config.Name] = config
+		ms.recordRevision(ActionAdd, nil, &config)
+		configsAdded = append(configsAdded, config)
+	}
+	return configsAdded, nil
+}
+
+// Delete deletes all of the configurations whose name is in the list of
+// names in the argument. It will not return an error if the name is not found.
+func (ms *MemoryStore) Delete(names ...string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	for _, name := range names {
+		ms.remove(name, 0)
+	}
+	return nil
+}
+
+// DeleteVersion deletes the configuration with the name if its version
+// matches the version argument.
+func (ms *MemoryStore) DeleteVersion(name string, version int) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.remove(name, version)
+}
+
+// remove deletes the configuration with the name if version is 0 or matches
+// its version. The caller must hold the lock.
+func (ms *MemoryStore) remove(name string, version int) error {
+	config, ok := ms.configs[name]
+	if !ok {
+		return DoesNotExistErr
+	}
+	if version != 0 && config.Version != version {
+		return VersionMismatchErr
+	}
+	delete(ms.configs, name)
+	ms.recordRevision(ActionDelete, &config, nil)
+	return nil
+}
+
+// Modify applies the patch to the configuration with the same name as the
+// name argument. The attributes of the result must satisfy the schema.
+func (ms *MemoryStore) Modify(name string, patch Patch) (newConfig Configuration, err error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.modify(name, patch)
+}
+
+// modify applies the patch to the configuration with the name. The caller
+// must hold the lock.
+func (ms *MemoryStore) modify(name string, patch Patch) (newConfig Configuration, err error) {
+	actualConfig, ok := ms.configs[name]
+	if !ok {
+		return newConfig, DoesNotExistErr
+	}
+
+	config, err := patch.Apply(actualConfig)
+	if err != nil {
+		return newConfig, err
+	}
+	config.ID, config.Version = actualConfig.ID, actualConfig.Version+1
+
+	schema, err := ms.schema.compile()
+	if err == nil {
+		err = validateAttributes(schema, config)
+	}
+	if err != nil {
+		return newConfig, err
+	}
+	if existing, ok := ms.configs[config.Name]; ok && config.Name != name {
+		return newConfig, Error{Err: DuplicateConfigErr, Configuration: existing}
+	}
+
+	delete(ms.configs, name)
+	ms.configs[config.Name] = config
+	ms.recordRevision(ActionModify, &actualConfig, &config)
+	return config, nil
+}
+
+// Batch carries out the operations in order. If atomic is set and an
+// operation fails the store is restored to how it was before the batch and
+// a BatchError is returned. Otherwise a result is returned for every
+// operation.
+func (ms *MemoryStore) Batch(ops []Operation, atomic bool) (results []OperationResult, err error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	lastID, lastRevisionID, revisions := ms.lastID, ms.lastRevisionID, len(ms.revisions)
+	configs := make(map[string]Configuration, len(ms.configs))
+	for name, config := range ms.configs {
+		configs[name] = config
+	}
+
+	for index, op := range ops {
+		result := ms.apply(op)
+		if result.Err != nil && atomic {
+			ms.lastID, ms.lastRevisionID, ms.revisions, ms.configs = lastID, lastRevisionID, ms.revisions[:revisions], configs
+			return nil, BatchError{index, result.Err}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// apply makes the operation. The caller must hold the lock.
+func (ms *MemoryStore) apply(op Operation) (result OperationResult) {
+	switch op.Op {
+	case OpCreate:
+		var configs []Configuration
+		if configs, result.Err = ms.add(op.Configuration); result.Err == nil {
+			result.Configuration = configs[0]
+		}
+	case OpUpdate:
+		result.Configuration, result.Err = ms.modify(op.Name, IfVersion(op.Version, op.Patch))
+	case OpDelete:
+		if err := ms.remove(op.Name, op.Version); err != DoesNotExistErr || op.Version != 0 {
+			result.Err = err
+		}
+	default:
+		result.Err = UnknownOperationErr
+	}
+	return result
+}
+
+// Schema returns the schema that the attributes must satisfy.
+func (ms *MemoryStore) Schema() (AttributeSchema, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return ms.schema, nil
+}
+
+// SetSchema replaces the schema that the attributes must satisfy. The stored
+// configurations are not checked against it until they are modified.
+func (ms *MemoryStore) SetSchema(schema AttributeSchema) (AttributeSchema, error) {
+	if err := schema.Validate(); err != nil {
+		return schema, err
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	at := now()
+	schema.UpdatedBy, schema.UpdatedAt = ms.actor, &at
+	ms.schema = schema
+	return schema, nil
+}
+
+// History returns every revision of the configuration with the name ordered
+// by id.
+func (ms *MemoryStore) History(name string) (revisions []Revision, err error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	revisions = make([]Revision, 0)
+	id, ok := ms.configID(name)
+	if !ok {
+		return revisions, DoesNotExistErr
+	}
+	for _, revision := range ms.revisions {
+		if revision.ConfigurationID == id {
+			revisions = append(revisions, revision)
+		}
+	}
+	return revisions, nil
+}
+
+// Rollback restores the configuration with the name to how it was right
+// after the revision with the id.
+func (ms *MemoryStore) Rollback(name string, revisionID int) (config Configuration, err error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	id, ok := ms.configID(name)
+	if !ok {
+		return config, DoesNotExistErr
+	}
+
+	var target *Configuration
+	found := false
+	for _, revision := range ms.revisions {
+		if revision.ID == revisionID && revision.ConfigurationID == id {
+			target, found = revision.After, true
+		}
+	}
+	if !found {
+		return config, RevisionDoesNotExistErr
+	}
+
+	var current *Configuration
+	for _, c := range ms.configs {
+		if c.ID == id {
+			c := c
+			current = &c
+		}
+	}
+	if target != nil {
+		target = copyConfig(target)
+		target.Version = ms.lastVersion(id) + 1
+	}
+
+	switch {
+	case target == nil && current == nil:
+		return config, DoesNotExistErr
+	case target != nil:
+		config = *target
+		if existing, ok := ms.configs[config.Name]; ok && existing.ID != id {
+			return config, Error{Err: DuplicateConfigErr, Configuration: existing}
+		}
+	}
+
+	if current != nil {
+		delete(ms.configs, current.Name)
+	}
+	if target != nil {
+		ms.configs[config.Name] = config
+	}
+	ms.recordRevision(ActionRollback, current, target)
+	return config, nil
+}
+
+// recordRevision adds a revision from before to after. The caller must hold
+// the lock.
+func (ms *MemoryStore) recordRevision(action string, before, after *Configuration) {
+	revision := Revision{
+		Action:    action,
+		Actor:     ms.actor,
+		CreatedAt: now(),
+		Before:    copyConfig(before),
+		After:     copyConfig(after),
+	}
+	if after != nil {
+		revision.ConfigurationID = after.ID
+	} else {
+		revision.ConfigurationID = before.ID
+	}
+
+	ms.lastRevisionID++
+	revision.ID = ms.lastRevisionID
+	ms.revisions = append(ms.revisions, revision)
+}
+
+// lastVersion returns the version of the configuration with the id after its
+// latest revision, which for a deleted configuration is the version it was
+// deleted at. The caller must hold the lock.
+func (ms *MemoryStore) lastVersion(id int) int {
+	for i := len(ms.revisions) - 1; i >= 0; i-- {
+		revision := ms.revisions[i]
+		if revision.ConfigurationID != id {
+			continue
+		}
+		if revision.After != nil {
+			return revision.After.Version
+		}
+		return revision.Before.Version
+	}
+	return 0
+}
+
+// configID returns the id of the configuration with the name or, if no
+// configuration has the name, the configuration that most recently had it.
+// The caller must hold the lock.
+func (ms *MemoryStore) configID(name string) (int, bool) {
+	if config, ok := ms.configs[name]; ok {
+		return config.ID, true
+	}
+	for i := len(ms.revisions) - 1; i >= 0; i-- {
+		revision := ms.revisions[i]
+		if (revision.After != nil && revision.After.Name == name) || (revision.After == nil && revision.Before.Name == name) {
+			return revision.ConfigurationID, true
+		}
+	}
+	return 0, false
+}
+
+// merge returns actual with every field that is set in config copied over it.
+func merge(actual, config Configuration) Configuration {
+	if config.Name == "" {
+		config.Name = actual.Name
+	}
+
+	if config.HostName == "" {
+		config.HostName = actual.HostName
+	}
+
+	if config.Username == "" {
+		config.Username = actual.Username
+	}
+
+	if config.Port == 0 {
+		config.Port = actual.Port
+	}
+
+	if config.Labels == nil {
+		config.Labels = actual.Labels
+	}
+	config.Labels = copyLabels(config.Labels)
+
+	if config.Attributes == nil {
+		config.Attributes = actual.Attributes
+	}
+	config.Attributes = copyAttributes(config.Attributes)
+	return config
+}
+
+func copyConfig(config *Configuration) *Configuration {
+	if config == nil {
+		return nil
+	}
+	c := *config
+	c.Labels = copyLabels(c.Labels)
+	c.Attributes = copyAttributes(c.Attributes)
+	return &c
+}
+
+type byID []Configuration
+
+func (b byID) Len() int           { return len(b) }
+func (b byID) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byID) Less(i, j int) bool { return b[i].ID < b[j].ID }
@@ -0,0 +1,376 @@
+package configuration
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	PatchPathErr       = errors.New("The path does not exist")
+	PatchOperationErr  = errors.New("The operation is not supported")
+	PatchValueErr      = errors.New("The operation requires a value")
+	PatchDocumentErr   = errors.New("The patch must leave a configuration object")
+	PatchTestFailedErr = errors.New("The value does not match")
+)
+
+// Patch is a change to a configuration. Modify applies it to the stored
+// configuration while no other change can be made to it, so the patch sees
+// the latest version.
+type Patch interface {
+	// Apply returns the configuration with the change made to it. The ID
+	// and Version of the result are set by Modify.
+	Apply(actual Configuration) (Configuration, error)
+}
+
+// PatchError is returned when an operation of a patch cannot be applied.
+// Err is one of the Patch errors.
+type PatchError struct {
+	Op   string
+	Path string
+	Err  error
+}
+
+func (pe PatchError) Error() string {
+	return fmt.Sprintf("Patch Error: %s %q: %s", pe.Op, pe.Path, pe.Err.Error())
+}
+
+// Apply copies the fields that are set in the configuration over actual.
+// Labels and attributes that are set replace all of the labels or attributes
+// of actual. If the Version is set it must match the version of actual.
+func (c Configuration) Apply(actual Configuration) (Configuration, error) {
+	if c.Version != 0 && c.Version != actual.Version {
+		return actual, VersionMismatchErr
+	}
+	return merge(actual, c), nil
+}
+
+// Replacement is a Patch that replaces every field of the configuration,
+// clearing those that it leaves out. If the Version is set it must match
+// the version of the configuration.
+type Replacement Configuration
+
+func (rp Replacement) Apply(actual Configuration) (Configuration, error) {
+	if rp.Version != 0 && rp.Version != actual.Version {
+		return actual, VersionMismatchErr
+	}
+	config := Configuration(rp)
+	config.Labels = copyLabels(config.Labels)
+	config.Attributes = copyAttributes(config.Attributes)
+	return config, nil
+}
+
+type versioned struct {
+	version int
+	Patch
+}
+
+// IfVersion returns a Patch that only applies the patch if the configuration
+// is at the version. Otherwise VersionMismatchErr is returned. A version of
+// 0 matches every version.
+func IfVersion(version int, patch Patch) Patch {
+	return versioned{version, patch}
+}
+
+func (v versioned) Apply(actual Configuration) (Configuration, error) {
+	if v.version != 0 && v.version != actual.Version {
+		return actual, VersionMismatchErr
+	}
+	return v.Patch.Apply(actual)
+}
+
+// MergePatch is an RFC 7396 JSON merge patch of the JSON document of a
+// configuration. Members that are null are removed, so a merge patch can
+// clear a field or remove a single label or attribute. The fields that it
+// changes must be valid.
+type MergePatch json.RawMessage
+
+func (mp MergePatch) Apply(actual Configuration) (Configuration, error) {
+	var patch interface{}
+	if err := json.Unmarshal(mp, &patch); err != nil {
+		return actual, err
+	}
+	doc, err := toDocument(actual)
+	if err != nil {
+		return actual, err
+	}
+	return fromDocument(actual, mergePatch(doc, patch), "merge")
+}
+
+// mergePatch returns the target with the patch merged into it as described
+// by RFC 7396.
+func mergePatch(target, patch interface{}) interface{} {
+	members, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	object, ok := target.(map[string]interface{})
+	if !ok {
+		object = make(map[string]interface{})
+	}
+	for name, value := range members {
+		if value == nil {
+			delete(object, name)
+		} else {
+			object[name] = mergePatch(object[name], value)
+		}
+	}
+	return object
+}
+
+// PatchOperation is an operation of a JSONPatch. Path is a JSON pointer to
+// the value in the document of the configuration that the operation is made
+// on.
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// JSONPatch is an RFC 6902 JSON patch of the JSON document of a
+// configuration. The add, remove, replace and test operations are
+// supported. The operations are applied in order and if any of them fails
+// none of them are. The fields that it changes must be valid.
+type JSONPatch []PatchOperation
+
+func (jp JSONPatch) Apply(actual Configuration) (Configuration, error) {
+	doc, err := toDocument(actual)
+	if err != nil {
+		return actual, err
+	}
+	for _, op := range jp {
+		if doc, err = op.apply(doc); err != nil {
+			return actual, err
+		}
+	}
+	return fromDocument(actual, doc, "patch")
+}
+
+// apply returns the document with the operation made on it.
+func (op PatchOperation) apply(doc interface{}) (interface{}, error) {
+	tokens, err := parsePointer(op.Path)
+	if err != nil {
+		return doc, PatchError{op.Op, op.Path, err}
+	}
+
+	var value interface{}
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return doc, PatchError{op.Op, op.Path, PatchValueErr}
+		}
+		if err = json.Unmarshal(op.Value, &value); err != nil {
+			return doc, PatchError{op.Op, op.Path, err}
+		}
+	case "remove":
+	default:
+		return doc, PatchError{op.Op, op.Path, PatchOperationErr}
+	}
+
+	if op.Op == "test" {
+		actual, err := lookup(doc, tokens)
+		if err == nil && !reflect.DeepEqual(actual, value) {
+			err = PatchTestFailedErr
+		}
+		if err != nil {
+			return doc, PatchError{op.Op, op.Path, err}
+		}
+		return doc, nil
+	}
+
+	if doc, err = patchValue(doc, tokens, op.Op, value); err != nil {
+		return doc, PatchError{op.Op, op.Path, err}
+	}
+	return doc, nil
+}
+
+// patchValue returns the node with the operation made on the value that the
+// tokens point to.
+func patchValue(node interface{}, tokens []string, op string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		if op == "remove" {
+			return node, PatchDocumentErr
+		}
+		return value, nil
+	}
+
+	token, last := tokens[0], len(tokens) == 1
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, exists := n[token]
+		if !exists && !(last && op == "add") {
+			return node, PatchPathErr
+		}
+		if !last {
+			child, err := patchValue(child, tokens[1:], op, value)
+			n[token] = child
+			return n, err
+		}
+		if op == "remove" {
+			delete(n, token)
+		} else {
+			n[token] = value
+		}
+		return n, nil
+	case []interface{}:
+		if last && op == "add" && token == "-" {
+			return append(n, value), nil
+		}
+		index, err := strconv.Atoi(token)
+		if err != nil || index < 0 || index > len(n) || (index == len(n) && !(last && op == "add")) {
+			return node, PatchPathErr
+		}
+		if !last {
+			n[index], err = patchValue(n[index], tokens[1:], op, value)
+			return n, err
+		}
+		switch op {
+		case "add":
+			n = append(n, nil)
+			copy(n[index+1:], n[index:])
+			n[index] = value
+		case "remove":
+			n = append(n[:index], n[index+1:]...)
+		default:
+			n[index] = value
+		}
+		return n, nil
+	}
+	return node, PatchPathErr
+}
+
+// lookup returns the value that the tokens point to.
+func lookup(node interface{}, tokens []string) (interface{}, error) {
+	for _, token := range tokens {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			child, ok := n[token]
+			if !ok {
+				return nil, PatchPathErr
+			}
+			node = child
+		case []interface{}:
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index >= len(n) {
+				return nil, PatchPathErr
+			}
+			node = n[index]
+		default:
+			return nil, PatchPathErr
+		}
+	}
+	return node, nil
+}
+
+// parsePointer returns the unescaped reference tokens of an RFC 6901 JSON
+// pointer.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, PatchPathErr
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+// document is the JSON document of a configuration that patches are made
+// to. Unlike Configuration every member is present so that a patch can add
+// a label to a configuration without labels.
+type document struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	HostName   string     `json:"hostname"`
+	Port       int        `json:"port"`
+	Username   string     `json:"username"`
+	Labels     Labels     `json:"labels"`
+	Attributes Attributes `json:"attributes"`
+	Version    int        `json:"version"`
+}
+
+// toDocument returns the document of the configuration decoded from JSON.
+func toDocument(config Configuration) (doc interface{}, err error) {
+	d := document(config)
+	if d.Labels == nil {
+		d.Labels = Labels{}
+	}
+	if d.Attributes == nil {
+		d.Attributes = Attributes{}
+	}
+	raw, err := json.Marshal(d)
+	if err != nil {
+		return doc, err
+	}
+	err = json.Unmarshal(raw, &doc)
+	return doc, err
+}
+
+// fromDocument returns the configuration of the patched document of actual.
+// Changes to the id and version are ignored. If a member has the wrong type
+// or a field that the patch changed is invalid a ValidationError is
+// returned.
+func fromDocument(actual Configuration, doc interface{}, op string) (config Configuration, err error) {
+	if _, ok := doc.(map[string]interface{}); !ok {
+		return config, PatchError{op, "", PatchDocumentErr}
+	}
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return config, err
+	}
+
+	var d document
+	if err = json.Unmarshal(raw, &d); err != nil {
+		if te, ok := err.(*json.UnmarshalTypeError); ok {
+			return config, ValidationError{Errors: []FieldError{{Field: te.Field, Message: te.Field + " must be " + jsonType(te.Type.Kind())}}}
+		}
+		return config, err
+	}
+	config = Configuration(d)
+	config.Labels = copyLabels(config.Labels)
+	config.Attributes = copyAttributes(config.Attributes)
+	return config, config.ValidateFields(changedFields(actual, config)...)
+}
+
+// jsonType returns the kind of JSON value that a Go value of the kind is
+// decoded from.
+func jsonType(kind reflect.Kind) string {
+	switch kind {
+	case reflect.String:
+		return "a string"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Bool:
+		return "a boolean"
+	}
+	return "a number"
+}
+
+// changedFields returns the names of the fields that differ between the
+// configurations.
+func changedFields(before, after Configuration) (fields []string) {
+	if before.Name != after.Name {
+		fields = append(fields, "name")
+	}
+	if before.HostName != after.HostName {
+		fields = append(fields, "hostname")
+	}
+	if before.Port != after.Port {
+		fields = append(fields, "port")
+	}
+	if before.Username != after.Username {
+		fields = append(fields, "username")
+	}
+	if !reflect.DeepEqual(copyLabels(before.Labels), copyLabels(after.Labels)) {
+		fields = append(fields, "labels")
+	}
+	return fields
+}
@@ -0,0 +1,191 @@
+package configuration
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+var patchConfig = Configuration{
+	Name:       "web",
+	HostName:   "web.example.com",
+	Port:       22,
+	Username:   "deploy",
+	Labels:     Labels{"env": "prod", "team": "payments"},
+	Attributes: Attributes{"protocol": "ssh", "timeout": float64(30)},
+}
+
+var applyTests = map[string]struct {
+	patch    Patch
+	expected Configuration
+	err      error
+}{
+	"TestApplyConfiguration": {
+		Configuration{Port: 2222},
+		Configuration{Name: "web", HostName: "web.example.com", Port: 2222, Username: "deploy", Labels: patchConfig.Labels, Attributes: patchConfig.Attributes},
+		nil,
+	},
+	"TestApplyReplacement": {
+		Replacement{Name: "web", HostName: "other.example.com", Port: 2222, Username: "root"},
+		Configuration{Name: "web", HostName: "other.example.com", Port: 2222, Username: "root"},
+		nil,
+	},
+	"TestApplyReplacementVersion": {
+		Replacement{Name: "web", HostName: "web.example.com", Port: 22, Username: "deploy", Version: 7},
+		Configuration{},
+		VersionMismatchErr,
+	},
+	"TestApplyIfVersion": {
+		IfVersion(7, Configuration{Port: 2222}),
+		Configuration{},
+		VersionMismatchErr,
+	},
+	"TestApplyMergePatch": {
+		MergePatch(`{"port": 2222, "labels": {"team": null, "tier": "web"}, "attributes": null}`),
+		Configuration{Name: "web", HostName: "web.example.com", Port: 2222, Username: "deploy", Labels: Labels{"env": "prod", "tier": "web"}, Attributes: nil},
+		nil,
+	},
+	"TestApplyMergePatchClearsPort": {
+		MergePatch(`{"port": null}`),
+		Configuration{},
+		ValidationError{[]FieldError{{"port", "port must be between 1 and 65535"}}},
+	},
+	"TestApplyMergePatchWrongType": {
+		MergePatch(`{"port": "ssh"}`),
+		Configuration{},
+		ValidationError{[]FieldError{{"port", "port must be a number"}}},
+	},
+	"TestApplyMergePatchNotObject": {
+		MergePatch(`[]`),
+		Configuration{},
+		PatchError{"merge", "", PatchDocumentErr},
+	},
+	"TestApplyJSONPatch": {
+		JSONPatch{
+			{Op: "test", Path: "/version", Value: json.RawMessage(`1`)},
+			{Op: "replace", Path: "/hostname", Value: json.RawMessage(`"db.example.com"`)},
+			{Op: "add", Path: "/labels/a~1b", Value: json.RawMessage(`"c"`)},
+			{Op: "remove", Path: "/labels/team"},
+			{Op: "remove", Path: "/attributes/timeout"},
+		},
+		Configuration{Name: "web", HostName: "db.example.com", Port: 22, Username: "deploy", Labels: Labels{"env": "prod", "a/b": "c"}, Attributes: Attributes{"protocol": "ssh"}},
+		nil,
+	},
+	"TestApplyJSONPatchArray": {
+		JSONPatch{
+			{Op: "add", Path: "/attributes/ports", Value: json.RawMessage(`[1, 3]`)},
+			{Op: "add", Path: "/attributes/ports/1", Value: json.RawMessage(`2`)},
+			{Op: "add", Path: "/attributes/ports/-", Value: json.RawMessage(`4`)},
+			{Op: "remove", Path: "/attributes/ports/0"},
+		},
+		Configuration{Name: "web", HostName: "web.example.com", Port: 22, Username: "deploy", Labels: patchConfig.Labels, Attributes: Attributes{"protocol": "ssh", "timeout": float64(30), "ports": []interface{}{float64(2), float64(3), float64(4)}}},
+		nil,
+	},
+	"TestApplyJSONPatchTestFails": {
+		JSONPatch{{Op: "test", Path: "/port", Value: json.RawMessage(`23`)}},
+		Configuration{},
+		PatchError{"test", "/port", PatchTestFailedErr},
+	},
+	"TestApplyJSONPatchMissingPath": {
+		JSONPatch{{Op: "replace", Path: "/labels/missing", Value: json.RawMessage(`"x"`)}},
+		Configuration{},
+		PatchError{"replace", "/labels/missing", PatchPathErr},
+	},
+	"TestApplyJSONPatchMissingValue": {
+		JSONPatch{{Op: "add", Path: "/labels/tier"}},
+		Configuration{},
+		PatchError{"add", "/labels/tier", PatchValueErr},
+	},
+	"TestApplyJSONPatchUnknownOp": {
+		JSONPatch{{Op: "move", Path: "/labels/env"}},
+		Configuration{},
+		PatchError{"move", "/labels/env", PatchOperationErr},
+	},
+	"TestApplyJSONPatchInvalidName": {
+		JSONPatch{{Op: "replace", Path: "/name", Value: json.RawMessage(`"search"`)}},
+		Configuration{},
+		ValidationError{[]FieldError{{"name", `name "search" is reserved`}}},
+	},
+	"TestApplyJSONPatchIgnoresVersion": {
+		JSONPatch{{Op: "replace", Path: "/version", Value: json.RawMessage(`9`)}},
+		Configuration{Name: "web", HostName: "web.example.com", Port: 22, Username: "deploy", Labels: patchConfig.Labels, Attributes: patchConfig.Attributes},
+		nil,
+	},
+}
+
+func TestApply(t *testing.T) {
+	actual := patchConfig
+	actual.ID, actual.Version = 1, 1
+	for name, test := range applyTests {
+		config, err := test.patch.Apply(actual)
+		if !reflect.DeepEqual(err, test.err) {
+			t.Errorf("%s Failed: %s", name, failure{"Wrong error", test.err, err})
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		config.ID, config.Version = 0, 0
+		if !reflect.DeepEqual(config, test.expected) {
+			t.Errorf("%s Failed: %s", name, failure{"", test.expected, config})
+		}
+	}
+}
+
+var patchTests = map[string]storeTest{
+	"TestModifyMergePatch": func(cs ConfigurationStore) error {
+		config, err := cs.Modify("web", MergePatch(`{"labels": {"team": null}}`))
+		if err != nil {
+			return err
+		}
+		configs, err := cs.Get("web")
+		if err != nil {
+			return err
+		}
+		expected := Labels{"env": "prod"}
+		if !reflect.DeepEqual(configs[0].Labels, expected) || config.Version != 2 {
+			return failure{"Label was not removed", expected, configs[0]}
+		}
+		return nil
+	},
+
+	"TestModifyJSONPatchIsAtomic": func(cs ConfigurationStore) error {
+		_, err := cs.Modify("web", JSONPatch{
+			{Op: "replace", Path: "/port", Value: json.RawMessage(`2222`)},
+			{Op: "test", Path: "/hostname", Value: json.RawMessage(`"other.example.com"`)},
+		})
+		if pe, ok := err.(PatchError); !ok || pe.Err != PatchTestFailedErr {
+			return failure{"Wrong error", PatchTestFailedErr, err}
+		}
+		configs, err := cs.Get("web")
+		if err != nil {
+			return err
+		}
+		if configs[0].Port != 22 || configs[0].Version != 1 {
+			return failure{"Failed patch changed the configuration", patchConfig.Port, configs[0].Port}
+		}
+		return nil
+	},
+
+	"TestModifyReplacement": func(cs ConfigurationStore) error {
+		config, err := cs.Modify("web", Replacement{Name: "web", HostName: "web.example.com", Port: 22, Username: "deploy"})
+		if err != nil {
+			return err
+		}
+		if config.Labels != nil || config.Attributes != nil || config.Version != 2 {
+			return failure{"Fields were not cleared", nil, config}
+		}
+		return nil
+	},
+
+	"TestModifyPatchVersion": func(cs ConfigurationStore) error {
+		if _, err := cs.Modify("web", IfVersion(2, MergePatch(`{"port": 2222}`))); err != VersionMismatchErr {
+			return failure{"Wrong error", VersionMismatchErr, err}
+		}
+		return nil
+	},
+}
+
+func TestPatches(t *testing.T) {
+	runStoreTests(t, patchTests, []Configuration{patchConfig})
+}
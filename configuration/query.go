@@ -0,0 +1,487 @@
+package configuration
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	UnknownFieldErr    = errors.New("Unknown configuration field")
+	InvalidValueErr    = errors.New("Invalid value for configuration field")
+	InvalidOperatorErr = errors.New("Invalid operator for configuration field")
+	NegativePageErr    = errors.New("Offset and limit cannot be negative")
+)
+
+// columns maps the names of the fields of a configuration, as they appear in
+// its json, to the columns of the configurations table that store them.
+var columns = map[string]string{
+	"id":       "id",
+	"name":     "config_name",
+	"hostname": "host_name",
+	"port":     "port",
+	"username": "username",
+}
+
+// IsField reports whether the name is the name of a field of a
+// configuration that can be filtered and sorted on.
+func IsField(name string) bool {
+	_, ok := columns[name]
+	return ok
+}
+
+// Operator compares the field of a configuration with the values of a
+// Filter.
+type Operator string
+
+const (
+	Equal          Operator = "="
+	NotEqual       Operator = "!="
+	Less           Operator = "<"
+	LessOrEqual    Operator = "<="
+	Greater        Operator = ">"
+	GreaterOrEqual Operator = ">="
+)
+
+// Filter matches the configurations whose field compares to the values with
+// the operator. Equal matches any of the values and NotEqual matches none of
+// them. The values of string fields may contain the wildcards "*", which
+// matches any run of characters, and "?", which matches any one character.
+// The other operators take a single number and compare numeric fields.
+type Filter struct {
+	Field  string
+	Op     Operator
+	Values []string
+}
+
+// Validate returns UnknownFieldErr if the filter's field is not a field of a
+// configuration, InvalidOperatorErr if the operator cannot be used on the
+// field and InvalidValueErr if the values do not suit the field.
+func (f Filter) Validate() error {
+	if !IsField(f.Field) {
+		return UnknownFieldErr
+	}
+	if len(f.Values) == 0 {
+		return InvalidValueErr
+	}
+	numeric := isNumeric(f.Field)
+
+	switch f.Op {
+	case Equal, NotEqual:
+	case Less, LessOrEqual, Greater, GreaterOrEqual:
+		if !numeric {
+			return InvalidOperatorErr
+		}
+		if len(f.Values) != 1 {
+			return InvalidValueErr
+		}
+	default:
+		return InvalidOperatorErr
+	}
+
+	if numeric {
+		for _, value := range f.Values {
+			if _, err := parseNumber(value); err != nil {
+				return InvalidValueErr
+			}
+		}
+	}
+	return nil
+}
+
+// matches reports whether the configuration's field satisfies the filter.
+// The filter must be valid.
+func (f Filter) matches(config Configuration) bool {
+	switch value := field(config, f.Field).(type) {
+	case int:
+		operand, _ := parseNumber(f.Values[0])
+		switch f.Op {
+		case Less:
+			return value < operand
+		case LessOrEqual:
+			return value <= operand
+		case Greater:
+			return value > operand
+		case GreaterOrEqual:
+			return value >= operand
+		}
+		return f.matchesNumber(value) == (f.Op == Equal)
+	case string:
+		return f.matchesAny(value) == (f.Op == Equal)
+	}
+	return false
+}
+
+// matchesNumber reports whether the value equals any of the filter's values
+// as numbers, so that "0080" matches 80 as it does in SQL.
+func (f Filter) matchesNumber(value int) bool {
+	for _, operand := range f.Values {
+		if number, _ := parseNumber(operand); number == value {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAny reports whether the value matches any of the filter's values.
+func (f Filter) matchesAny(value string) bool {
+	for _, pattern := range f.Values {
+		if isGlob(pattern) {
+			if globRegexp(pattern).MatchString(value) {
+				return true
+			}
+		} else if pattern == value {
+			return true
+		}
+	}
+	return false
+}
+
+// isGlob reports whether the value contains a wildcard.
+func isGlob(value string) bool {
+	return strings.ContainsAny(value, "*?")
+}
+
+// globRegexp returns a regular expression that matches the same strings as
+// the pattern.
+func globRegexp(pattern string) *regexp.Regexp {
+	var buff bytes.Buffer
+	buff.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			buff.WriteString("(?s:.*)")
+		case '?':
+			buff.WriteString("(?s:.)")
+		default:
+			buff.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	buff.WriteString("$")
+	return regexp.MustCompile(buff.String())
+}
+
+// globLike returns the SQL LIKE pattern that matches the same strings as the
+// pattern.
+func globLike(pattern string) string {
+	return strings.NewReplacer("*", "%", "?", "_").Replace(escapeLike(pattern))
+}
+
+// escapeLike escapes the characters that are special in a LIKE pattern.
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
+// QueryOptions narrows down, orders and pages the configurations returned by
+// List.
+type QueryOptions struct {
+	// Filters must all match for a configuration to be listed.
+	Filters []Filter
+
+	// Labels must all match the labels of a configuration for it to be
+	// listed.
+	Labels []LabelSelector
+
+	// Sort orders the configurations. Without keys they are ordered by id.
+	Sort Sort
+
+	// Search lists only the configurations whose name, hostname or username
+	// contain every word of it regardless of case. Unless Sort has keys the
+	// configurations that match best are listed first.
+	Search string
+
+	// After lists only the configurations that are ordered after the
+	// position.
+	After *Position
+
+	// Before lists only the configurations that are ordered before the
+	// position.
+	Before *Position
+
+	// Offset is the number of configurations that are skipped.
+	Offset int
+
+	// Limit is the maximum number of configurations returned. There is no
+	// maximum if it is zero. If Before is set the configurations closest to
+	// it are kept.
+	Limit int
+}
+
+// Ranked reports whether the configurations are ordered by how well they
+// match the search.
+func (opts QueryOptions) Ranked() bool {
+	return opts.Search != "" && len(opts.Sort.Keys) == 0
+}
+
+// counted returns the options that select the configurations that are
+// counted, which are all that match regardless of position or page.
+func (opts QueryOptions) counted() QueryOptions {
+	return QueryOptions{Filters: opts.Filters, Labels: opts.Labels, Search: opts.Search}
+}
+
+// Position is the place of a configuration in a listing. Values are the
+// values of the fields that the listing is sorted by and ID breaks ties so
+// that every configuration has its own place even as others are added.
+type Position struct {
+	Values []string
+	ID     int
+}
+
+// PositionOf returns the position of the configuration in a listing with
+// the sort.
+func PositionOf(config Configuration, sort Sort) Position {
+	return Position{Values: sort.values(config), ID: config.ID}
+}
+
+// Validate returns the error of the sort or of the first invalid filter or
+// label selector. If
+// a position does not suit the sort InvalidValueErr is returned and if the
+// configurations are ordered by rank RankedPositionErr is returned. A
+// negative Offset or Limit returns NegativePageErr.
+func (opts QueryOptions) Validate() error {
+	if opts.Offset < 0 || opts.Limit < 0 {
+		return NegativePageErr
+	}
+	if err := opts.Sort.Validate(); err != nil {
+		return err
+	}
+	if opts.Ranked() && (opts.After != nil || opts.Before != nil) {
+		return RankedPositionErr
+	}
+	for _, filter := range opts.Filters {
+		if err := filter.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, selector := range opts.Labels {
+		if err := selector.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, position := range []*Position{opts.After, opts.Before} {
+		if position == nil {
+			continue
+		}
+		if len(position.Values) != len(opts.Sort.Keys) {
+			return InvalidValueErr
+		}
+		for i, key := range opts.Sort.Keys {
+			if _, err := parseNumber(position.Values[i]); isNumeric(key.Field) && err != nil {
+				return InvalidValueErr
+			}
+		}
+	}
+	return nil
+}
+
+// field returns the value of the configuration's field with the name.
+func field(config Configuration, name string) interface{} {
+	switch name {
+	case "id":
+		return config.ID
+	case "name":
+		return config.Name
+	case "hostname":
+		return config.HostName
+	case "port":
+		return config.Port
+	case "username":
+		return config.Username
+	}
+	return nil
+}
+
+// isNumeric reports whether the field with the name holds a number.
+func isNumeric(name string) bool {
+	_, ok := field(Configuration{}, name).(int)
+	return ok
+}
+
+// parseNumber parses the value of a numeric field. The fields are stored as
+// 32 bit integers so larger values are out of range.
+func parseNumber(value string) (int, error) {
+	number, err := strconv.ParseInt(value, 10, 32)
+	return int(number), err
+}
+
+// matches reports whether the configuration matches every filter.
+func matches(config Configuration, filters []Filter) bool {
+	for _, filter := range filters {
+		if !filter.matches(config) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchesLabels(config Configuration, selectors []LabelSelector) bool {
+	for _, selector := range selectors {
+		if !selector.matches(config.Labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// query returns the configurations that match the options. The
+// configurations must be ordered by id.
+func query(configs []Configuration, opts QueryOptions) []Configuration {
+	terms := searchTerms(opts.Search)
+	ranks := make(map[int]int)
+	matched := make([]Configuration, 0, len(configs))
+	for _, config := range configs {
+		if !matches(config, opts.Filters) || !matchesLabels(config, opts.Labels) {
+			continue
+		}
+		if len(terms) > 0 {
+			if ranks[config.ID] = rank(config, terms); ranks[config.ID] == 0 {
+				continue
+			}
+		}
+		position := PositionOf(config, opts.Sort)
+		if opts.After != nil && opts.Sort.compare(position.Values, position.ID, opts.After.Values, opts.After.ID) <= 0 {
+			continue
+		}
+		if opts.Before != nil && opts.Sort.compare(position.Values, position.ID, opts.Before.Values, opts.Before.ID) >= 0 {
+			continue
+		}
+		matched = append(matched, config)
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		if opts.Ranked() && ranks[matched[i].ID] != ranks[matched[j].ID] {
+			return ranks[matched[i].ID] > ranks[matched[j].ID]
+		}
+		return opts.Sort.Compare(matched[i], matched[j]) < 0
+	})
+
+	if opts.Offset >= len(matched) {
+		return matched[:0]
+	}
+	matched = matched[opts.Offset:]
+	if opts.Limit > 0 && opts.Limit < len(matched) {
+		if opts.Before != nil {
+			return matched[len(matched)-opts.Limit:]
+		}
+		matched = matched[:opts.Limit]
+	}
+	return matched
+}
+
+// buildListQuery returns the SQL query that selects the configurations that
+// match the options along with its arguments.
+func buildListQuery(opts QueryOptions) (query string, args []interface{}) {
+	buff := bytes.NewBufferString("SELECT " + configColumns + " FROM configurations")
+	args = writeWhere(buff, opts, args)
+
+	// The configurations closest to Before are found by walking backwards
+	// from it and are then put back in order.
+	buff.WriteString(" ORDER BY ")
+	if opts.Ranked() {
+		buff.WriteString("(")
+		args = writeRank(buff, opts.Search, args)
+		buff.WriteString(") DESC, ")
+	}
+	buff.WriteString(opts.Sort.orderBy(opts.Before != nil))
+
+	if opts.Limit > 0 {
+		args = append(args, opts.Limit)
+		fmt.Fprintf(buff, " LIMIT $%d", len(args))
+	}
+	if opts.Offset > 0 {
+		args = append(args, opts.Offset)
+		fmt.Fprintf(buff, " OFFSET $%d", len(args))
+	}
+
+	if opts.Before != nil {
+		return fmt.Sprintf("SELECT * FROM (%s) AS page ORDER BY %s", buff.String(), opts.Sort.orderBy(false)), args
+	}
+	return buff.String(), args
+}
+
+// buildCountQuery returns the SQL query that counts the configurations that
+// match the filters and search of the options along with its arguments.
+func buildCountQuery(opts QueryOptions) (query string, args []interface{}) {
+	buff := bytes.NewBufferString("SELECT count(*) FROM configurations")
+	args = writeWhere(buff, opts.counted(), args)
+	return buff.String(), args
+}
+
+// writeWhere writes the SQL WHERE clause that selects the configurations
+// that match the filters, search and positions of the options to the buffer and
+// returns the arguments with the clause's arguments appended.
+func writeWhere(buff *bytes.Buffer, opts QueryOptions, args []interface{}) []interface{} {
+	conditions := 0
+	next := func() {
+		if conditions == 0 {
+			buff.WriteString(" WHERE ")
+		} else {
+			buff.WriteString(" AND ")
+		}
+		conditions++
+	}
+
+	for _, filter := range opts.Filters {
+		next()
+		args = writeFilter(buff, filter, args)
+	}
+	for _, selector := range opts.Labels {
+		next()
+		args = writeSelector(buff, selector, args)
+	}
+	if len(searchTerms(opts.Search)) > 0 {
+		next()
+		args = writeSearch(buff, opts.Search, args)
+	}
+	if opts.After != nil {
+		next()
+		args = opts.Sort.writePosition(buff, *opts.After, true, args)
+	}
+	if opts.Before != nil {
+		next()
+		args = opts.Sort.writePosition(buff, *opts.Before, false, args)
+	}
+	return args
+}
+
+// writeFilter writes the SQL condition of the filter to the buffer and
+// returns the arguments with the filter's values appended.
+func writeFilter(buff *bytes.Buffer, filter Filter, args []interface{}) []interface{} {
+	column := columns[filter.Field]
+	numeric := isNumeric(filter.Field)
+
+	if filter.Op != Equal && filter.Op != NotEqual {
+		value, _ := parseNumber(filter.Values[0])
+		args = append(args, value)
+		fmt.Fprintf(buff, "%s %s $%d", column, filter.Op, len(args))
+		return args
+	}
+
+	if filter.Op == NotEqual {
+		buff.WriteString("NOT ")
+	}
+	buff.WriteString("(")
+	for index, value := range filter.Values {
+		if index > 0 {
+			buff.WriteString(" OR ")
+		}
+		switch {
+		case numeric:
+			number, _ := parseNumber(value)
+			args = append(args, number)
+			fmt.Fprintf(buff, "%s = $%d", column, len(args))
+		case isGlob(value):
+			args = append(args, globLike(value))
+			fmt.Fprintf(buff, "%s LIKE $%d", column, len(args))
+		default:
+			args = append(args, value)
+			fmt.Fprintf(buff, "%s = $%d", column, len(args))
+		}
+	}
+	buff.WriteString(")")
+	return args
+}
@@ -0,0 +1,146 @@
+package configuration
+
+import (
+	"reflect"
+	"testing"
+)
+
+var listConfigs = []Configuration{
+	{Name: "web", HostName: "b.example.com", Port: 22, Username: "deploy"},
+	{Name: "db", HostName: "a.example.com", Port: 5432, Username: "postgres"},
+	{Name: "cache", HostName: "c.example.com", Port: 22, Username: "deploy"},
+	{Name: "mail", HostName: "a.example.com", Port: 25, Username: "postfix"},
+}
+
+type listTest struct {
+	opts     QueryOptions
+	expected []string
+	err      error
+}
+
+var listTests = map[string]listTest{
+	"TestListAll":             {QueryOptions{}, []string{"web", "db", "cache", "mail"}, nil},
+	"TestSortByName":          {QueryOptions{Sort: sortBy("name")}, []string{"cache", "db", "mail", "web"}, nil},
+	"TestSortByHostName":      {QueryOptions{Sort: sortBy("hostname")}, []string{"db", "mail", "web", "cache"}, nil},
+	"TestSortByPort":          {QueryOptions{Sort: sortBy("port")}, []string{"web", "cache", "mail", "db"}, nil},
+	"TestSortByUsername":      {QueryOptions{Sort: sortBy("username")}, []string{"web", "cache", "mail", "db"}, nil},
+	"TestFilterString":        {QueryOptions{Filters: []Filter{{"username", Equal, []string{"deploy"}}}}, []string{"web", "cache"}, nil},
+	"TestFilterInt":           {QueryOptions{Filters: []Filter{{"port", Equal, []string{"22"}}}}, []string{"web", "cache"}, nil},
+	"TestFilterLeadingZeros":  {QueryOptions{Filters: []Filter{{"port", Equal, []string{"0022"}}}}, []string{"web", "cache"}, nil},
+	"TestNotEqualLeadingZero": {QueryOptions{Filters: []Filter{{"port", NotEqual, []string{"022", "0025"}}}}, []string{"db"}, nil},
+	"TestFilterBoth":          {QueryOptions{Filters: []Filter{{"port", Equal, []string{"22"}}, {"name", Equal, []string{"cache"}}}}, []string{"cache"}, nil},
+	"TestFilterNone":          {QueryOptions{Filters: []Filter{{"name", Equal, []string{"none"}}}}, []string{}, nil},
+	"TestLimit":               {QueryOptions{Sort: sortBy("name"), Limit: 2}, []string{"cache", "db"}, nil},
+	"TestOffset":              {QueryOptions{Sort: sortBy("name"), Offset: 1, Limit: 2}, []string{"db", "mail"}, nil},
+	"TestOffsetPastEnd":       {QueryOptions{Offset: 10}, []string{}, nil},
+	"TestFilterAndPage":       {QueryOptions{Filters: []Filter{{"port", Equal, []string{"22"}}}, Offset: 1}, []string{"cache"}, nil},
+	"TestFilterIn":            {QueryOptions{Filters: []Filter{{"name", Equal, []string{"db", "mail", "none"}}}}, []string{"db", "mail"}, nil},
+	"TestFilterNotIn":         {QueryOptions{Filters: []Filter{{"name", NotEqual, []string{"db", "mail"}}}}, []string{"web", "cache"}, nil},
+	"TestFilterNotEqual":      {QueryOptions{Filters: []Filter{{"port", NotEqual, []string{"22"}}}}, []string{"db", "mail"}, nil},
+	"TestFilterPrefix":        {QueryOptions{Filters: []Filter{{"username", Equal, []string{"post*"}}}}, []string{"db", "mail"}, nil},
+	"TestFilterGlob":          {QueryOptions{Filters: []Filter{{"hostname", Equal, []string{"?.example.*"}}}}, []string{"web", "db", "cache", "mail"}, nil},
+	"TestFilterGlobSuffix":    {QueryOptions{Filters: []Filter{{"hostname", Equal, []string{"a.*"}}}}, []string{"db", "mail"}, nil},
+	"TestFilterGlobLiteral":   {QueryOptions{Filters: []Filter{{"hostname", Equal, []string{"a%"}}}}, []string{}, nil},
+	"TestFilterNotGlob":       {QueryOptions{Filters: []Filter{{"username", NotEqual, []string{"post*"}}}}, []string{"web", "cache"}, nil},
+	"TestFilterRange":         {QueryOptions{Filters: []Filter{{"port", GreaterOrEqual, []string{"25"}}, {"port", Less, []string{"5432"}}}}, []string{"mail"}, nil},
+	"TestFilterGreater":       {QueryOptions{Filters: []Filter{{"port", Greater, []string{"25"}}}}, []string{"db"}, nil},
+	"TestFilterLessOrEqual":   {QueryOptions{Filters: []Filter{{"port", LessOrEqual, []string{"22"}}}}, []string{"web", "cache"}, nil},
+	"TestStringRange":         {QueryOptions{Filters: []Filter{{"name", Less, []string{"m"}}}}, []string{}, InvalidOperatorErr},
+	"TestRangeList":           {QueryOptions{Filters: []Filter{{"port", Less, []string{"1", "2"}}}}, []string{}, InvalidValueErr},
+	"TestUnknownOperator":     {QueryOptions{Filters: []Filter{{"port", "~", []string{"1"}}}}, []string{}, InvalidOperatorErr},
+	"TestAfterID":             {QueryOptions{After: &Position{ID: 2}}, []string{"cache", "mail"}, nil},
+	"TestBeforeID":            {QueryOptions{Before: &Position{ID: 3}, Limit: 1}, []string{"db"}, nil},
+	"TestAfterName":           {QueryOptions{Sort: sortBy("name"), After: &Position{Values: []string{"db"}, ID: 2}, Limit: 1}, []string{"mail"}, nil},
+	"TestBeforeName":          {QueryOptions{Sort: sortBy("name"), Before: &Position{Values: []string{"web"}, ID: 1}, Limit: 2}, []string{"db", "mail"}, nil},
+	"TestAfterPortTie":        {QueryOptions{Sort: sortBy("port"), After: &Position{Values: []string{"22"}, ID: 1}}, []string{"cache", "mail", "db"}, nil},
+	"TestBeforePortTie":       {QueryOptions{Sort: sortBy("port"), Before: &Position{Values: []string{"22"}, ID: 3}}, []string{"web"}, nil},
+	"TestAfterMissing":        {QueryOptions{Sort: sortBy("name"), After: &Position{Values: []string{"d"}, ID: 100}}, []string{"db", "mail", "web"}, nil},
+	"TestAfterFiltered":       {QueryOptions{Filters: []Filter{{"port", Equal, []string{"22"}}}, After: &Position{ID: 1}}, []string{"cache"}, nil},
+	"TestInvalidPosition":     {QueryOptions{Sort: sortBy("port"), After: &Position{Values: []string{"ssh"}, ID: 1}}, []string{}, InvalidValueErr},
+	"TestSortMultiple":        {QueryOptions{Sort: sortBy("port,name")}, []string{"cache", "web", "mail", "db"}, nil},
+	"TestSortDescending":      {QueryOptions{Sort: sortBy("-port,-name")}, []string{"db", "mail", "web", "cache"}, nil},
+	"TestSortMixed":           {QueryOptions{Sort: sortBy("-username,hostname")}, []string{"db", "mail", "web", "cache"}, nil},
+	"TestAfterDescending":     {QueryOptions{Sort: sortBy("-port,name"), After: &Position{Values: []string{"25", "mail"}, ID: 4}}, []string{"cache", "web"}, nil},
+	"TestAfterDescendingTie":  {QueryOptions{Sort: sortBy("-port,name"), After: &Position{Values: []string{"22", "cache"}, ID: 3}}, []string{"web"}, nil},
+	"TestBeforeDescending":    {QueryOptions{Sort: sortBy("-port,name"), Before: &Position{Values: []string{"22", "web"}, ID: 1}, Limit: 2}, []string{"mail", "cache"}, nil},
+	"TestDuplicateSortKey":    {QueryOptions{Sort: sortBy("port,-port")}, []string{}, DuplicateSortKeyErr},
+	"TestPositionMissingKeys": {QueryOptions{Sort: sortBy("port,name"), After: &Position{Values: []string{"22"}, ID: 1}}, []string{}, InvalidValueErr},
+	"TestUnknownSort":         {QueryOptions{Sort: sortBy("password")}, []string{}, UnknownFieldErr},
+	"TestUnknownFilter":       {QueryOptions{Filters: []Filter{{"password", Equal, []string{"x"}}}}, []string{}, UnknownFieldErr},
+	"TestNegativeOffset":      {QueryOptions{Offset: -1}, []string{}, NegativePageErr},
+	"TestNegativeLimit":       {QueryOptions{Limit: -1}, []string{}, NegativePageErr},
+	"TestInvalidIntFilter":    {QueryOptions{Filters: []Filter{{"port", Equal, []string{"ssh"}}}}, []string{}, InvalidValueErr},
+	"TestIntFilterOverflow":   {QueryOptions{Filters: []Filter{{"id", Greater, []string{"-2147483649"}}}}, []string{}, InvalidValueErr},
+	"TestPositionOverflow":    {QueryOptions{Sort: sortBy("port"), After: &Position{Values: []string{"4294967318"}, ID: 1}}, []string{}, InvalidValueErr},
+}
+
+// naturalConfigs have names in both cases so that the stores can be checked
+// to order text the same way.
+var naturalConfigs = []Configuration{
+	{Name: "b1", HostName: "b1.example.com", Port: 22, Username: "deploy"},
+	{Name: "B2", HostName: "b2.example.com", Port: 22, Username: "deploy"},
+	{Name: "a10", HostName: "a10.example.com", Port: 22, Username: "deploy"},
+	{Name: "a2", HostName: "a2.example.com", Port: 22, Username: "deploy"},
+	{Name: "A1", HostName: "a1.example.com", Port: 22, Username: "deploy"},
+	{Name: "a-1", HostName: "a-1.example.com", Port: 22, Username: "deploy"},
+	{Name: "a02", HostName: "a02.example.com", Port: 22, Username: "deploy"},
+}
+
+var naturalTests = map[string]listTest{
+	"TestSortMixedCase":           {QueryOptions{Sort: sortBy("name")}, []string{"A1", "B2", "a-1", "a02", "a10", "a2", "b1"}, nil},
+	"TestSortNatural":             {QueryOptions{Sort: naturalSort("name", false)}, []string{"A1", "B2", "a-1", "a2", "a02", "a10", "b1"}, nil},
+	"TestSortNaturalIgnoreCase":   {QueryOptions{Sort: naturalSort("name", true)}, []string{"a-1", "A1", "a2", "a02", "a10", "b1", "B2"}, nil},
+	"TestSortNaturalDescending":   {QueryOptions{Sort: naturalSort("-name", false)}, []string{"b1", "a10", "a2", "a02", "a-1", "B2", "A1"}, nil},
+	"TestAfterNatural":            {QueryOptions{Sort: naturalSort("name", false), After: &Position{Values: []string{"a2"}, ID: 4}}, []string{"a02", "a10", "b1"}, nil},
+	"TestBeforeNaturalIgnoreCase": {QueryOptions{Sort: naturalSort("name", true), Before: &Position{Values: []string{"a10"}, ID: 3}}, []string{"a-1", "A1", "a2", "a02"}, nil},
+}
+
+// sortBy returns the sort of the list whether or not it is valid.
+func sortBy(list string) Sort {
+	s, _ := ParseSort(list)
+	return s
+}
+
+// naturalSort returns the natural sort of the list.
+func naturalSort(list string, ignoreCase bool) Sort {
+	s := sortBy(list)
+	s.Natural, s.IgnoreCase = true, ignoreCase
+	return s
+}
+
+func TestList(t *testing.T) {
+	runStoreTests(t, listed(listTests), listConfigs)
+}
+
+func TestNaturalSort(t *testing.T) {
+	runStoreTests(t, listed(naturalTests), naturalConfigs)
+}
+
+// listed returns store tests that check the names of the configurations
+// that List returns.
+func listed(tests map[string]listTest) map[string]storeTest {
+	storeTests := make(map[string]storeTest, len(tests))
+	for name, test := range tests {
+		storeTests[name] = func(cs ConfigurationStore) error {
+			configs, err := cs.List(test.opts)
+			if err != test.err {
+				return failure{"Wrong error", test.err, err}
+			}
+			if names := configNames(configs); !reflect.DeepEqual(names, test.expected) {
+				return failure{"", test.expected, names}
+			}
+			return nil
+		}
+	}
+	return storeTests
+}
+
+func TestCount(t *testing.T) {
+	ms := NewMemoryStore()
+	ms.Add(listConfigs...)
+
+	count, err := ms.Count(QueryOptions{Filters: []Filter{{"port", Equal, []string{"22"}}}, Limit: 1, After: &Position{ID: 1}})
+	if err != nil || count != 2 {
+		t.Error("Failed:", failure{"Count should ignore positions and limits", 2, count})
+	}
+}
@@ -0,0 +1,86 @@
+package configuration
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var RankedPositionErr = errors.New("Search results ordered by rank cannot be listed from a position")
+
+// searchFields are the fields that a search looks through.
+var searchFields = []string{"name", "hostname", "username"}
+
+// searchTerms splits the search into the lower case words that must each be
+// found in a searched field.
+func searchTerms(search string) []string {
+	return strings.Fields(strings.ToLower(search))
+}
+
+// rank returns how well the configuration matches the terms of a search or
+// 0 if it does not match. Each term scores 3 if it is a whole field, 2 if it
+// starts a field and 1 if it is found anywhere in a field.
+func rank(config Configuration, terms []string) (score int) {
+	for _, term := range terms {
+		best := 0
+		for _, name := range searchFields {
+			value := strings.ToLower(fmt.Sprint(field(config, name)))
+			switch {
+			case value == term:
+				best = 3
+			case strings.HasPrefix(value, term) && best < 2:
+				best = 2
+			case strings.Contains(value, term) && best < 1:
+				best = 1
+			}
+		}
+		if best == 0 {
+			return 0
+		}
+		score += best
+	}
+	return score
+}
+
+// writeSearch writes the SQL condition that selects the configurations that
+// contain every term of the search in one of their searched fields to the
+// buffer. The trigram indexes on the fields serve the ILIKE comparisons.
+func writeSearch(buff *bytes.Buffer, search string, args []interface{}) []interface{} {
+	for index, term := range searchTerms(search) {
+		if index > 0 {
+			buff.WriteString(" AND ")
+		}
+		args = append(args, "%"+escapeLike(term)+"%")
+		buff.WriteString("(")
+		for i, name := range searchFields {
+			if i > 0 {
+				buff.WriteString(" OR ")
+			}
+			fmt.Fprintf(buff, "%s ILIKE $%d", columns[name], len(args))
+		}
+		buff.WriteString(")")
+	}
+	return args
+}
+
+// writeRank writes the SQL expression that ranks the configurations found by
+// the search to the buffer. It scores the fields the same way as rank.
+func writeRank(buff *bytes.Buffer, search string, args []interface{}) []interface{} {
+	for index, term := range searchTerms(search) {
+		if index > 0 {
+			buff.WriteString(" + ")
+		}
+		args = append(args, term, escapeLike(term)+"%", "%"+escapeLike(term)+"%")
+		exact, prefix, contains := len(args)-2, len(args)-1, len(args)
+
+		scores := make([]string, 0, len(searchFields))
+		for _, name := range searchFields {
+			column := "lower(" + columns[name] + ")"
+			scores = append(scores, fmt.Sprintf("CASE WHEN %s = $%d THEN 3 WHEN %s LIKE $%d THEN 2 WHEN %s LIKE $%d THEN 1 ELSE 0 END",
+				column, exact, column, prefix, column, contains))
+		}
+		buff.WriteString("GREATEST(" + strings.Join(scores, ", ") + ")")
+	}
+	return args
+}
@@ -0,0 +1,57 @@
+package configuration
+
+import (
+	"reflect"
+	"testing"
+)
+
+var searchConfigs = []Configuration{
+	{Name: "payments-db", HostName: "db1.prod.example.com", Port: 5432, Username: "postgres"},
+	{Name: "web", HostName: "web.prod.example.com", Port: 22, Username: "deploy"},
+	{Name: "db", HostName: "db.staging.example.com", Port: 5432, Username: "deploy"},
+	{Name: "legacy", HostName: "10.0.0.5", Port: 22, Username: "DB_ADMIN"},
+}
+
+var searchTests = map[string]struct {
+	opts     QueryOptions
+	expected []string
+}{
+	"TestSearchRanked":         {QueryOptions{Search: "db"}, []string{"db", "payments-db", "legacy"}},
+	"TestSearchIgnoresCase":    {QueryOptions{Search: "DB_admin"}, []string{"legacy"}},
+	"TestSearchHostName":       {QueryOptions{Search: "prod"}, []string{"payments-db", "web"}},
+	"TestSearchEveryWord":      {QueryOptions{Search: "deploy staging"}, []string{"db"}},
+	"TestSearchNoMatch":        {QueryOptions{Search: "mail"}, []string{}},
+	"TestSearchLiteral":        {QueryOptions{Search: "db%"}, []string{}},
+	"TestSearchSorted":         {QueryOptions{Search: "db", Sort: sortBy("-name")}, []string{"payments-db", "legacy", "db"}},
+	"TestSearchFiltered":       {QueryOptions{Search: "db", Filters: []Filter{{"port", Equal, []string{"5432"}}}}, []string{"db", "payments-db"}},
+	"TestSearchPaged":          {QueryOptions{Search: "db", Offset: 1, Limit: 1}, []string{"payments-db"}},
+	"TestSearchOnlyWhitespace": {QueryOptions{Search: "  "}, []string{"payments-db", "web", "db", "legacy"}},
+}
+
+func TestSearch(t *testing.T) {
+	storeTests := make(map[string]storeTest, len(searchTests))
+	for name, test := range searchTests {
+		storeTests[name] = func(cs ConfigurationStore) error {
+			configs, err := cs.List(test.opts)
+			if err != nil {
+				return err
+			}
+			if names := configNames(configs); !reflect.DeepEqual(names, test.expected) {
+				return failure{"", test.expected, names}
+			}
+			count, err := cs.Count(test.opts)
+			if test.opts.Limit == 0 && (err != nil || count != len(test.expected)) {
+				return failure{"Wrong count", len(test.expected), count}
+			}
+			return nil
+		}
+	}
+	runStoreTests(t, storeTests, searchConfigs)
+}
+
+func TestRankedPosition(t *testing.T) {
+	opts := QueryOptions{Search: "db", After: &Position{ID: 1}}
+	if err := opts.Validate(); err != RankedPositionErr {
+		t.Error("Failed:", failure{"", RankedPositionErr, err})
+	}
+}
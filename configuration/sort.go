@@ -0,0 +1,258 @@
+package configuration
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var DuplicateSortKeyErr = errors.New("Configuration field is sorted on more than once")
+
+// SortKey is a field that configurations are sorted by.
+type SortKey struct {
+	Field      string
+	Descending bool
+}
+
+// Sort orders configurations by each of its keys in turn. Configurations
+// that are equal in every key are ordered by id so that the order is stable.
+type Sort struct {
+	Keys []SortKey
+
+	// IgnoreCase compares text fields without regard to case.
+	IgnoreCase bool
+
+	// Natural compares runs of digits in text fields by their numeric value
+	// so that "web2" is ordered before "web10".
+	Natural bool
+}
+
+// ParseSort returns the sort of a comma separated list of fields, each of
+// which is sorted in descending order if it starts with "-", such as
+// "-port,name".
+func ParseSort(list string) (s Sort, err error) {
+	for _, name := range strings.Split(list, ",") {
+		key := SortKey{Field: strings.TrimSpace(name)}
+		if strings.HasPrefix(key.Field, "-") {
+			key.Field, key.Descending = key.Field[1:], true
+		}
+		s.Keys = append(s.Keys, key)
+	}
+	return s, s.Validate()
+}
+
+// Validate returns UnknownFieldErr if a key is not a field of a
+// configuration and DuplicateSortKeyErr if a field is sorted on twice.
+func (s Sort) Validate() error {
+	seen := make(map[string]bool, len(s.Keys))
+	for _, key := range s.Keys {
+		if !IsField(key.Field) {
+			return UnknownFieldErr
+		}
+		if seen[key.Field] {
+			return DuplicateSortKeyErr
+		}
+		seen[key.Field] = true
+	}
+	return nil
+}
+
+// String returns the sort in the form read by ParseSort followed by its
+// options.
+func (s Sort) String() string {
+	names := make([]string, 0, len(s.Keys))
+	for _, key := range s.Keys {
+		if key.Descending {
+			names = append(names, "-"+key.Field)
+		} else {
+			names = append(names, key.Field)
+		}
+	}
+	str := strings.Join(names, ",")
+	if s.IgnoreCase {
+		str += ";ignore_case"
+	}
+	if s.Natural {
+		str += ";natural"
+	}
+	return str
+}
+
+// Compare returns a negative number if x is ordered before y, a positive
+// number if x is ordered after y and 0 if they are the same configuration.
+func (s Sort) Compare(x, y Configuration) int {
+	return s.compare(s.values(x), x.ID, s.values(y), y.ID)
+}
+
+// values returns the values of the configuration's fields that are sorted on.
+func (s Sort) values(config Configuration) []string {
+	values := make([]string, 0, len(s.Keys))
+	for _, key := range s.Keys {
+		values = append(values, fmt.Sprint(field(config, key.Field)))
+	}
+	return values
+}
+
+// compare compares the sorted on values and ids of two configurations.
+func (s Sort) compare(x []string, xID int, y []string, yID int) int {
+	for i, key := range s.Keys {
+		c := s.compareField(key.Field, x[i], y[i])
+		if key.Descending {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return compareInts(xID, yID)
+}
+
+// compareField compares two values of the field.
+func (s Sort) compareField(name, x, y string) int {
+	if isNumeric(name) {
+		a, _ := parseNumber(x)
+		b, _ := parseNumber(y)
+		return compareInts(a, b)
+	}
+	if s.IgnoreCase {
+		x, y = strings.ToLower(x), strings.ToLower(y)
+	}
+	if s.Natural {
+		x, y = naturalKey(x), naturalKey(y)
+	}
+	return strings.Compare(x, y)
+}
+
+func compareInts(x, y int) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// naturalKey returns the key that the string is ordered by in a natural
+// sort. Every run of digits is replaced by the number of digits of its
+// length, its length and its digits without leading zeros, so that keys
+// compared byte by byte compare runs of digits by their numeric value and
+// everything else byte by byte. The natural_key function in
+// env/create_db.sql computes the same key in Postgres.
+func naturalKey(s string) string {
+	var buff bytes.Buffer
+	for s != "" {
+		var run string
+		run, s = nextRun(s)
+		if !isDigit(run[0]) {
+			buff.WriteString(run)
+			continue
+		}
+		number := strings.TrimLeft(run, "0")
+		length := strconv.Itoa(len(number))
+		buff.WriteString(strconv.Itoa(len(length)))
+		buff.WriteString(length)
+		buff.WriteString(number)
+	}
+	return buff.String()
+}
+
+// nextRun splits off the leading run of digits or of other characters.
+func nextRun(s string) (run, rest string) {
+	digits := isDigit(s[0])
+	i := 1
+	for i < len(s) && isDigit(s[i]) == digits {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+func isDigit(b byte) bool {
+	return '0' <= b && b <= '9'
+}
+
+// expression returns the SQL expression that the key orders by. Text is
+// compared byte by byte, as it is in memory, and if the sort is natural it
+// is compared by its natural_key.
+func (s Sort) expression(key SortKey, operand string) string {
+	if isNumeric(key.Field) {
+		return operand
+	}
+	if s.IgnoreCase {
+		operand = "lower(" + operand + ")"
+	}
+	if s.Natural {
+		operand = "natural_key(" + operand + ")"
+	}
+	return operand + ` COLLATE "C"`
+}
+
+// orderBy returns the SQL ORDER BY list of the sort.
+func (s Sort) orderBy(reverse bool) string {
+	terms := make([]string, 0, len(s.Keys)+1)
+	for _, key := range s.Keys {
+		terms = append(terms, s.expression(key, columns[key.Field])+" "+direction(key.Descending != reverse))
+	}
+	terms = append(terms, "id "+direction(reverse))
+	return strings.Join(terms, ", ")
+}
+
+func direction(descending bool) string {
+	if descending {
+		return "DESC"
+	}
+	return "ASC"
+}
+
+// writePosition writes the SQL condition that selects the configurations
+// ordered after the position, or before it if after is false, to the
+// buffer and returns the arguments with the position's values appended.
+func (s Sort) writePosition(buff *bytes.Buffer, position Position, after bool, args []interface{}) []interface{} {
+	params := make([]string, 0, len(s.Keys))
+	for i, key := range s.Keys {
+		var value interface{} = position.Values[i]
+		operand := "$%d"
+		if isNumeric(key.Field) {
+			value, _ = parseNumber(position.Values[i])
+		} else {
+			operand = "$%d::text"
+		}
+		args = append(args, value)
+		params = append(params, s.expression(key, fmt.Sprintf(operand, len(args))))
+	}
+	args = append(args, position.ID)
+
+	// The configuration is after the position if it is equal in the keys
+	// before some key and after it in that key, or equal in every key and
+	// after it in id.
+	buff.WriteString("(")
+	for i := 0; i <= len(s.Keys); i++ {
+		if i > 0 {
+			buff.WriteString(" OR ")
+		}
+		buff.WriteString("(")
+		for j := 0; j < i; j++ {
+			fmt.Fprintf(buff, "%s = %s AND ", s.expression(s.Keys[j], columns[s.Keys[j].Field]), params[j])
+		}
+		if i < len(s.Keys) {
+			key := s.Keys[i]
+			fmt.Fprintf(buff, "%s %s %s", s.expression(key, columns[key.Field]), comparison(key.Descending == after), params[i])
+		} else {
+			fmt.Fprintf(buff, "id %s $%d", comparison(!after), len(args))
+		}
+		buff.WriteString(")")
+	}
+	buff.WriteString(")")
+	return args
+}
+
+// comparison returns the SQL operator that selects what is ordered before a
+// value if before is true or after it otherwise.
+func comparison(before bool) string {
+	if before {
+		return "<"
+	}
+	return ">"
+}
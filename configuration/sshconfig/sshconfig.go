@@ -0,0 +1,233 @@
+// Package sshconfig renders configurations as an OpenSSH client
+// configuration, the format of ~/.ssh/config, and parses one back into
+// configurations.
+package sshconfig
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/warrenharper/restapi/configuration"
+)
+
+// DefaultPort is the port that ssh uses when a host has no Port.
+const DefaultPort = 22
+
+var IncludeErr = errors.New("Include cannot be resolved, parse the included files instead")
+var MissingValueErr = errors.New("Option has no value")
+var MalformedPortErr = errors.New("Port must be a number")
+var UnterminatedQuoteErr = errors.New("Quote is not terminated")
+
+// ParseError is returned when a line of a configuration cannot be parsed.
+// Line counts from 1.
+type ParseError struct {
+	Line int
+	Err  error
+}
+
+func (pe ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s", pe.Line, pe.Err.Error())
+}
+
+// Write writes a Host block for each configuration, named after the
+// configuration, that sets its HostName, Port and User.
+func Write(w io.Writer, configs []configuration.Configuration) error {
+	buff := bufio.NewWriter(w)
+	for i, config := range configs {
+		if i > 0 {
+			buff.WriteString("\n")
+		}
+		fmt.Fprintf(buff, "Host %s\n", config.Name)
+		fmt.Fprintf(buff, "    HostName %s\n", config.HostName)
+		fmt.Fprintf(buff, "    Port %d\n", config.Port)
+		fmt.Fprintf(buff, "    User %s\n", config.Username)
+	}
+	return buff.Flush()
+}
+
+// block is a Host block: its patterns and the options that it sets in
+// order. The options that come before the first Host apply to every host.
+type block struct {
+	patterns []string
+	options  []option
+}
+
+type option struct {
+	keyword string
+	value   string
+}
+
+// Parse returns a configuration for every host that the Host lines name
+// without a wildcard, in the order they are named. As in ssh, each of their
+// HostName, Port and User is the first value set by a block whose patterns
+// match the host, so blocks such as "Host *" provide defaults. A host
+// without a HostName has its own name as its host name and one without a
+// Port has DefaultPort. "%h" in a HostName is replaced by the host. Match
+// blocks are ignored because they depend on the client, as are options other
+// than HostName, Port and User. Include cannot be resolved so it returns a
+// ParseError of IncludeErr.
+func Parse(r io.Reader) (configs []configuration.Configuration, err error) {
+	blocks, hosts, err := parseBlocks(r)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, host := range hosts {
+		config := configuration.Configuration{Name: host}
+		for _, b := range blocks {
+			if b.patterns != nil && !matches(b.patterns, host) {
+				continue
+			}
+			for _, o := range b.options {
+				switch {
+				case o.keyword == "hostname" && config.HostName == "":
+					config.HostName = strings.Replace(o.value, "%h", host, -1)
+				case o.keyword == "port" && config.Port == 0:
+					config.Port, _ = strconv.Atoi(o.value)
+				case o.keyword == "user" && config.Username == "":
+					config.Username = o.value
+				}
+			}
+		}
+		if config.HostName == "" {
+			config.HostName = host
+		}
+		if config.Port == 0 {
+			config.Port = DefaultPort
+		}
+		configs = append(configs, config)
+	}
+	return configs, nil
+}
+
+// parseBlocks returns the blocks of the configuration and the hosts that are
+// named without a wildcard.
+func parseBlocks(r io.Reader) (blocks []block, hosts []string, err error) {
+	seen := make(map[string]bool)
+	current := &block{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		keyword, args, err := splitLine(scanner.Text())
+		if err != nil {
+			return nil, nil, ParseError{line, err}
+		}
+		if keyword == "" {
+			continue
+		}
+		if len(args) == 0 {
+			return nil, nil, ParseError{line, MissingValueErr}
+		}
+
+		switch keyword {
+		case "host":
+			blocks = append(blocks, *current)
+			current = &block{patterns: args}
+			for _, pattern := range args {
+				if !strings.ContainsAny(pattern, "*?!") && !seen[pattern] {
+					seen[pattern] = true
+					hosts = append(hosts, pattern)
+				}
+			}
+		case "match":
+			blocks = append(blocks, *current)
+			current = &block{patterns: []string{}}
+		case "include":
+			return nil, nil, ParseError{line, IncludeErr}
+		case "port":
+			if _, err := strconv.Atoi(args[0]); err != nil {
+				return nil, nil, ParseError{line, MalformedPortErr}
+			}
+			fallthrough
+		default:
+			current.options = append(current.options, option{keyword, args[0]})
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return append(blocks, *current), hosts, nil
+}
+
+// splitLine returns the lower case keyword of a line and its arguments. The
+// keyword may be separated from the arguments by whitespace or an '=' and
+// arguments may be quoted. Blank lines and comments have no keyword.
+func splitLine(line string) (keyword string, args []string, err error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", nil, nil
+	}
+
+	end := strings.IndexAny(line, " \t=")
+	if end < 0 {
+		return strings.ToLower(line), nil, nil
+	}
+	keyword, line = strings.ToLower(line[:end]), strings.TrimSpace(line[end:])
+	line = strings.TrimSpace(strings.TrimPrefix(line, "="))
+
+	for line != "" {
+		if line[0] == '"' {
+			end := strings.IndexByte(line[1:], '"')
+			if end < 0 {
+				return "", nil, UnterminatedQuoteErr
+			}
+			args, line = append(args, line[1:end+1]), strings.TrimSpace(line[end+2:])
+			continue
+		}
+		end := strings.IndexAny(line, " \t")
+		if end < 0 {
+			end = len(line)
+		}
+		args, line = append(args, line[:end]), strings.TrimSpace(line[end:])
+	}
+	return keyword, args, nil
+}
+
+// matches determines if the host matches the patterns of a Host line. The
+// host must match one of the patterns and none of those that are negated
+// with a '!'. Patterns are matched case insensitively, see matchPattern.
+func matches(patterns []string, host string) bool {
+	matched := false
+	host = strings.ToLower(host)
+	for _, pattern := range patterns {
+		negated := strings.HasPrefix(pattern, "!")
+		pattern = strings.ToLower(strings.TrimPrefix(pattern, "!"))
+		if matchPattern(pattern, host) {
+			if negated {
+				return false
+			}
+			matched = true
+		}
+	}
+	return matched
+}
+
+// matchPattern reports whether the host matches the pattern, in which '*'
+// matches any run of characters and '?' any one character, as in ssh. Every
+// other character, including '[', only matches itself.
+func matchPattern(pattern, host string) bool {
+	p, h := 0, 0
+	star, mark := -1, 0
+	for h < len(host) {
+		switch {
+		case p < len(pattern) && pattern[p] == '*':
+			star, mark = p, h
+			p++
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == host[h]):
+			p++
+			h++
+		case star >= 0:
+			mark++
+			p, h = star+1, mark
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
@@ -0,0 +1,125 @@
+package sshconfig
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/warrenharper/restapi/configuration"
+)
+
+type failure struct {
+	Prefix   string
+	Expected interface{}
+	Actual   interface{}
+}
+
+func (f failure) Error() string {
+	str := f.Prefix
+	if f.Expected != nil {
+		str += fmt.Sprintf("\n Expected: %v", f.Expected)
+	}
+
+	if f.Actual != nil {
+		str += fmt.Sprintf("\n Actual: %v", f.Actual)
+	}
+
+	return str
+}
+
+var baseConfigs = []configuration.Configuration{
+	{Name: "web", HostName: "web.example.com", Port: 22, Username: "deploy"},
+	{Name: "db", HostName: "db.example.com", Port: 5432, Username: "postgres"},
+}
+
+const rendered = `Host web
+    HostName web.example.com
+    Port 22
+    User deploy
+
+Host db
+    HostName db.example.com
+    Port 5432
+    User postgres
+`
+
+func TestWrite(t *testing.T) {
+	buff := &bytes.Buffer{}
+	if err := Write(buff, baseConfigs); err != nil {
+		t.Fatal(err)
+	}
+	if buff.String() != rendered {
+		t.Error("Failed:", failure{"", rendered, buff.String()})
+	}
+}
+
+var parseTests = map[string]struct {
+	config   string
+	expected []configuration.Configuration
+	err      error
+}{
+	"TestParseRendered": {rendered, baseConfigs, nil},
+	"TestParseDefaults": {
+		"User root\n\nHost web *.internal\n  Port 2222\n\nHost *\n  User deploy\n  Port 23\n",
+		[]configuration.Configuration{{Name: "web", HostName: "web", Port: 2222, Username: "root"}},
+		nil,
+	},
+	"TestParseFirstValueWins": {
+		"Host web\n  User deploy\n  User root\n\nHost w*\n  HostName %h.example.com\n  Port 8022\n",
+		[]configuration.Configuration{{Name: "web", HostName: "web.example.com", Port: 8022, Username: "deploy"}},
+		nil,
+	},
+	"TestParseNegatedPattern": {
+		"Host web db\n  User deploy\n\nHost * !db\n  Port 2222\n",
+		[]configuration.Configuration{
+			{Name: "web", HostName: "web", Port: 2222, Username: "deploy"},
+			{Name: "db", HostName: "db", Port: DefaultPort, Username: "deploy"},
+		},
+		nil,
+	},
+	"TestParseSyntax": {
+		"# Comment\nHOST=web\n\tHostname = \"web.example.com\"\n\tidentityfile ~/.ssh/id_web\n",
+		[]configuration.Configuration{{Name: "web", HostName: "web.example.com", Port: DefaultPort}},
+		nil,
+	},
+	"TestParseIgnoresMatch": {
+		"Host web\n  User deploy\n\nMatch host web exec \"true\"\n  Port 2222\n",
+		[]configuration.Configuration{{Name: "web", HostName: "web", Port: DefaultPort, Username: "deploy"}},
+		nil,
+	},
+	"TestParseWildcards": {
+		"Host web-01.prod db\n\nHost web-??.*\n  User deploy\n\nHost *\n  User root\n",
+		[]configuration.Configuration{
+			{Name: "web-01.prod", HostName: "web-01.prod", Port: DefaultPort, Username: "deploy"},
+			{Name: "db", HostName: "db", Port: DefaultPort, Username: "root"},
+		},
+		nil,
+	},
+	"TestParseBrackets": {
+		"Host web1 web[12]\n\nHost web[12]\n  Port 2222\n",
+		[]configuration.Configuration{
+			{Name: "web1", HostName: "web1", Port: DefaultPort},
+			{Name: "web[12]", HostName: "web[12]", Port: 2222},
+		},
+		nil,
+	},
+	"TestParseInclude":           {"Include ~/.ssh/config.d/*\n", nil, ParseError{1, IncludeErr}},
+	"TestParseMalformedPort":     {"Host web\n  Port ssh\n", nil, ParseError{2, MalformedPortErr}},
+	"TestParseMissingValue":      {"Host web\n  User\n", nil, ParseError{2, MissingValueErr}},
+	"TestParseUnterminatedQuote": {"Host web\n  User \"deploy\n", nil, ParseError{2, UnterminatedQuoteErr}},
+}
+
+func TestParse(t *testing.T) {
+	for name, test := range parseTests {
+		configs, err := Parse(strings.NewReader(test.config))
+		if err != test.err {
+			t.Errorf("%s Failed: %s", name, failure{"Wrong error", test.err, err})
+			continue
+		}
+		if !reflect.DeepEqual(configs, test.expected) {
+			t.Errorf("%s Failed: %s", name, failure{"", test.expected, configs})
+		}
+	}
+}
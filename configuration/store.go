@@ -0,0 +1,74 @@
+package configuration
+
+// ConfigurationStore is the storage used to persist configurations along with
+// the revisions made to them. ConfigurationController stores configurations
+// in Postgres and MemoryStore keeps them in memory.
+type ConfigurationStore interface {
+	// GetAll returns a list of all of the stored configurations
+	GetAll() ([]Configuration, error)
+
+	// List returns the configurations that match the options. The options
+	// must be valid.
+	List(opts QueryOptions) ([]Configuration, error)
+
+	// Count returns the number of configurations that match the filters and
+	// search of the options. The options must be valid.
+	Count(opts QueryOptions) (int, error)
+
+	// Get returns the configurations whose names match the arguments. If any
+	// of the configurations cannot be found a DoesNotExistErr is returned.
+	Get(names ...string) ([]Configuration, error)
+
+	// Add adds all of the configurations or none of them. It returns an Error
+	// with an Err of DuplicateConfigErr if a name is already taken and a
+	// ValidationError if attributes do not satisfy the schema.
+	Add(configs ...Configuration) ([]Configuration, error)
+
+	// Delete deletes all of the configurations whose name is in the
+	// arguments. Names that cannot be found are ignored.
+	Delete(names ...string) error
+
+	// DeleteVersion deletes the configuration with the name only if its
+	// version matches. Otherwise VersionMismatchErr is returned.
+	DeleteVersion(name string, version int) error
+
+	// Modify applies the patch to the configuration named name and returns
+	// the updated configuration. No other change can be made to the
+	// configuration while the patch is applied. A Configuration is a patch
+	// that sets the fields that are set in it; see Patch for the others. If
+	// the attributes do not satisfy the schema a ValidationError is
+	// returned.
+	Modify(name string, patch Patch) (Configuration, error)
+
+	// Batch carries out the operations in order and returns their results.
+	// If atomic is set either every operation is made or none are, and the
+	// failure of an operation is returned as a BatchError. Otherwise the
+	// operations are made independently and their failures are only
+	// reported in their results.
+	Batch(ops []Operation, atomic bool) ([]OperationResult, error)
+
+	// Schema returns the schema that the attributes of configurations must
+	// satisfy.
+	Schema() (AttributeSchema, error)
+
+	// SetSchema replaces the schema that the attributes of configurations
+	// must satisfy and returns it with its author. If the schema is invalid a
+	// ValidationError is returned.
+	SetSchema(schema AttributeSchema) (AttributeSchema, error)
+
+	// As returns a view of the store that records actor as the author of
+	// the revisions that Add, Delete, Modify and Rollback make and of the
+	// schema that SetSchema sets.
+	As(actor string) ConfigurationStore
+
+	// History returns every revision of the configuration with the name,
+	// oldest first. The name may be the name of a deleted configuration.
+	// If there are no revisions DoesNotExistErr is returned.
+	History(name string) ([]Revision, error)
+
+	// Rollback restores the configuration with the name to how it was right
+	// after the revision with the id and records that as a new revision. If
+	// the revision is not one of the configuration's revisions
+	// RevisionDoesNotExistErr is returned.
+	Rollback(name string, revisionID int) (Configuration, error)
+}
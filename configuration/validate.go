@@ -0,0 +1,157 @@
+package configuration
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	maxNameLength     = 64
+	maxHostNameLength = 253
+	maxUsernameLength = 32
+)
+
+// Fields are the names of the fields of a configuration as they appear in
+// JSON.
+var Fields = []string{"name", "hostname", "port", "username", "labels"}
+
+// ReservedNames cannot be used as the names of configurations because they
+// are paths of the API.
+var ReservedNames = map[string]bool{
+	"search":     true,
+	"schema":     true,
+	"batch":      true,
+	"lookup":     true,
+	"import":     true,
+	"export":     true,
+	"ssh_config": true,
+}
+
+var (
+	namePattern          = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+	hostNameLabelPattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?$`)
+	usernamePattern      = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._-]*$`)
+)
+
+// FieldError explains why the value of a field is invalid. Nested fields are
+// separated by dots, such as "attributes.timeout".
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned when the fields of a configuration or a schema
+// are invalid. It lists every invalid field.
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+func (ve ValidationError) Error() string {
+	messages := make([]string, 0, len(ve.Errors))
+	for _, fe := range ve.Errors {
+		messages = append(messages, fe.Field+": "+fe.Message)
+	}
+	return "Validation Error: " + strings.Join(messages, "; ")
+}
+
+// Validate returns a ValidationError listing every field of the
+// configuration that is missing or malformed. The attributes are checked by
+// the store against its schema.
+func (c Configuration) Validate() error {
+	return c.ValidateFields(Fields...)
+}
+
+// ValidateFields is like Validate but only checks the fields with the names,
+// such as the fields that are set by a modification.
+func (c Configuration) ValidateFields(fields ...string) error {
+	ve := ValidationError{}
+	for _, field := range fields {
+		switch field {
+		case "name":
+			ve.Errors = append(ve.Errors, validateName(c.Name)...)
+		case "hostname":
+			ve.Errors = append(ve.Errors, validateHostName(c.HostName)...)
+		case "port":
+			if c.Port < 1 || c.Port > 65535 {
+				ve.Errors = append(ve.Errors, FieldError{"port", "port must be between 1 and 65535"})
+			}
+		case "username":
+			ve.Errors = append(ve.Errors, validateUsername(c.Username)...)
+		case "labels":
+			ve.Errors = append(ve.Errors, c.Labels.fieldErrors()...)
+		}
+	}
+	if len(ve.Errors) > 0 {
+		return ve
+	}
+	return nil
+}
+
+func validateName(name string) []FieldError {
+	switch {
+	case name == "":
+		return []FieldError{{"name", "name is required"}}
+	case len(name) > maxNameLength:
+		return []FieldError{{"name", fmt.Sprintf("name must be at most %d characters", maxNameLength)}}
+	case !namePattern.MatchString(name):
+		return []FieldError{{"name", "name may only contain letters, digits, '.', '_' and '-' and must start with a letter or digit"}}
+	case ReservedNames[name]:
+		return []FieldError{{"name", fmt.Sprintf("name %q is reserved", name)}}
+	}
+	return nil
+}
+
+// validateHostName accepts IP addresses and hostnames made of labels of
+// letters, digits and hyphens that neither start nor end with a hyphen.
+func validateHostName(hostName string) []FieldError {
+	if hostName == "" {
+		return []FieldError{{"hostname", "hostname is required"}}
+	}
+	if net.ParseIP(hostName) != nil {
+		return nil
+	}
+	if len(hostName) <= maxHostNameLength {
+		valid := true
+		for _, label := range strings.Split(strings.TrimSuffix(hostName, "."), ".") {
+			valid = valid && hostNameLabelPattern.MatchString(label)
+		}
+		if valid {
+			return nil
+		}
+	}
+	return []FieldError{{"hostname", "hostname must be a valid hostname or IP address"}}
+}
+
+func validateUsername(username string) []FieldError {
+	switch {
+	case username == "":
+		return []FieldError{{"username", "username is required"}}
+	case len(username) > maxUsernameLength:
+		return []FieldError{{"username", fmt.Sprintf("username must be at most %d characters", maxUsernameLength)}}
+	case !usernamePattern.MatchString(username):
+		return []FieldError{{"username", "username may only contain letters, digits, '.', '_' and '-' and must not start with '.' or '-'"}}
+	}
+	return nil
+}
+
+// fieldErrors returns an error for every malformed label ordered by key.
+func (l Labels) fieldErrors() (errors []FieldError) {
+	keys := make([]string, 0, len(l))
+	for key := range l {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		switch {
+		case !labelKeyPattern.MatchString(key):
+			errors = append(errors, FieldError{"labels." + key, "label keys must be at most 63 letters, digits, '.', '_', '-' and '/' and must start and end with a letter or digit"})
+		case !labelValuePattern.MatchString(l[key]):
+			errors = append(errors, FieldError{"labels." + key, "label values must be at most 63 letters, digits, '.', '_' and '-' and must start and end with a letter or digit"})
+		}
+	}
+	return errors
+}
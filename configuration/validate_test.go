@@ -0,0 +1,68 @@
+package configuration
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var validConfig = Configuration{Name: "web-1.prod", HostName: "web.example.com", Port: 22, Username: "deploy"}
+
+var validationTests = map[string]struct {
+	change   func(*Configuration)
+	expected []FieldError
+}{
+	"TestValid":            {func(c *Configuration) {}, nil},
+	"TestValidIPv4":        {func(c *Configuration) { c.HostName = "10.0.0.5" }, nil},
+	"TestValidIPv6":        {func(c *Configuration) { c.HostName = "2001:db8::1" }, nil},
+	"TestValidRootedHost":  {func(c *Configuration) { c.HostName = "web.example.com." }, nil},
+	"TestValidMaxPort":     {func(c *Configuration) { c.Port = 65535 }, nil},
+	"TestValidLabels":      {func(c *Configuration) { c.Labels = Labels{"env": "prod"} }, nil},
+	"TestMissingFields":    {func(c *Configuration) { *c = Configuration{} }, []FieldError{{"name", "name is required"}, {"hostname", "hostname is required"}, {"port", "port must be between 1 and 65535"}, {"username", "username is required"}}},
+	"TestNameWithSpace":    {func(c *Configuration) { c.Name = "web 1" }, []FieldError{{"name", "name may only contain letters, digits, '.', '_' and '-' and must start with a letter or digit"}}},
+	"TestNameWithSlash":    {func(c *Configuration) { c.Name = "web/1" }, []FieldError{{"name", "name may only contain letters, digits, '.', '_' and '-' and must start with a letter or digit"}}},
+	"TestNameDotDot":       {func(c *Configuration) { c.Name = ".." }, []FieldError{{"name", "name may only contain letters, digits, '.', '_' and '-' and must start with a letter or digit"}}},
+	"TestNameTooLong":      {func(c *Configuration) { c.Name = strings.Repeat("a", 65) }, []FieldError{{"name", "name must be at most 64 characters"}}},
+	"TestNameReserved":     {func(c *Configuration) { c.Name = "search" }, []FieldError{{"name", `name "search" is reserved`}}},
+	"TestHostWithSpace":    {func(c *Configuration) { c.HostName = "web example.com" }, []FieldError{{"hostname", "hostname must be a valid hostname or IP address"}}},
+	"TestHostEmptyLabel":   {func(c *Configuration) { c.HostName = "web..example.com" }, []FieldError{{"hostname", "hostname must be a valid hostname or IP address"}}},
+	"TestHostHyphen":       {func(c *Configuration) { c.HostName = "-web.example.com" }, []FieldError{{"hostname", "hostname must be a valid hostname or IP address"}}},
+	"TestHostLongLabel":    {func(c *Configuration) { c.HostName = strings.Repeat("a", 64) + ".com" }, []FieldError{{"hostname", "hostname must be a valid hostname or IP address"}}},
+	"TestPortTooLarge":     {func(c *Configuration) { c.Port = 99999 }, []FieldError{{"port", "port must be between 1 and 65535"}}},
+	"TestPortNegative":     {func(c *Configuration) { c.Port = -22 }, []FieldError{{"port", "port must be between 1 and 65535"}}},
+	"TestUsernameSpace":    {func(c *Configuration) { c.Username = "de ploy" }, []FieldError{{"username", "username may only contain letters, digits, '.', '_' and '-' and must not start with '.' or '-'"}}},
+	"TestUsernameDash":     {func(c *Configuration) { c.Username = "-deploy" }, []FieldError{{"username", "username may only contain letters, digits, '.', '_' and '-' and must not start with '.' or '-'"}}},
+	"TestUsernameTooLong":  {func(c *Configuration) { c.Username = strings.Repeat("u", 33) }, []FieldError{{"username", "username must be at most 32 characters"}}},
+	"TestInvalidLabelKey":  {func(c *Configuration) { c.Labels = Labels{"-env": "prod", "team": "qa"} }, []FieldError{{"labels.-env", "label keys must be at most 63 letters, digits, '.', '_', '-' and '/' and must start and end with a letter or digit"}}},
+	"TestInvalidLabelsAll": {func(c *Configuration) { c.Labels = Labels{"b": "x y", "a": "x/y"} }, []FieldError{{"labels.a", "label values must be at most 63 letters, digits, '.', '_' and '-' and must start and end with a letter or digit"}, {"labels.b", "label values must be at most 63 letters, digits, '.', '_' and '-' and must start and end with a letter or digit"}}},
+}
+
+func TestValidate(t *testing.T) {
+	for name, test := range validationTests {
+		config := validConfig
+		test.change(&config)
+
+		err := config.Validate()
+		if test.expected == nil {
+			if err != nil {
+				t.Errorf("%s Failed: %s", name, failure{"Unexpected error", nil, err})
+			}
+			continue
+		}
+		if ve, ok := err.(ValidationError); !ok || !reflect.DeepEqual(ve.Errors, test.expected) {
+			t.Errorf("%s Failed: %s", name, failure{"", test.expected, err})
+		}
+	}
+}
+
+func TestValidateFields(t *testing.T) {
+	config := Configuration{Port: 0, HostName: "web.example.com"}
+	if err := config.ValidateFields("hostname"); err != nil {
+		t.Error("Failed:", failure{"Unset fields were validated", nil, err})
+	}
+
+	expected := []FieldError{{"port", "port must be between 1 and 65535"}}
+	if ve, ok := config.ValidateFields("hostname", "port").(ValidationError); !ok || !reflect.DeepEqual(ve.Errors, expected) {
+		t.Error("Failed:", failure{"Port of 0 was not rejected", expected, ve})
+	}
+}
@@ -1,25 +1,118 @@
 DROP TABLE IF EXISTS users CASCADE;
 DROP TABLE IF EXISTS configurations CASCADE;
 DROP TABLE IF EXISTS sessions CASCADE;
+DROP TABLE IF EXISTS api_tokens CASCADE;
+DROP TABLE IF EXISTS configuration_revisions CASCADE;
+DROP TABLE IF EXISTS configuration_labels CASCADE;
+DROP TABLE IF EXISTS attribute_schema CASCADE;
 CREATE TABLE users(
        id SERIAL PRIMARY KEY,
        username VARCHAR UNIQUE,
-       password VARCHAR       
+       password VARCHAR,
+       role VARCHAR NOT NULL DEFAULT 'viewer' CHECK (role IN ('viewer', 'editor', 'admin')),
+       disabled BOOLEAN NOT NULL DEFAULT false
 );
 
 
+DROP COLLATION IF EXISTS "natural";
+
+-- natural_key is the key that text is ordered by in a natural sort. Every
+-- run of digits is replaced by the number of digits of its length, its
+-- length and its digits without leading zeros, so that keys compared byte
+-- by byte compare runs of digits by their numeric value. It must match
+-- naturalKey in configuration/sort.go.
+CREATE OR REPLACE FUNCTION natural_key(value text) RETURNS text AS $$
+       SELECT coalesce(string_agg(
+              CASE WHEN run.digits IS NULL THEN m.match[1]
+                   ELSE length(length(run.digits)::text)::text || length(run.digits)::text || run.digits
+              END, '' ORDER BY m.n), '')
+       FROM regexp_matches(value, '[0-9]+|[^0-9]+', 'g') WITH ORDINALITY AS m(match, n),
+            LATERAL (SELECT CASE WHEN m.match[1] ~ '^[0-9]' THEN ltrim(m.match[1], '0') END AS digits) AS run
+$$ LANGUAGE SQL IMMUTABLE STRICT;
+
 CREATE TABLE configurations(
        id SERIAL PRIMARY KEY,
        config_name VARCHAR UNIQUE,
        host_name VARCHAR,
        port INT, 
-       username VARCHAR
+       username VARCHAR,
+       version INT NOT NULL DEFAULT 1,
+       attributes JSONB
+);
+
+-- Listings are sorted by fields and then by id. Text is compared byte by
+-- byte, or by its natural_key which compares runs of digits by their
+-- numeric value.
+CREATE INDEX configurations_config_name ON configurations(config_name COLLATE "C", id);
+CREATE INDEX configurations_host_name ON configurations(host_name COLLATE "C", id);
+CREATE INDEX configurations_port ON configurations(port, id);
+CREATE INDEX configurations_username ON configurations(username COLLATE "C", id);
+
+-- Searches look for words anywhere in the name, hostname and username.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE INDEX configurations_config_name_trgm ON configurations USING gin (config_name gin_trgm_ops);
+CREATE INDEX configurations_host_name_trgm ON configurations USING gin (host_name gin_trgm_ops);
+CREATE INDEX configurations_username_trgm ON configurations USING gin (username gin_trgm_ops);
+
+-- Labels are key/value pairs that group configurations. They are selected
+-- by key and value.
+CREATE TABLE configuration_labels(
+       config_id INT NOT NULL REFERENCES configurations(id) ON DELETE CASCADE,
+       key VARCHAR(63) NOT NULL,
+       value VARCHAR(63) NOT NULL,
+       PRIMARY KEY (config_id, key)
+);
+
+CREATE INDEX configuration_labels_key_value ON configuration_labels(key, value);
+
+-- The JSON Schema that the attributes of configurations must satisfy. There
+-- is at most one.
+CREATE TABLE attribute_schema(
+       id INT PRIMARY KEY DEFAULT 1 CHECK (id = 1),
+       schema JSONB NOT NULL,
+       updated_by VARCHAR NOT NULL,
+       updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- Every change to a configuration is recorded as a revision. config_id has
+-- no foreign key so that the history outlives deleted configurations.
+CREATE TABLE configuration_revisions(
+       id SERIAL PRIMARY KEY,
+       config_id INT NOT NULL,
+       config_name VARCHAR NOT NULL,
+       action VARCHAR NOT NULL,
+       actor VARCHAR NOT NULL,
+       created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+       before JSONB,
+       after JSONB
 );
 
+CREATE INDEX configuration_revisions_config_id ON configuration_revisions(config_id);
+CREATE INDEX configuration_revisions_config_name ON configuration_revisions(config_name);
+CREATE RULE configuration_revisions_no_update AS ON UPDATE TO configuration_revisions DO INSTEAD NOTHING;
+CREATE RULE configuration_revisions_no_delete AS ON DELETE TO configuration_revisions DO INSTEAD NOTHING;
 
+
+-- session_id is the SHA-256 hash of the session token, never the token itself
 create table sessions(
-       session_id VARCHAR,
+       session_id CHAR(64) PRIMARY KEY,
        user_id INT,
-       FOREIGN KEY (user_id) REFERENCES users(id)
+       created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+       last_seen TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+       FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 );
 
+CREATE INDEX sessions_created_at ON sessions(created_at);
+CREATE INDEX sessions_last_seen ON sessions(last_seen);
+
+-- token_hash is the SHA-256 hash of the API token, never the token itself
+CREATE TABLE api_tokens(
+       id SERIAL PRIMARY KEY,
+       user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+       name VARCHAR NOT NULL,
+       token_hash CHAR(64) UNIQUE NOT NULL,
+       scopes VARCHAR[] NOT NULL,
+       created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+       expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+       UNIQUE (user_id, name)
+);
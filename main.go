@@ -1,16 +1,29 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"flag"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	_ "github.com/lib/pq"
 	"github.com/warrenharper/restapi/auth"
 	"github.com/warrenharper/restapi/configuration"
 	"github.com/warrenharper/restapi/configuration/confighandler"
 	"github.com/warrenharper/restapi/utils/request"
-	"github.com/warrenharper/restapi/utils/response"
+	"github.com/warrenharper/restapi/utils/router"
+)
+
+var (
+	store           = flag.String("store", "postgres", `where configurations, users and sessions are stored: "postgres" or "memory"`)
+	sessionLifetime = flag.Duration("session-lifetime", auth.DefaultSessionLifetime, "how long a session lasts after logging in")
+	idleTimeout     = flag.Duration("idle-timeout", auth.DefaultIdleTimeout, "how long a session lasts without being used")
+	secureCookies   = flag.Bool("secure-cookies", true, "only send the session cookie over HTTPS")
 )
 
 func SetupDB() *sql.DB {
@@ -18,46 +31,68 @@ func SetupDB() *sql.DB {
 	if err != nil {
 		log.Fatal(err)
 	}
-	db.Exec("DELETE FROM users")
-	db.Exec("DELETE FROM configuration")
-	db.Exec("DELETE FROM sessions")
+	// The revisions cannot be deleted, only truncated.
+	if _, err := db.Exec("TRUNCATE api_tokens, sessions, users, configuration_labels, configuration_revisions, configurations, attribute_schema RESTART IDENTITY CASCADE"); err != nil {
+		log.Fatal(err)
+	}
 	return db
 }
 
+// SetupStores returns the stores selected by the store flag.
+func SetupStores() (*auth.Auth, configuration.ConfigurationStore) {
+	switch *store {
+	case "postgres":
+		db := SetupDB()
+		authStore := auth.PostgresStore{DB: db}
+		return &auth.Auth{UserStore: authStore, SessionStore: authStore, TokenStore: authStore}, &configuration.ConfigurationController{DB: db}
+	case "memory":
+		authStore := auth.NewMemoryStore()
+		return &auth.Auth{UserStore: authStore, SessionStore: authStore, TokenStore: authStore}, configuration.NewMemoryStore()
+	}
+	log.Fatalf("unknown store %q", *store)
+	return nil, nil
+}
+
 func main() {
-	var (
-		db                          = SetupDB()
-		authentication *auth.Auth   = &auth.Auth{db}
-		configHandler  http.Handler = confighandler.Handler{
-			configuration.ConfigurationController{db},
-		}
-	)
-	authentication.RegisterUser(auth.User{Username: "john_doe", Password: "password"})
-	configHandler = authentication.VerifySessions(configHandler)
+	flag.Parse()
+	authentication, configStore := SetupStores()
+	authentication.SessionLifetime = *sessionLifetime
+	authentication.IdleTimeout = *idleTimeout
+	authentication.Cookie = auth.DefaultCookieOptions()
+	authentication.Cookie.Secure = *secureCookies
+	stopReaping := authentication.ReapSessions(time.Minute)
+	var configHandler http.Handler = confighandler.New(configStore)
 
-	mux := http.NewServeMux()
+	authentication.RegisterUser(auth.User{Username: "john_doe", Password: "password", Role: auth.RoleAdmin})
+	configHandler = authentication.VerifySessions(configHandler)
 
-	// Login
-	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
-		if !request.Is(r, "POST") {
-			response.MethodNotAllowed(w)
-			return
-		}
-		authentication.HandleLogin(w, r)
-		return
-	})
-
-	//Logout
-	mux.HandleFunc("/logout", func(w http.ResponseWriter, r *http.Request) {
-		if !request.Is(r, "POST") {
-			response.MethodNotAllowed(w)
-			return
-		}
-		authentication.HandleLogout(w, r)
-	})
+	rt := router.New()
+	rt.HandleFunc("POST", "/login", authentication.HandleLogin)
+	rt.HandleFunc("POST", "/logout", authentication.HandleLogout)
+	rt.Mount("/configurations", configHandler)
+	rt.Mount("/tokens", authentication.VerifySessions(authentication.TokenHandler()))
+	rt.Mount("/users", authentication.VerifySessions(authentication.UserHandler()))
 
-	mux.Handle("/configurations/", http.StripPrefix("/configurations", configHandler))
+	srv := &http.Server{Addr: ":8080", Handler: request.WithID(rt)}
 
-	log.Fatal(http.ListenAndServe(":8080", mux))
+	// An interrupt lets the requests in flight finish before the server and
+	// the session reaper stop.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	shutdown := make(chan struct{})
+	go func() {
+		defer close(shutdown)
+		<-ctx.Done()
+		timeout, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(timeout); err != nil {
+			log.Print(err)
+		}
+	}()
 
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-shutdown
+	stopReaping()
 }
@@ -0,0 +1,274 @@
+// Package media encodes responses and decodes request bodies in the media
+// types that the API supports. Every value goes by way of its JSON so that
+// the other types have the same members as JSON, in the same order.
+package media
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v2"
+)
+
+// The media types that are supported.
+const (
+	JSON    = "application/json"
+	YAML    = "application/yaml"
+	CSV     = "text/csv"
+	MsgPack = "application/msgpack"
+)
+
+var UnsupportedTypeErr = errors.New("Media type is not supported")
+var NotTableErr = errors.New("Only lists can be sent as CSV")
+
+// aliases are other names of the media types.
+var aliases = map[string]string{
+	"application/x-yaml":      YAML,
+	"text/yaml":               YAML,
+	"text/x-yaml":             YAML,
+	"application/x-msgpack":   MsgPack,
+	"application/vnd.msgpack": MsgPack,
+}
+
+// Table is data that can be sent as CSV. The first of its rows names the
+// columns.
+type Table interface {
+	Rows() [][]string
+}
+
+// TypeOf returns the media type of a Content-Type header without its
+// parameters, with aliases replaced by the type they name.
+func TypeOf(header string) string {
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(header))
+	}
+	if alias, ok := aliases[mediaType]; ok {
+		return alias
+	}
+	return mediaType
+}
+
+// accepted is a media range of an Accept header and its quality.
+type accepted struct {
+	mediaType string
+	quality   float64
+}
+
+// Negotiate returns the media type that the Accept header prefers out of
+// those that can be sent, or UnsupportedTypeErr if there is none. CSV can
+// only be sent if table is set. An empty header accepts JSON, and JSON is
+// preferred for wildcards.
+func Negotiate(accept string, table bool) (string, error) {
+	if strings.TrimSpace(accept) == "" {
+		return JSON, nil
+	}
+
+	var ranges []accepted
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		if quality > 0 {
+			ranges = append(ranges, accepted{TypeOf(mediaType), quality})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].quality > ranges[j].quality })
+
+	for _, r := range ranges {
+		switch r.mediaType {
+		case "*/*", "application/*", JSON:
+			return JSON, nil
+		case YAML, MsgPack:
+			return r.mediaType, nil
+		case "text/*", CSV:
+			if table {
+				return CSV, nil
+			}
+		}
+	}
+	return "", UnsupportedTypeErr
+}
+
+// Encode returns the data in the media type. JSON is indented with a space
+// if pretty is set. Only a Table can be encoded as CSV.
+func Encode(mediaType string, data interface{}, pretty bool) ([]byte, error) {
+	switch mediaType {
+	case JSON:
+		if pretty {
+			return json.MarshalIndent(data, "", " ")
+		}
+		return json.Marshal(data)
+	case CSV:
+		table, ok := data.(Table)
+		if !ok {
+			return nil, NotTableErr
+		}
+		buff := &bytes.Buffer{}
+		writer := csv.NewWriter(buff)
+		writer.WriteAll(table.Rows())
+		return buff.Bytes(), writer.Error()
+	case YAML, MsgPack:
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.UseNumber()
+		value, err := readValue(decoder)
+		if err != nil {
+			return nil, err
+		}
+		if mediaType == YAML {
+			return yaml.Marshal(value)
+		}
+		return msgpack.Marshal(value)
+	}
+	return nil, UnsupportedTypeErr
+}
+
+// ToJSON returns a body of the media type as JSON. CSV bodies are not
+// supported because their shape depends on what they hold.
+func ToJSON(mediaType string, body []byte) ([]byte, error) {
+	var value interface{}
+	switch mediaType {
+	case JSON:
+		return body, nil
+	case YAML:
+		if err := yaml.Unmarshal(body, &value); err != nil {
+			return nil, err
+		}
+	case MsgPack:
+		if err := msgpack.Unmarshal(body, &value); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, UnsupportedTypeErr
+	}
+	value, err := jsonValue(value)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+// object is a JSON object that keeps the order of its members.
+type object yaml.MapSlice
+
+func (o object) MarshalYAML() (interface{}, error) {
+	return yaml.MapSlice(o), nil
+}
+
+func (o object) EncodeMsgpack(encoder *msgpack.Encoder) error {
+	if err := encoder.EncodeMapLen(len(o)); err != nil {
+		return err
+	}
+	for _, member := range o {
+		if err := encoder.Encode(member.Key); err != nil {
+			return err
+		}
+		if err := encoder.Encode(member.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readValue reads the next JSON value from the decoder. Objects are read as
+// objects, arrays as slices and numbers as int64s if they are integers and
+// float64s otherwise.
+func readValue(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := token.(type) {
+	case json.Delim:
+		if t == '[' {
+			array := []interface{}{}
+			for decoder.More() {
+				value, err := readValue(decoder)
+				if err != nil {
+					return nil, err
+				}
+				array = append(array, value)
+			}
+			_, err = decoder.Token()
+			return array, err
+		}
+		o := object{}
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := readValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			o = append(o, yaml.MapItem{Key: key, Value: value})
+		}
+		_, err = decoder.Token()
+		return o, err
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i, nil
+		}
+		return t.Float64()
+	}
+	return token, nil
+}
+
+// jsonValue returns the decoded value with its maps turned into JSON
+// objects. Maps with keys that are not strings are an error.
+func jsonValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		o := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			name, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("key %v must be a string", key)
+			}
+			var err error
+			if o[name], err = jsonValue(child); err != nil {
+				return nil, err
+			}
+		}
+		return o, nil
+	case map[string]interface{}:
+		o := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			var err error
+			if o[key], err = jsonValue(child); err != nil {
+				return nil, err
+			}
+		}
+		return o, nil
+	case []interface{}:
+		array := make([]interface{}, len(v))
+		for i, child := range v {
+			var err error
+			if array[i], err = jsonValue(child); err != nil {
+				return nil, err
+			}
+		}
+		return array, nil
+	}
+	return value, nil
+}
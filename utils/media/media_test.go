@@ -0,0 +1,121 @@
+package media
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+type table [][]string
+
+func (t table) Rows() [][]string { return t }
+
+var negotiateTests = map[string]struct {
+	accept   string
+	table    bool
+	expected string
+	err      error
+}{
+	"TestNegotiateEmpty":        {"", false, JSON, nil},
+	"TestNegotiateWildcard":     {"*/*", false, JSON, nil},
+	"TestNegotiateYAML":         {"application/yaml", false, YAML, nil},
+	"TestNegotiateAlias":        {"text/x-yaml", false, YAML, nil},
+	"TestNegotiateMsgPack":      {"application/x-msgpack", false, MsgPack, nil},
+	"TestNegotiateQuality":      {"application/json;q=0.5, application/yaml", false, YAML, nil},
+	"TestNegotiateRejected":     {"application/yaml;q=0, application/json", false, JSON, nil},
+	"TestNegotiateCSV":          {"text/csv", true, CSV, nil},
+	"TestNegotiateCSVNotTable":  {"text/csv", false, "", UnsupportedTypeErr},
+	"TestNegotiateCSVFallback":  {"text/csv, application/json;q=0.1", false, JSON, nil},
+	"TestNegotiateUnsupported":  {"application/xml", false, "", UnsupportedTypeErr},
+	"TestNegotiateMalformed":    {"application/xml, ;;", false, "", UnsupportedTypeErr},
+	"TestNegotiateTextWildcard": {"text/*", true, CSV, nil},
+}
+
+func TestNegotiate(t *testing.T) {
+	for name, test := range negotiateTests {
+		mediaType, err := Negotiate(test.accept, test.table)
+		if mediaType != test.expected || err != test.err {
+			t.Errorf("%s Failed: %q, %v is not %q, %v", name, mediaType, err, test.expected, test.err)
+		}
+	}
+}
+
+type member struct {
+	Name  string                 `json:"name"`
+	Port  int                    `json:"port,omitempty"`
+	Extra map[string]interface{} `json:"extra,omitempty"`
+}
+
+var encodeTests = map[string]struct {
+	mediaType string
+	data      interface{}
+	pretty    bool
+	expected  string
+}{
+	"TestEncodeJSON":       {JSON, member{Name: "web", Port: 22}, false, `{"name":"web","port":22}`},
+	"TestEncodePrettyJSON": {JSON, member{Name: "web"}, true, "{\n \"name\": \"web\"\n}"},
+	"TestEncodeYAMLOrder":  {YAML, member{Name: "web", Port: 22, Extra: map[string]interface{}{"b": 1, "a": 2.5}}, false, "name: web\nport: 22\nextra:\n  a: 2.5\n  b: 1\n"},
+	"TestEncodeCSV":        {CSV, table{{"name", "labels"}, {"web", "env=prod,team=web"}}, false, "name,labels\nweb,\"env=prod,team=web\"\n"},
+}
+
+func TestEncode(t *testing.T) {
+	for name, test := range encodeTests {
+		raw, err := Encode(test.mediaType, test.data, test.pretty)
+		if err != nil || string(raw) != test.expected {
+			t.Errorf("%s Failed: %q, %v is not %q", name, raw, err, test.expected)
+		}
+	}
+	if _, err := Encode(CSV, member{}, false); err != NotTableErr {
+		t.Error("Failed: CSV of a value that is not a table", err)
+	}
+}
+
+func TestMsgPackRoundTrip(t *testing.T) {
+	data := member{Name: "web", Port: 22, Extra: map[string]interface{}{"tunnel": map[string]interface{}{"local": 8080.0}}}
+	raw, err := Encode(MsgPack, data, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded map[string]interface{}
+	if err := msgpack.Unmarshal(raw, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded["name"] != "web" {
+		t.Error("Failed: MessagePack has the wrong members", decoded)
+	}
+
+	rawJSON, err := ToJSON(MsgPack, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actual member
+	json.Unmarshal(rawJSON, &actual)
+	if !reflect.DeepEqual(actual, data) {
+		t.Errorf("Failed:\n Expected: %v\n Actual: %v", data, actual)
+	}
+}
+
+var toJSONTests = map[string]struct {
+	mediaType string
+	body      string
+	expected  string
+	failed    bool
+}{
+	"TestYAMLToJSON":       {YAML, "name: web\nextra:\n  ports: [1, 2]\n", `{"extra":{"ports":[1,2]},"name":"web"}`, false},
+	"TestYAMLNonStringKey": {YAML, "1: web\n", "", true},
+	"TestMalformedYAML":    {YAML, "name: [", "", true},
+	"TestJSONToJSON":       {JSON, `{"name": "web"}`, `{"name": "web"}`, false},
+	"TestCSVToJSON":        {CSV, "name\nweb\n", "", true},
+}
+
+func TestToJSON(t *testing.T) {
+	for name, test := range toJSONTests {
+		raw, err := ToJSON(test.mediaType, []byte(test.body))
+		if (err != nil) != test.failed || string(raw) != test.expected {
+			t.Errorf("%s Failed: %q, %v is not %q", name, raw, err, test.expected)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package request
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/warrenharper/restapi/utils/media"
+)
+
+// JSONBody returns the body of the request as JSON. YAML and MessagePack
+// bodies are converted by their Content-Type and a body without a
+// Content-Type is JSON. Bodies of other types return
+// media.UnsupportedTypeErr.
+func JSONBody(r *http.Request) ([]byte, error) {
+	mediaType := media.JSON
+	if header := r.Header.Get("Content-Type"); header != "" {
+		mediaType = media.TypeOf(header)
+	}
+	if mediaType != media.JSON && mediaType != media.YAML && mediaType != media.MsgPack {
+		return nil, media.UnsupportedTypeErr
+	}
+
+	raw, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	return media.ToJSON(mediaType, raw)
+}
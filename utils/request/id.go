@@ -0,0 +1,46 @@
+package request
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+)
+
+// IDHeader is the header that carries the ID of a request.
+const IDHeader = "X-Request-ID"
+
+// idPattern matches the request IDs that are accepted from clients.
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+type idKey struct{}
+
+// WithID returns a handler that gives every request an ID before calling h.
+// The ID in the X-Request-ID header of the request is used if it is well
+// formed, otherwise a random one is made. The ID is sent back in the
+// X-Request-ID header of the response.
+func WithID(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(IDHeader)
+		if !idPattern.MatchString(id) {
+			id = newID()
+		}
+		w.Header().Set(IDHeader, id)
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), idKey{}, id)))
+	})
+}
+
+// ID returns the ID given to the request by WithID or "" if it has none.
+func ID(r *http.Request) string {
+	id, _ := r.Context().Value(idKey{}).(string)
+	return id
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
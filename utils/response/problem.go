@@ -0,0 +1,140 @@
+package response
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/warrenharper/restapi/utils/request"
+)
+
+// ProblemContentType is the media type of a Problem.
+const ProblemContentType = "application/problem+json"
+
+// The codes of problems. They are stable so that clients can rely on them
+// instead of the messages.
+const (
+	CodeMalformedBody      = "malformed_body"
+	CodeInvalidRequest     = "invalid_request"
+	CodeInvalidParameter   = "invalid_parameter"
+	CodeInvalidCredentials = "invalid_credentials"
+	CodeUnauthenticated    = "unauthenticated"
+	CodeForbidden          = "forbidden"
+	CodeNotFound           = "not_found"
+	CodeMethodNotAllowed   = "method_not_allowed"
+	CodeNotAcceptable      = "not_acceptable"
+	CodeConflict           = "conflict"
+	CodePreconditionFailed = "precondition_failed"
+	CodeValidationFailed   = "validation_failed"
+	CodeInvalidPatch       = "invalid_patch"
+	CodeTestFailed         = "test_failed"
+	CodeUnsupportedMedia   = "unsupported_media_type"
+	CodeServerError        = "server_error"
+)
+
+// Problem is an RFC 7807 description of an error. Code identifies the kind
+// of error and RequestID the request that caused it.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Code      string `json:"code"`
+	RequestID string `json:"request_id,omitempty"`
+
+	// Extensions are additional members of the problem, such as the fields
+	// that are invalid.
+	Extensions map[string]interface{} `json:"-"`
+}
+
+// NewProblem returns a problem with the status, code and detail. Its title
+// is the text of the status.
+func NewProblem(status int, code, detail string) Problem {
+	return Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// With returns the problem with the extension member added.
+func (p Problem) With(name string, value interface{}) Problem {
+	extensions := make(map[string]interface{}, len(p.Extensions)+1)
+	for key, v := range p.Extensions {
+		extensions[key] = v
+	}
+	extensions[name] = value
+	p.Extensions = extensions
+	return p
+}
+
+// MarshalJSON adds the extensions to the members of the problem.
+func (p Problem) MarshalJSON() ([]byte, error) {
+	type problem Problem
+	raw, err := marshal(problem(p), "")
+	if err != nil || len(p.Extensions) == 0 {
+		return raw, err
+	}
+
+	members := make(map[string]interface{})
+	if err := json.Unmarshal(raw, &members); err != nil {
+		return nil, err
+	}
+	for name, value := range p.Extensions {
+		if _, ok := members[name]; !ok {
+			members[name] = value
+		}
+	}
+	return marshal(members, "")
+}
+
+// marshal is like json.MarshalIndent but leaves characters such as '<' and
+// '>' unescaped so that details can quote parameters.
+func marshal(v interface{}, indent string) ([]byte, error) {
+	buff := &bytes.Buffer{}
+	encoder := json.NewEncoder(buff)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", indent)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buff.Bytes(), []byte("\n")), nil
+}
+
+// WriteProblem writes the problem with the ID of the request to the
+// response as application/problem+json. Like Respond it indents the problem
+// only if the request asks for it to be pretty.
+func WriteProblem(w http.ResponseWriter, r *http.Request, p Problem) {
+	p.RequestID = request.ID(r)
+	indent := ""
+	if pretty(r) {
+		indent = " "
+	}
+	rawJson, err := marshal(p, indent)
+	if err != nil {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	Write(w, p.Status, rawJson)
+}
+
+// Error writes a problem with the status, code and detail to the response.
+func Error(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	WriteProblem(w, r, NewProblem(status, code, detail))
+}
+
+// MalformedBody writes a problem with a status code of 400 for a request
+// whose body cannot be decoded.
+func MalformedBody(w http.ResponseWriter, r *http.Request) {
+	Error(w, r, http.StatusBadRequest, CodeMalformedBody, "The request body cannot be decoded")
+}
+
+// NotFound writes a problem with a status code of 404 and the detail.
+func NotFound(w http.ResponseWriter, r *http.Request, detail string) {
+	Error(w, r, http.StatusNotFound, CodeNotFound, detail)
+}
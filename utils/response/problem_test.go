@@ -0,0 +1,100 @@
+package response
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/warrenharper/restapi/utils/request"
+)
+
+func TestWriteProblem(t *testing.T) {
+	var r *http.Request
+	w := httptest.NewRecorder()
+	handler := request.WithID(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r = req
+		WriteProblem(w, req, NewProblem(http.StatusBadRequest, CodeInvalidParameter, `Bad parameter "port>=ssh"`).With("parameter", "port>=ssh"))
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(request.IDHeader, "abc-123")
+	handler.ServeHTTP(w, req)
+
+	if contentType := w.Header().Get("Content-Type"); contentType != ProblemContentType {
+		t.Error("Failed:", contentType, "is not", ProblemContentType)
+	}
+	if w.Code != http.StatusBadRequest {
+		t.Error("Failed: status", w.Code, "is not", http.StatusBadRequest)
+	}
+
+	var actual map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &actual); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"type":       "about:blank",
+		"title":      "Bad Request",
+		"status":     float64(http.StatusBadRequest),
+		"detail":     `Bad parameter "port>=ssh"`,
+		"code":       CodeInvalidParameter,
+		"request_id": "abc-123",
+		"parameter":  "port>=ssh",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Failed:\n Expected: %v\n Actual: %v", expected, actual)
+	}
+	if request.ID(r) != "abc-123" || w.Header().Get(request.IDHeader) != "abc-123" {
+		t.Error("Failed: request ID was not kept", request.ID(r))
+	}
+}
+
+func TestPrettyProblem(t *testing.T) {
+	tests := map[string]struct {
+		url      string
+		expected string
+	}{
+		"TestCompactProblem": {"/", `{"type":"about:blank","title":"Not Found","status":404,"detail":"gone","code":"not_found"}`},
+		"TestPrettyProblem":  {"/?pretty", "{\n \"type\": \"about:blank\",\n \"title\": \"Not Found\",\n \"status\": 404,\n \"detail\": \"gone\",\n \"code\": \"not_found\"\n}"},
+	}
+	for name, test := range tests {
+		w := httptest.NewRecorder()
+		NotFound(w, httptest.NewRequest("GET", test.url, nil), "gone")
+		if actual := w.Body.String(); actual != test.expected {
+			t.Errorf("%s Failed:\n Expected: %s\n Actual: %s", name, test.expected, actual)
+		}
+	}
+}
+
+func TestProblemExtensionsCannotReplaceMembers(t *testing.T) {
+	p := NewProblem(http.StatusNotFound, CodeNotFound, "").With("code", "other")
+	raw, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actual Problem
+	json.Unmarshal(raw, &actual)
+	if actual.Code != CodeNotFound {
+		t.Error("Failed: extension replaced the code", actual.Code)
+	}
+}
+
+func TestGeneratedRequestID(t *testing.T) {
+	tests := map[string]string{
+		"TestMissingID":   "",
+		"TestMalformedID": "bad id\n",
+	}
+	for name, header := range tests {
+		var id string
+		handler := request.WithID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id = request.ID(r)
+		}))
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(request.IDHeader, header)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if len(id) != 32 || id == header || w.Header().Get(request.IDHeader) != id {
+			t.Errorf("%s Failed: generated ID %q", name, id)
+		}
+	}
+}
@@ -1,40 +1,94 @@
 package response
 
 import (
-	"encoding/json"
 	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/warrenharper/restapi/utils/media"
 )
 
 // ServerError is just a convience function that allows us to write a
-// status code of 500 and a message of "Server Error" to the response
-func ServerError(w http.ResponseWriter) {
-	http.Error(w, "Server Error", http.StatusInternalServerError)
+// problem with a status code of 500 to the response
+func ServerError(w http.ResponseWriter, r *http.Request) {
+	Error(w, r, http.StatusInternalServerError, CodeServerError, "The server failed to handle the request")
 }
 
 // MethodNotAllowed is just a convience function that allows us to write a
-// status code of 405 and a message of "" to the response
-func MethodNotAllowed(w http.ResponseWriter) {
-	http.Error(w, "", http.StatusMethodNotAllowed)
+// problem with a status code of 405 to the response
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	Error(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, r.Method+" is not allowed")
 }
 
-// WriteResponse will attempt to write the data to response. On failure it will
-// write a status code of 500 and a message of "Server Error" to the response.
+// WriteResponse will attempt to write the data to response. Once the status
+// code is written nothing else can be sent if writing the data fails.
 func Write(w http.ResponseWriter, code int, data []byte) {
 	w.WriteHeader(code)
+	w.Write(data)
+}
 
-	if _, err := w.Write(data); err != nil {
-		ServerError(w)
+// PrettyParameter is the query parameter that asks for indented JSON.
+const PrettyParameter = "pretty"
+
+// Respond writes the data to the response in the media type that the Accept
+// header of the request prefers: JSON, YAML, MessagePack or, if the data is
+// a media.Table, CSV. JSON is compact unless the "pretty" parameter is set.
+// If none of the types are acceptable it writes a problem with a status code
+// of 406 instead, and on failure one with a status code of 500.
+func Respond(w http.ResponseWriter, r *http.Request, code int, data interface{}) {
+	w.Header().Add("Vary", "Accept")
+	_, table := data.(media.Table)
+	mediaType, err := media.Negotiate(r.Header.Get("Accept"), table)
+	if err != nil {
+		NotAcceptable(w, r, table)
+		return
 	}
-}
 
-// WriteJsonResponse will attempt to write the data to response in json format.
-// On failure it will  write a status code of 500 and a message of "Server Error"
-// to the response.
-func WriteJson(w http.ResponseWriter, code int, data interface{}) {
-	rawJson, err := json.MarshalIndent(data, "", " ")
+	raw, err := media.Encode(mediaType, data, pretty(r))
 	if err != nil {
-		http.Error(w, "Server Error", http.StatusInternalServerError)
+		Error(w, r, http.StatusInternalServerError, CodeServerError, "The response could not be encoded")
+		return
 	}
-	Write(w, code, rawJson)
+	w.Header().Set("Content-Type", mediaType)
+	Write(w, code, raw)
+}
 
+// Representation names the representation of the data that Respond sends
+// for the request unless it is compact JSON, in which case it returns "":
+// "pretty" for indented JSON and otherwise the subtype of the media type,
+// such as "yaml". It returns "" if no representation is acceptable.
+func Representation(r *http.Request, data interface{}) string {
+	_, table := data.(media.Table)
+	mediaType, err := media.Negotiate(r.Header.Get("Accept"), table)
+	switch {
+	case err != nil:
+		return ""
+	case mediaType == media.JSON && pretty(r):
+		return "pretty"
+	case mediaType == media.JSON:
+		return ""
+	}
+	return mediaType[strings.Index(mediaType, "/")+1:]
+}
+
+// NotAcceptable writes a problem with a status code of 406 for a request
+// whose Accept header allows none of the media types that the response can
+// be sent in.
+func NotAcceptable(w http.ResponseWriter, r *http.Request, table bool) {
+	types := []string{media.JSON, media.YAML, media.MsgPack}
+	if table {
+		types = append(types, media.CSV)
+	}
+	Error(w, r, http.StatusNotAcceptable, CodeNotAcceptable, "The response can only be sent as "+strings.Join(types, ", "))
+}
+
+// pretty determines if the request asks for indented JSON with a "pretty"
+// parameter that is empty or true.
+func pretty(r *http.Request) bool {
+	values, ok := r.URL.Query()[PrettyParameter]
+	if !ok {
+		return false
+	}
+	on, err := strconv.ParseBool(values[0])
+	return values[0] == "" || (err == nil && on)
 }
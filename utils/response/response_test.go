@@ -0,0 +1,67 @@
+package response
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var respondTests = map[string]struct {
+	url         string
+	accept      string
+	expected    int
+	contentType string
+	body        string
+}{
+	"TestRespondCompact":       {"/", "", http.StatusOK, "application/json", `{"name":"web"}`},
+	"TestRespondPretty":        {"/?pretty", "", http.StatusOK, "application/json", "{\n \"name\": \"web\"\n}"},
+	"TestRespondPrettyTrue":    {"/?pretty=true", "", http.StatusOK, "application/json", "{\n \"name\": \"web\"\n}"},
+	"TestRespondPrettyFalse":   {"/?pretty=false", "", http.StatusOK, "application/json", `{"name":"web"}`},
+	"TestRespondYAML":          {"/", "application/yaml", http.StatusOK, "application/yaml", "name: web\n"},
+	"TestRespondNotAcceptable": {"/", "text/csv", http.StatusNotAcceptable, ProblemContentType, ""},
+}
+
+func TestRespond(t *testing.T) {
+	data := struct {
+		Name string `json:"name"`
+	}{"web"}
+	for name, test := range respondTests {
+		req := httptest.NewRequest("GET", test.url, nil)
+		req.Header.Set("Accept", test.accept)
+		w := httptest.NewRecorder()
+		Respond(w, req, http.StatusOK, data)
+
+		switch {
+		case w.Code != test.expected:
+			t.Error("Failed:", name, "status", w.Code, "is not", test.expected)
+		case w.Header().Get("Content-Type") != test.contentType:
+			t.Error("Failed:", name, "Content-Type", w.Header().Get("Content-Type"), "is not", test.contentType)
+		case test.body != "" && w.Body.String() != test.body:
+			t.Errorf("Failed: %s body %q is not %q", name, w.Body.String(), test.body)
+		case w.Header().Get("Vary") != "Accept":
+			t.Error("Failed:", name, "Vary", w.Header().Get("Vary"), "is not Accept")
+		}
+	}
+}
+
+var representationTests = map[string]struct {
+	url      string
+	accept   string
+	expected string
+}{
+	"TestRepresentationJSON":    {"/", "", ""},
+	"TestRepresentationPretty":  {"/?pretty", "application/json", "pretty"},
+	"TestRepresentationYAML":    {"/?pretty", "application/yaml", "yaml"},
+	"TestRepresentationMsgPack": {"/", "application/x-msgpack", "msgpack"},
+	"TestRepresentationNone":    {"/", "text/csv", ""},
+}
+
+func TestRepresentation(t *testing.T) {
+	for name, test := range representationTests {
+		req := httptest.NewRequest("GET", test.url, nil)
+		req.Header.Set("Accept", test.accept)
+		if actual := Representation(req, struct{}{}); actual != test.expected {
+			t.Errorf("Failed: %s representation %q is not %q", name, actual, test.expected)
+		}
+	}
+}
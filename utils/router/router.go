@@ -0,0 +1,270 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/warrenharper/restapi/utils/response"
+)
+
+// Router sends each request to the handler registered for its method and
+// path. Patterns are paths whose segments may be named parameters, such as
+// "/configurations/:name/history". A static segment is preferred to a
+// parameter so "/schema" is matched before "/:name".
+//
+// Paths are matched without their trailing slash and empty segments, so
+// "/configurations", "/configurations/" and "//configurations" are the same
+// path. A HEAD request is served by the GET handler of its path. If the path
+// is known but its method is not a 405 code is sent and an OPTIONS request
+// is answered with a 204 code. Both list the allowed methods in the Allow
+// header. Unknown paths are sent to NotFound.
+type Router struct {
+	// NotFound serves the requests that match no route. A 404 problem is
+	// sent if it is nil.
+	NotFound http.Handler
+
+	routes []*route
+	mounts []*route
+}
+
+type route struct {
+	segments []string
+	handlers map[string]http.Handler
+}
+
+type paramsKey struct{}
+
+// New returns a Router without routes.
+func New() *Router {
+	return &Router{}
+}
+
+// Handle registers the handler for requests with the method whose path
+// matches the pattern.
+func (rt *Router) Handle(method, pattern string, h http.Handler) {
+	segments := split(pattern)
+	method = strings.ToUpper(method)
+	for _, route := range rt.routes {
+		if equal(route.segments, segments) {
+			route.handlers[method] = h
+			return
+		}
+	}
+	rt.routes = append(rt.routes, &route{segments, map[string]http.Handler{method: h}})
+}
+
+// HandleFunc registers the handler function for requests with the method
+// whose path matches the pattern.
+func (rt *Router) HandleFunc(method, pattern string, f func(http.ResponseWriter, *http.Request)) {
+	rt.Handle(method, pattern, http.HandlerFunc(f))
+}
+
+// Mount sends every request whose path starts with the prefix to the
+// handler, whatever its method. The prefix is removed from the path of the
+// request so the handler sees "/" for the prefix itself. Parameters of the
+// prefix are kept.
+func (rt *Router) Mount(prefix string, h http.Handler) {
+	rt.mounts = append(rt.mounts, &route{split(prefix), map[string]http.Handler{"": h}})
+	sort.SliceStable(rt.mounts, func(i, j int) bool {
+		return len(rt.mounts[i].segments) > len(rt.mounts[j].segments)
+	})
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	segments := split(r.URL.EscapedPath())
+
+	if route, params, ok := rt.match(segments); ok {
+		r = withParams(r, params)
+		method := strings.ToUpper(r.Method)
+		if h, ok := route.handler(method); ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Allow", strings.Join(route.allowed(), ", "))
+		if method == http.MethodOptions {
+			response.Write(w, http.StatusNoContent, nil)
+			return
+		}
+		response.MethodNotAllowed(w, r)
+		return
+	}
+
+	for _, mount := range rt.mounts {
+		params, ok := mount.matchPrefix(segments)
+		if !ok {
+			continue
+		}
+		mount.handlers[""].ServeHTTP(w, strip(withParams(r, params), segments[len(mount.segments):]))
+		return
+	}
+
+	if rt.NotFound != nil {
+		rt.NotFound.ServeHTTP(w, r)
+		return
+	}
+	response.NotFound(w, r, "No resource at "+r.URL.Path)
+}
+
+// match returns the most specific route whose pattern matches the segments
+// and the values of its parameters.
+func (rt *Router) match(segments []string) (best *route, params map[string]string, ok bool) {
+	for _, route := range rt.routes {
+		values, matched := route.matchPrefix(segments)
+		if !matched || len(route.segments) != len(segments) {
+			continue
+		}
+		if best == nil || route.moreSpecific(best) {
+			best, params = route, values
+		}
+	}
+	return best, params, best != nil
+}
+
+// matchPrefix reports whether the pattern of the route matches the start of
+// the segments and returns the values of its parameters.
+func (rt *route) matchPrefix(segments []string) (map[string]string, bool) {
+	if len(segments) < len(rt.segments) {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	for i, segment := range rt.segments {
+		value, err := url.PathUnescape(segments[i])
+		if err != nil {
+			return nil, false
+		}
+		if name, ok := param(segment); ok {
+			params[name] = value
+		} else if segment != value {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// moreSpecific reports whether the route has a static segment where the
+// other route has a parameter before the other way around.
+func (rt *route) moreSpecific(other *route) bool {
+	for i := range rt.segments {
+		_, isParam := param(rt.segments[i])
+		_, otherIsParam := param(other.segments[i])
+		if isParam != otherIsParam {
+			return otherIsParam
+		}
+	}
+	return false
+}
+
+// handler returns the handler for the method, using the GET handler for
+// HEAD requests.
+func (rt *route) handler(method string) (http.Handler, bool) {
+	h, ok := rt.handlers[method]
+	if !ok && method == http.MethodHead {
+		h, ok = rt.handlers[http.MethodGet]
+	}
+	return h, ok
+}
+
+// allowed returns the sorted methods that can be used on the route.
+func (rt *route) allowed() []string {
+	methods := []string{http.MethodOptions}
+	for method := range rt.handlers {
+		methods = append(methods, method)
+	}
+	if _, ok := rt.handlers[http.MethodGet]; ok {
+		if _, ok := rt.handlers[http.MethodHead]; !ok {
+			methods = append(methods, http.MethodHead)
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// Param returns the value of the named parameter in the path of the request
+// or "" if its route has no such parameter.
+func Param(r *http.Request, name string) string {
+	params, _ := r.Context().Value(paramsKey{}).(map[string]string)
+	return params[name]
+}
+
+// WithParam returns a handler that calls f with the value of the named
+// parameter.
+func WithParam(name string, f func(http.ResponseWriter, *http.Request, string)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f(w, r, Param(r, name))
+	})
+}
+
+// withParams adds the parameters to those of the request.
+func withParams(r *http.Request, params map[string]string) *http.Request {
+	if len(params) == 0 {
+		return r
+	}
+	merged := make(map[string]string)
+	if parent, ok := r.Context().Value(paramsKey{}).(map[string]string); ok {
+		for name, value := range parent {
+			merged[name] = value
+		}
+	}
+	for name, value := range params {
+		merged[name] = value
+	}
+	return r.WithContext(context.WithValue(r.Context(), paramsKey{}, merged))
+}
+
+// strip returns a copy of the request whose path is the remaining escaped
+// segments.
+func strip(r *http.Request, remaining []string) *http.Request {
+	raw := "/" + strings.Join(remaining, "/")
+	path, err := url.PathUnescape(raw)
+	if err != nil {
+		path = raw
+	}
+
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.URL = new(url.URL)
+	*r2.URL = *r.URL
+	r2.URL.Path = path
+	r2.URL.RawPath = ""
+	if path != raw {
+		r2.URL.RawPath = raw
+	}
+	return r2
+}
+
+// split returns the non-empty segments of the path.
+func split(path string) []string {
+	segments := make([]string, 0)
+	for _, segment := range strings.Split(path, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
+
+// param returns the name of the parameter if the segment of a pattern is
+// one.
+func param(segment string) (string, bool) {
+	if strings.HasPrefix(segment, ":") {
+		return segment[1:], true
+	}
+	return "", false
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
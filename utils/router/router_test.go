@@ -0,0 +1,81 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// echo returns a handler that writes the name and the parameters of the
+// request.
+func echo(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(name + " " + Param(r, "name") + " " + Param(r, "id") + " " + r.URL.Path))
+	})
+}
+
+func newRouter() *Router {
+	sub := New()
+	sub.Handle("GET", "/", echo("list"))
+	sub.Handle("GET", "/schema", echo("schema"))
+	sub.Handle("GET", "/:name", echo("get"))
+	sub.Handle("DELETE", "/:name", echo("delete"))
+	sub.Handle("GET", "/:name/history/:id", echo("revision"))
+
+	rt := New()
+	rt.Handle("POST", "/login", echo("login"))
+	rt.Mount("/configurations", sub)
+	return rt
+}
+
+var routeTests = map[string]struct {
+	method   string
+	url      string
+	expected int
+	body     string
+	allow    string
+}{
+	"TestRouteRoot":           {"GET", "/configurations", http.StatusOK, "list   /", ""},
+	"TestRouteTrailingSlash":  {"GET", "/configurations/", http.StatusOK, "list   /", ""},
+	"TestRouteDoubleSlash":    {"GET", "//configurations//Config1/", http.StatusOK, "get Config1  /Config1", ""},
+	"TestRouteStatic":         {"GET", "/configurations/schema", http.StatusOK, "schema   /schema", ""},
+	"TestRouteParams":         {"GET", "/configurations/Config1/history/4", http.StatusOK, "revision Config1 4 /Config1/history/4", ""},
+	"TestRouteEscaped":        {"GET", "/configurations/a%2Fb", http.StatusOK, "get a/b  /a/b", ""},
+	"TestRouteMethod":         {"DELETE", "/configurations/Config1", http.StatusOK, "delete Config1  /Config1", ""},
+	"TestRouteHead":           {"HEAD", "/configurations/Config1", http.StatusOK, "get Config1  /Config1", ""},
+	"TestRouteOptions":        {"OPTIONS", "/configurations/Config1", http.StatusNoContent, "", "DELETE, GET, HEAD, OPTIONS"},
+	"TestRouteNotAllowed":     {"PUT", "/configurations/Config1", http.StatusMethodNotAllowed, "", "DELETE, GET, HEAD, OPTIONS"},
+	"TestRouteStaticAllow":    {"DELETE", "/configurations/schema", http.StatusMethodNotAllowed, "", "GET, HEAD, OPTIONS"},
+	"TestRouteNotAllowedTop":  {"GET", "/login", http.StatusMethodNotAllowed, "", "OPTIONS, POST"},
+	"TestRouteNotFound":       {"GET", "/unknown", http.StatusNotFound, "", ""},
+	"TestRouteNotFoundNested": {"GET", "/configurations/Config1/a", http.StatusNotFound, "", ""},
+}
+
+func TestRoutes(t *testing.T) {
+	rt := newRouter()
+	for testName, test := range routeTests {
+		w := httptest.NewRecorder()
+		rt.ServeHTTP(w, httptest.NewRequest(test.method, test.url, nil))
+
+		switch {
+		case w.Code != test.expected:
+			t.Error("Failed:", testName, "status", w.Code, "is not", test.expected)
+		case test.body != "" && w.Body.String() != test.body:
+			t.Errorf("Failed: %s body %q is not %q", testName, w.Body.String(), test.body)
+		case w.Header().Get("Allow") != test.allow:
+			t.Errorf("Failed: %s Allow %q is not %q", testName, w.Header().Get("Allow"), test.allow)
+		}
+	}
+}
+
+func TestNotFoundHandler(t *testing.T) {
+	rt := New()
+	rt.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	w := httptest.NewRecorder()
+	rt.ServeHTTP(w, httptest.NewRequest("GET", "/unknown", nil))
+	if w.Code != http.StatusTeapot {
+		t.Error("Failed: status", w.Code, "is not", http.StatusTeapot)
+	}
+}